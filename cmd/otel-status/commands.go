@@ -0,0 +1,393 @@
+/*******************************************************************************
+ * Copyright (c) 2023 Cedric L'homme.
+ *
+ * This file is part of otel-status.
+ *
+ * otel-status is free software: you can redistribute it and/or modify it
+ * under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License,
+ * or (at your option) any later version.
+ *
+ *  otel-status is distributed in the hope that it will be useful, but
+ *  WITHOUT ANY WARRANTY; without even the implied warranty of
+ *  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.
+ *  See the GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with otel-status. If not, see <https://www.gnu.org/licenses/>.
+ ******************************************************************************/
+
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+	"text/tabwriter"
+	"time"
+
+	"github.com/go-co-op/gocron"
+	"github.com/rangzen/otel-status/package/config"
+	"github.com/rangzen/otel-status/package/status"
+	"go.opentelemetry.io/otel"
+	apimetric "go.opentelemetry.io/otel/metric"
+	"go.opentelemetry.io/otel/metric/global"
+	apitrace "go.opentelemetry.io/otel/trace"
+	"golang.org/x/exp/slog"
+)
+
+// newFlagSet returns the flag set of the command.
+func newFlagSet(command string) *flag.FlagSet {
+	flags := flag.NewFlagSet(command, flag.ExitOnError)
+	flags.Usage = func() {
+		fmt.Fprintf(flags.Output(), "Usage: otel-status %s -config config.yaml [flags]\n\nFlags:\n", command)
+		flags.PrintDefaults()
+	}
+	return flags
+}
+
+// loadConfig loads the configuration file and logs all its problems.
+// It returns false if the configuration cannot be used.
+func loadConfig(path string) (config.Config, bool) {
+	if path == "" {
+		slog.Error("You must provide a configuration file. Try -h for help.", nil)
+		return config.Config{}, false
+	}
+
+	slog.Info("loading configuration", "path", path)
+	conf, err := config.FromFile(path)
+	var validationErr *config.ValidationError
+	if errors.As(err, &validationErr) {
+		for _, p := range validationErr.Problems {
+			slog.Error("invalid configuration", p.Err, "path", path, "line", p.Line, "check", p.Check)
+		}
+		return config.Config{}, false
+	}
+	if err != nil {
+		slog.Error("loading configuration", err, "path", path)
+		return config.Config{}, false
+	}
+	return conf, true
+}
+
+// newChecks returns the checks of the configuration.
+func newChecks(conf config.Config) ([]*status.Check, error) {
+	staters, err := conf.Staters()
+	if err != nil {
+		return nil, err
+	}
+	checks := make([]*status.Check, 0, len(staters))
+	for _, stater := range staters {
+		checks = append(checks, status.NewCheck(stater))
+	}
+	return checks, nil
+}
+
+// closeChecks closes the checks, e.g. their database connections.
+func closeChecks(checks []*status.Check) {
+	for _, check := range checks {
+		if err := check.Close(); err != nil {
+			slog.Error("closing check", err, "name", check.Stater.Config().Name)
+		}
+	}
+}
+
+// schedule adds a job per check to the scheduler, following the cron of the check.
+// The first run of a check with a duration as cron is delayed by its offset, if any.
+func schedule(scheduler *gocron.Scheduler, checks []*status.Check, offsets map[string]time.Duration,
+	job func(check *status.Check)) ([]*gocron.Job, error) {
+	jobs := make([]*gocron.Job, 0, len(checks))
+	for _, check := range checks {
+		c := check.Stater.Config()
+		var j *gocron.Job
+		var err error
+		if c.IsDuration() {
+			scheduler.Every(c.CronDuration())
+			if offset := offsets[c.Name]; offset > 0 {
+				scheduler.StartAt(time.Now().Add(offset))
+			}
+			j, err = scheduler.Do(job, check)
+		} else {
+			j, err = scheduler.Cron(c.CronExp()).Do(job, check)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("scheduling %q: %w", c.Name, err)
+		}
+		jobs = append(jobs, j)
+	}
+	return jobs, nil
+}
+
+// validate loads the configuration and exits with 1 if it is invalid.
+func validate(args []string) int {
+	flags := newFlagSet("validate")
+	configPath := flags.String("config", "", "Path to the configuration file.")
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+
+	conf, ok := loadConfig(*configPath)
+	if !ok {
+		return 1
+	}
+	staters, err := conf.Staters()
+	if err != nil {
+		slog.Error("creating staters", err)
+		return 1
+	}
+	for _, stater := range staters {
+		if closer, ok := stater.(io.Closer); ok {
+			_ = closer.Close()
+		}
+	}
+	fmt.Printf("%s: %d check(s), configuration is valid\n", *configPath, len(staters))
+	return 0
+}
+
+// onceResult is the result of a check run by run-once.
+type onceResult struct {
+	Name       string `json:"name"`
+	Plugin     string `json:"plugin"`
+	Up         bool   `json:"up"`
+	DurationMs int64  `json:"duration_ms"`
+	Message    string `json:"message,omitempty"`
+	Error      string `json:"error,omitempty"`
+}
+
+// runOnce runs the checks a single time, concurrently, and prints their results.
+// It exits with 1 if a check is down.
+func runOnce(args []string) int {
+	flags := newFlagSet("run-once")
+	configPath := flags.String("config", "", "Path to the configuration file.")
+	names := flags.String("name", "", "Comma-separated names of the checks to run, all if empty.")
+	plugin := flags.String("plugin", "", "Plugin of the checks to run, all if empty.")
+	output := flags.String("output", "text", "Output format: text or json.")
+	export := flags.Bool("export", false, "Export the traces and metrics with Open Telemetry.")
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+	if *output != "text" && *output != "json" {
+		fmt.Fprintf(os.Stderr, "unknown output %q\n", *output)
+		return 2
+	}
+
+	conf, ok := loadConfig(*configPath)
+	if !ok {
+		return 1
+	}
+	checks, err := newChecks(conf)
+	if err != nil {
+		slog.Error("creating staters", err)
+		return 1
+	}
+	defer closeChecks(checks)
+	checks = filterChecks(checks, *names, *plugin)
+	if len(checks) == 0 {
+		slog.Error("no check to run", nil, "name", *names, "plugin", *plugin)
+		return 1
+	}
+
+	tracer := apitrace.NewNoopTracerProvider().Tracer(instrumentName)
+	meter := apimetric.NewNoopMeterProvider().Meter(instrumentName)
+	if *export {
+		tracerProvider, err := initTracer()
+		if err != nil {
+			slog.Error("initializing tracer", err)
+			return 1
+		}
+		meterProvider, metricsServers, err := initMeter()
+		if err != nil {
+			slog.Error("initializing meter", err)
+			return 1
+		}
+		defer func() {
+			for _, server := range metricsServers {
+				stopServer(server, "metrics")
+			}
+			if err := shutdownProviders(tracerProvider, meterProvider); err != nil {
+				slog.Error("flushing traces and metrics", err)
+			}
+		}()
+		tracer = otel.Tracer(instrumentName)
+		meter = global.MeterProvider().Meter(instrumentName)
+	}
+
+	results := make([]onceResult, len(checks))
+	var wg sync.WaitGroup
+	for i, check := range checks {
+		wg.Add(1)
+		go func(i int, check *status.Check) {
+			defer wg.Done()
+			res, err := check.Run(context.Background(), tracer, meter)
+			results[i] = onceResult{
+				Name:       check.Stater.Config().Name,
+				Plugin:     check.Stater.Plugin(),
+				Up:         res.Up,
+				DurationMs: check.Last().Duration.Milliseconds(),
+			}
+			if err != nil {
+				results[i].Error = err.Error()
+			} else {
+				results[i].Message = res.Message
+			}
+		}(i, check)
+	}
+	wg.Wait()
+
+	if *output == "json" {
+		err = printJSON(os.Stdout, results)
+	} else {
+		err = printResults(os.Stdout, results)
+	}
+	if err != nil {
+		slog.Error("printing results", err)
+		return 1
+	}
+
+	for _, r := range results {
+		if !r.Up {
+			return 1
+		}
+	}
+	return 0
+}
+
+// filterChecks returns the checks with one of the comma-separated names and the plugin, if not empty.
+func filterChecks(checks []*status.Check, names, plugin string) []*status.Check {
+	wanted := map[string]bool{}
+	for _, name := range strings.Split(names, ",") {
+		if name = strings.TrimSpace(name); name != "" {
+			wanted[name] = true
+		}
+	}
+	var filtered []*status.Check
+	for _, check := range checks {
+		if len(wanted) > 0 && !wanted[check.Stater.Config().Name] {
+			continue
+		}
+		if plugin != "" && check.Stater.Plugin() != plugin {
+			continue
+		}
+		filtered = append(filtered, check)
+	}
+	return filtered
+}
+
+// printResults prints the results as a table.
+func printResults(w io.Writer, results []onceResult) error {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "NAME\tPLUGIN\tSTATUS\tDURATION\tDETAIL")
+	for _, r := range results {
+		state := "UP"
+		if !r.Up {
+			state = "DOWN"
+		}
+		detail := r.Message
+		if r.Error != "" {
+			detail = r.Error
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%dms\t%s\n", r.Name, r.Plugin, state, r.DurationMs, detail)
+	}
+	return tw.Flush()
+}
+
+// printJSON prints the value as indented JSON.
+func printJSON(w io.Writer, v interface{}) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(v)
+}
+
+// listEntry is a check printed by list.
+type listEntry struct {
+	Name    string    `json:"name"`
+	Plugin  string    `json:"plugin"`
+	Cron    string    `json:"cron"`
+	NextRun time.Time `json:"next_run"`
+}
+
+// list prints the checks with their next run time if they were scheduled now by run.
+// The checks with a duration as cron run at once, or after their offset with -spread,
+// the next run of the others is computed by the scheduler.
+func list(args []string) int {
+	flags := newFlagSet("list")
+	configPath := flags.String("config", "", "Path to the configuration file.")
+	output := flags.String("output", "text", "Output format: text or json.")
+	spread := flags.Bool("spread", false, "Spread the first runs of the checks with the same @duration evenly across it.")
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+	if *output != "text" && *output != "json" {
+		fmt.Fprintf(os.Stderr, "unknown output %q\n", *output)
+		return 2
+	}
+
+	conf, ok := loadConfig(*configPath)
+	if !ok {
+		return 1
+	}
+	checks, err := newChecks(conf)
+	if err != nil {
+		slog.Error("creating staters", err)
+		return 1
+	}
+	defer closeChecks(checks)
+
+	start := time.Now()
+	var offsets map[string]time.Duration
+	if *spread {
+		staters := make([]status.Stater, len(checks))
+		for i, check := range checks {
+			staters[i] = check.Stater
+		}
+		offsets = spreadOffsets(staters)
+	}
+
+	// The next runs of the cron expressions are only known once the scheduler is started, the jobs do nothing.
+	scheduler := gocron.NewScheduler(time.Local)
+	jobs, err := schedule(scheduler, checks, nil, func(*status.Check) {})
+	if err != nil {
+		slog.Error("scheduling", err)
+		return 1
+	}
+	scheduler.StartAsync()
+	scheduler.Stop()
+
+	entries := make([]listEntry, len(checks))
+	for i, check := range checks {
+		c := check.Stater.Config()
+		nextRun := jobs[i].NextRun()
+		if c.IsDuration() {
+			// run starts them at once, the job has already run in the started scheduler.
+			nextRun = start.Add(offsets[c.Name])
+		}
+		entries[i] = listEntry{
+			Name:    c.Name,
+			Plugin:  check.Stater.Plugin(),
+			Cron:    c.Cron,
+			NextRun: nextRun,
+		}
+	}
+
+	if *output == "json" {
+		err = printJSON(os.Stdout, entries)
+	} else {
+		tw := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(tw, "NAME\tPLUGIN\tCRON\tNEXT RUN")
+		for _, e := range entries {
+			fmt.Fprintf(tw, "%s\t%s\t%s\t%s\n", e.Name, e.Plugin, e.Cron, e.NextRun.Format(time.RFC3339))
+		}
+		err = tw.Flush()
+	}
+	if err != nil {
+		slog.Error("printing checks", err)
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,58 @@
+/*******************************************************************************
+ * Copyright (c) 2023 Cedric L'homme.
+ *
+ * This file is part of otel-status.
+ *
+ * otel-status is free software: you can redistribute it and/or modify it
+ * under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License,
+ * or (at your option) any later version.
+ *
+ *  otel-status is distributed in the hope that it will be useful, but
+ *  WITHOUT ANY WARRANTY; without even the implied warranty of
+ *  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.
+ *  See the GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with otel-status. If not, see <https://www.gnu.org/licenses/>.
+ ******************************************************************************/
+
+package main
+
+import (
+	"testing"
+
+	"github.com/rangzen/otel-status/package/status"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFilterChecks(t *testing.T) {
+	checks := []*status.Check{
+		status.NewCheck(fakeStater{name: "API", plugin: "http", cron: "@1m"}),
+		status.NewCheck(fakeStater{name: "Web", plugin: "http", cron: "@1m"}),
+		status.NewCheck(fakeStater{name: "Database", plugin: "sql", cron: "@1m"}),
+	}
+	tests := []struct {
+		name   string
+		names  string
+		plugin string
+		want   []string
+	}{
+		{name: "no filter, should return all the checks", want: []string{"API", "Web", "Database"}},
+		{name: "names, should return the checks with these names", names: "Database, API", want: []string{"API", "Database"}},
+		{name: "names with empty items, should ignore them", names: ",Web,,", want: []string{"Web"}},
+		{name: "a plugin, should return the checks of the plugin", plugin: "http", want: []string{"API", "Web"}},
+		{name: "names and a plugin, should return the checks matching both", names: "API,Database", plugin: "http", want: []string{"API"}},
+		{name: "an unknown name, should return no check", names: "nope", want: nil},
+		{name: "an unknown plugin, should return no check", plugin: "nope", want: nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got []string
+			for _, check := range filterChecks(checks, tt.names, tt.plugin) {
+				got = append(got, check.Stater.Config().Name)
+			}
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
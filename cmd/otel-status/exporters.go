@@ -0,0 +1,202 @@
+/*******************************************************************************
+ * Copyright (c) 2023 Cedric L'homme.
+ *
+ * This file is part of otel-status.
+ *
+ * otel-status is free software: you can redistribute it and/or modify it
+ * under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License,
+ * or (at your option) any later version.
+ *
+ *  otel-status is distributed in the hope that it will be useful, but
+ *  WITHOUT ANY WARRANTY; without even the implied warranty of
+ *  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.
+ *  See the GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with otel-status. If not, see <https://www.gnu.org/licenses/>.
+ ******************************************************************************/
+
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	nethttp "net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"go.opentelemetry.io/otel/exporters/otlp/otlpmetric/otlpmetricgrpc"
+	"go.opentelemetry.io/otel/exporters/otlp/otlpmetric/otlpmetrichttp"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracegrpc"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	otelprometheus "go.opentelemetry.io/otel/exporters/prometheus"
+	"go.opentelemetry.io/otel/exporters/stdout/stdoutmetric"
+	"go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
+	"go.opentelemetry.io/otel/sdk/metric"
+	"go.opentelemetry.io/otel/sdk/trace"
+	"golang.org/x/exp/slog"
+)
+
+const (
+	protocolGRPC         = "grpc"
+	protocolHTTPProtobuf = "http/protobuf"
+
+	exporterOTLP       = "otlp"
+	exporterConsole    = "console"
+	exporterPrometheus = "prometheus"
+	exporterNone       = "none"
+
+	defaultPrometheusHost = "localhost"
+	defaultPrometheusPort = "9464"
+)
+
+// exporterNames returns the comma-separated exporters of the environment variable, otlp if not set.
+func exporterNames(env string) []string {
+	value := strings.TrimSpace(os.Getenv(env))
+	if value == "" {
+		return []string{exporterOTLP}
+	}
+	var names []string
+	for _, name := range strings.Split(value, ",") {
+		names = append(names, strings.TrimSpace(name))
+	}
+	return names
+}
+
+// otlpProtocol returns the OTLP protocol of the signal, TRACES or METRICS, grpc if not set.
+// OTEL_EXPORTER_OTLP_<signal>_PROTOCOL takes precedence over OTEL_EXPORTER_OTLP_PROTOCOL.
+func otlpProtocol(signal string) (string, error) {
+	protocol := os.Getenv("OTEL_EXPORTER_OTLP_" + signal + "_PROTOCOL")
+	if protocol == "" {
+		protocol = os.Getenv("OTEL_EXPORTER_OTLP_PROTOCOL")
+	}
+	switch protocol {
+	case "", protocolGRPC:
+		return protocolGRPC, nil
+	case protocolHTTPProtobuf:
+		return protocolHTTPProtobuf, nil
+	default:
+		return "", fmt.Errorf("unsupported OTLP protocol %q, use %s or %s", protocol, protocolGRPC, protocolHTTPProtobuf)
+	}
+}
+
+// spanExporters returns the span exporters of OTEL_TRACES_EXPORTER: otlp, console or none.
+func spanExporters(ctx context.Context) ([]trace.SpanExporter, error) {
+	var exporters []trace.SpanExporter
+	for _, name := range exporterNames("OTEL_TRACES_EXPORTER") {
+		switch name {
+		case exporterOTLP:
+			protocol, err := otlpProtocol("TRACES")
+			if err != nil {
+				return nil, err
+			}
+			client := otlptracegrpc.NewClient()
+			if protocol == protocolHTTPProtobuf {
+				client = otlptracehttp.NewClient()
+			}
+			exporter, err := otlptrace.New(ctx, client)
+			if err != nil {
+				return nil, err
+			}
+			exporters = append(exporters, exporter)
+		case exporterConsole:
+			exporter, err := stdouttrace.New(stdouttrace.WithPrettyPrint())
+			if err != nil {
+				return nil, err
+			}
+			exporters = append(exporters, exporter)
+		case exporterNone:
+		default:
+			return nil, fmt.Errorf("unknown traces exporter %q", name)
+		}
+	}
+	return exporters, nil
+}
+
+// metricReaders returns the metric readers of OTEL_METRICS_EXPORTER: otlp, console, prometheus or none,
+// and the servers of the prometheus readers, to shut down with the readers.
+func metricReaders(ctx context.Context) ([]metric.Reader, []*nethttp.Server, error) {
+	var readers []metric.Reader
+	var servers []*nethttp.Server
+	for _, name := range exporterNames("OTEL_METRICS_EXPORTER") {
+		switch name {
+		case exporterOTLP:
+			protocol, err := otlpProtocol("METRICS")
+			if err != nil {
+				return nil, nil, err
+			}
+			var exporter metric.Exporter
+			if protocol == protocolHTTPProtobuf {
+				exporter, err = otlpmetrichttp.New(ctx)
+			} else {
+				exporter, err = otlpmetricgrpc.New(ctx)
+			}
+			if err != nil {
+				return nil, nil, err
+			}
+			readers = append(readers, metric.NewPeriodicReader(exporter))
+		case exporterConsole:
+			exporter, err := stdoutmetric.New()
+			if err != nil {
+				return nil, nil, err
+			}
+			readers = append(readers, metric.NewPeriodicReader(exporter))
+		case exporterPrometheus:
+			reader, server, err := prometheusReader()
+			if err != nil {
+				return nil, nil, err
+			}
+			readers = append(readers, reader)
+			servers = append(servers, server)
+		case exporterNone:
+		default:
+			return nil, nil, fmt.Errorf("unknown metrics exporter %q", name)
+		}
+	}
+	return readers, servers, nil
+}
+
+// prometheusReader returns a reader exposing the metrics on /metrics,
+// on OTEL_EXPORTER_PROMETHEUS_HOST and OTEL_EXPORTER_PROMETHEUS_PORT, and its running server.
+func prometheusReader() (metric.Reader, *nethttp.Server, error) {
+	registry := prometheus.NewRegistry()
+	exporter, err := otelprometheus.New(otelprometheus.WithRegisterer(registry))
+	if err != nil {
+		return nil, nil, err
+	}
+
+	host := os.Getenv("OTEL_EXPORTER_PROMETHEUS_HOST")
+	if host == "" {
+		host = defaultPrometheusHost
+	}
+	port := os.Getenv("OTEL_EXPORTER_PROMETHEUS_PORT")
+	if port == "" {
+		port = defaultPrometheusPort
+	}
+	// Listen now to report an address already in use.
+	listener, err := net.Listen("tcp", net.JoinHostPort(host, port))
+	if err != nil {
+		return nil, nil, fmt.Errorf("listening for Prometheus: %w", err)
+	}
+
+	mux := nethttp.NewServeMux()
+	mux.Handle("/metrics", promhttp.HandlerFor(registry, promhttp.HandlerOpts{}))
+	server := &nethttp.Server{
+		Handler:           mux,
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+	go func() {
+		slog.Info("serving Prometheus metrics", "address", listener.Addr().String())
+		if err := server.Serve(listener); err != nil && !errors.Is(err, nethttp.ErrServerClosed) {
+			slog.Error("serving Prometheus metrics", err)
+		}
+	}()
+	return exporter, server, nil
+}
@@ -0,0 +1,114 @@
+/*******************************************************************************
+ * Copyright (c) 2023 Cedric L'homme.
+ *
+ * This file is part of otel-status.
+ *
+ * otel-status is free software: you can redistribute it and/or modify it
+ * under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License,
+ * or (at your option) any later version.
+ *
+ *  otel-status is distributed in the hope that it will be useful, but
+ *  WITHOUT ANY WARRANTY; without even the implied warranty of
+ *  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.
+ *  See the GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with otel-status. If not, see <https://www.gnu.org/licenses/>.
+ ******************************************************************************/
+
+package main
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestExporterNames(t *testing.T) {
+	tests := []struct {
+		name  string
+		value string
+		want  []string
+	}{
+		{name: "an unset variable, should return otlp", value: "", want: []string{exporterOTLP}},
+		{name: "blanks, should return otlp", value: "  ", want: []string{exporterOTLP}},
+		{name: "an exporter, should return it", value: "console", want: []string{exporterConsole}},
+		{name: "comma-separated exporters, should return them trimmed", value: "otlp, prometheus", want: []string{exporterOTLP, exporterPrometheus}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("OTEL_STATUS_TEST_EXPORTER", tt.value)
+			assert.Equal(t, tt.want, exporterNames("OTEL_STATUS_TEST_EXPORTER"))
+		})
+	}
+}
+
+func TestOTLPProtocol(t *testing.T) {
+	tests := []struct {
+		name     string
+		protocol string
+		signal   string
+		want     string
+		wantErr  bool
+	}{
+		{name: "no protocol, should return grpc", want: protocolGRPC},
+		{name: "a protocol, should return it", protocol: protocolHTTPProtobuf, want: protocolHTTPProtobuf},
+		{name: "a protocol of the signal, should take precedence", protocol: protocolGRPC, signal: protocolHTTPProtobuf, want: protocolHTTPProtobuf},
+		{name: "an unsupported protocol, should return an error", protocol: "http/json", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("OTEL_EXPORTER_OTLP_PROTOCOL", tt.protocol)
+			t.Setenv("OTEL_EXPORTER_OTLP_METRICS_PROTOCOL", tt.signal)
+
+			got, err := otlpProtocol("METRICS")
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestMetricReaders(t *testing.T) {
+	tests := []struct {
+		name        string
+		exporters   string
+		wantReaders int
+		wantServers int
+		wantErr     bool
+	}{
+		{name: "none, should return no reader", exporters: "none"},
+		{name: "console, should return a reader", exporters: "console", wantReaders: 1},
+		{name: "prometheus, should return a reader and its server", exporters: "prometheus", wantReaders: 1, wantServers: 1},
+		{name: "several exporters, should return their readers", exporters: "otlp,console", wantReaders: 2},
+		{name: "an unknown exporter, should return an error", exporters: "jaeger", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("OTEL_METRICS_EXPORTER", tt.exporters)
+			t.Setenv("OTEL_EXPORTER_PROMETHEUS_HOST", "127.0.0.1")
+			t.Setenv("OTEL_EXPORTER_PROMETHEUS_PORT", "0")
+
+			readers, servers, err := metricReaders(context.Background())
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Len(t, readers, tt.wantReaders)
+			assert.Len(t, servers, tt.wantServers)
+			for _, server := range servers {
+				assert.NoError(t, server.Shutdown(context.Background()))
+			}
+			for _, reader := range readers {
+				_ = reader.Shutdown(context.Background())
+			}
+		})
+	}
+}
@@ -22,21 +22,19 @@ package main
 
 import (
 	"context"
-	"flag"
+	"errors"
 	"fmt"
-	neturl "net/url"
+	nethttp "net/http"
 	"os"
+	"os/signal"
 	"strings"
+	"syscall"
 	"time"
 
 	"github.com/go-co-op/gocron"
-	"github.com/rangzen/otel-status/package/config"
+	"github.com/rangzen/otel-status/package/admin"
 	"github.com/rangzen/otel-status/package/status"
-	"github.com/rangzen/otel-status/package/status/http"
 	"go.opentelemetry.io/otel"
-	"go.opentelemetry.io/otel/exporters/otlp/otlpmetric/otlpmetricgrpc"
-	"go.opentelemetry.io/otel/exporters/otlp/otlptrace"
-	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracegrpc"
 	"go.opentelemetry.io/otel/metric/global"
 	"go.opentelemetry.io/otel/propagation"
 	"go.opentelemetry.io/otel/sdk/metric"
@@ -48,93 +46,231 @@ import (
 
 const (
 	instrumentName = "github.com/rangzen/otel-status"
+	// checksShutdownTimeout is the maximum time to wait for the in-flight checks on shutdown,
+	// they are canceled after it.
+	checksShutdownTimeout = 15 * time.Second
+	// flushShutdownTimeout is the maximum time to flush the traces and metrics on shutdown.
+	flushShutdownTimeout = 10 * time.Second
 )
 
+const usage = `Usage: otel-status [command] -config config.yaml [flags]
+
+Commands:
+  run       Run the checks on their schedule until SIGINT or SIGTERM (default).
+  validate  Validate the configuration file.
+  run-once  Run the checks a single time and print their results.
+  list      Print the checks with their next run time.
+
+Run otel-status <command> -h for the flags of a command.
+`
+
 func main() {
-	slog.Info("starting otel-status")
+	args := os.Args[1:]
+	command := "run"
+	if len(args) > 0 && !strings.HasPrefix(args[0], "-") {
+		command, args = args[0], args[1:]
+	}
 
-	// Load configuration file.
-	configPath := flag.String("config", "", "Path to the configuration file.")
-	flag.Parse()
+	switch command {
+	case "run":
+		os.Exit(run(args))
+	case "validate":
+		os.Exit(validate(args))
+	case "run-once":
+		os.Exit(runOnce(args))
+	case "list":
+		os.Exit(list(args))
+	case "help":
+		fmt.Print(usage)
+	default:
+		fmt.Fprintf(os.Stderr, "unknown command %q\n\n%s", command, usage)
+		os.Exit(2)
+	}
+}
 
-	if *configPath == "" {
-		slog.Error("You must provide a configuration file. Try -h for help.", nil)
-		os.Exit(1)
+// run runs the checks on their schedule until SIGINT or SIGTERM.
+func run(args []string) int {
+	flags := newFlagSet("run")
+	configPath := flags.String("config", "", "Path to the configuration file.")
+	adminAddr := flags.String("admin-addr", "", "Address of the admin HTTP server, e.g. :8080, disabled if empty.")
+	reloadInterval := flags.Duration("reload-interval", 10*time.Second,
+		"Interval to check the configuration file for changes, disabled if 0. SIGHUP always reloads it.")
+	spread := flags.Bool("spread", false, "Spread the first runs of the checks with the same @duration evenly across it.")
+	maxConcurrent := flags.Int("max-concurrent", 0, "Maximum number of checks running at the same time, unlimited if 0.")
+	if err := flags.Parse(args); err != nil {
+		return 2
 	}
 
-	slog.Info("loading configuration", "path", *configPath)
-	conf, err := config.FromFile(*configPath)
-	if err != nil {
-		slog.Error("loading configuration", err, "path", *configPath)
-		os.Exit(1)
+	slog.Info("starting otel-status")
+	conf, ok := loadConfig(*configPath)
+	if !ok {
+		return 1
 	}
 
 	// Prepare connection to Open Telemetry Traces.
-	if err = initTracer(); err != nil {
+	tracerProvider, err := initTracer()
+	if err != nil {
 		slog.Error("initializing tracer", err)
-		os.Exit(1)
+		return 1
 	}
 
 	// Prepare connection to Open Telemetry Metrics.
-	if err = initMeter(); err != nil {
+	meterProvider, metricsServers, err := initMeter()
+	if err != nil {
 		slog.Error("initializing meter", err)
-		os.Exit(1)
+		return 1
 	}
 
-	// Print all OTEL_ environment variables.
+	// Print all OTEL_ environment variables, without the values of the headers which often contain tokens.
 	for _, e := range os.Environ() {
 		if strings.HasPrefix(e, "OTEL_") {
 			split := strings.SplitN(e, "=", 2)
-			slog.Info("Open Telemetry environment variable", "name", split[0], "value", split[1])
+			value := split[1]
+			if strings.HasSuffix(split[0], "_HEADERS") {
+				value = redactHeaders(value)
+			}
+			slog.Info("Open Telemetry environment variable", "name", split[0], "value", value)
 		}
 	}
 
+	// Checks are canceled if they are still running after checksShutdownTimeout on shutdown.
+	checksCtx, cancelChecks := context.WithCancel(context.Background())
+	defer cancelChecks()
+
 	// Cron all status on local time zone.
 	var tracer = otel.Tracer(instrumentName)
 	var meter = global.MeterProvider().Meter(instrumentName)
 	scheduler := gocron.NewScheduler(time.Local)
-	for _, s := range conf.States.HTTP {
-		// Parse the URL.
-		url, err := neturl.Parse(s.URL)
-		if err != nil {
-			slog.Error("parsing URL", err, "url", s.URL)
-			continue
-		}
+	checksLimiter := newLimiter(*maxConcurrent, meter)
 
-		stater := http.HTTP{
-			SC: status.Config{
-				Name:        s.Name,
-				Description: s.Description,
-				Cron:        s.Cron,
-			},
-			Method: s.Method,
-			URL:    url,
-			Values: s.Values,
-		}
-		slog.Info("scheduling", "plugin", http.PluginName, "name", stater.Config().Name, "cron", stater.Config().Cron)
-		if stater.Config().IsDuration() {
-			_, err = scheduler.Every(stater.Config().CronDuration()).Do(stater.State, tracer, meter)
-		} else {
-			_, err = scheduler.Cron(stater.Config().CronExp()).Do(stater.State, tracer, meter)
-		}
-		if err != nil {
-			slog.Error("scheduling", err, "plugin", http.PluginName, "name", stater.Config().Name)
-			os.Exit(1)
+	var adminServer *admin.Server
+	var httpServer *nethttp.Server
+	if *adminAddr != "" {
+		adminServer = admin.NewServer(func(ctx context.Context, check *status.Check) (status.Result, error) {
+			return checksLimiter.run(ctx, check, tracer, meter)
+		})
+		httpServer = &nethttp.Server{
+			Addr:              *adminAddr,
+			Handler:           adminServer.Handler(),
+			ReadHeaderTimeout: 10 * time.Second,
 		}
+		go func() {
+			slog.Info("starting admin server", "address", *adminAddr)
+			if err := httpServer.ListenAndServe(); err != nil && !errors.Is(err, nethttp.ErrServerClosed) {
+				slog.Error("serving admin server", err, "address", *adminAddr)
+			}
+		}()
+	}
+
+	r := newRunner(checksCtx, scheduler, tracer, meter, adminServer, checksLimiter, *spread)
+	if _, err = r.apply(conf); err != nil {
+		slog.Error("scheduling", err)
+		return 1
 	}
 	slog.Info("scheduled", "count", scheduler.Len())
-	scheduler.StartBlocking()
+	scheduler.StartAsync()
+	if adminServer != nil {
+		adminServer.SetReady(true)
+	}
+
+	// Reload the configuration until a termination signal.
+	signalCtx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	r.watch(signalCtx, *configPath, *reloadInterval)
+	stop()
+	return shutdown(scheduler, cancelChecks, adminServer, httpServer, metricsServers, tracerProvider, meterProvider)
+}
+
+// shutdown stops the scheduler and waits for the in-flight checks, then stops the admin and metrics servers,
+// and flushes the traces and metrics last, so that the ones of the last checks are exported.
+// The admin server and its HTTP server are nil if disabled.
+// It returns the exit code of run, 1 if the flush fails.
+func shutdown(scheduler *gocron.Scheduler, cancelChecks context.CancelFunc, adminServer *admin.Server, httpServer *nethttp.Server,
+	metricsServers []*nethttp.Server, tracerProvider *trace.TracerProvider, meterProvider *metric.MeterProvider) int {
+	slog.Info("shutting down")
+	if adminServer != nil {
+		adminServer.SetReady(false)
+	}
+	stopScheduler(scheduler, cancelChecks)
+	if httpServer != nil {
+		stopServer(httpServer, "admin")
+	}
+	for _, server := range metricsServers {
+		stopServer(server, "metrics")
+	}
+	if err := shutdownProviders(tracerProvider, meterProvider); err != nil {
+		slog.Error("flushing traces and metrics", err)
+		return 1
+	}
+	slog.Info("stopped")
+	return 0
+}
+
+// redactHeaders returns the key=value list of headers of an OTEL_*_HEADERS variable with redacted values.
+func redactHeaders(headers string) string {
+	pairs := strings.Split(headers, ",")
+	for i, pair := range pairs {
+		key, _, _ := strings.Cut(pair, "=")
+		pairs[i] = key + "=" + status.Redacted
+	}
+	return strings.Join(pairs, ",")
+}
+
+// stopScheduler stops the scheduler and waits for the in-flight checks.
+// The checks still running after checksShutdownTimeout are canceled.
+func stopScheduler(scheduler *gocron.Scheduler, cancelChecks context.CancelFunc) {
+	stopped := make(chan struct{})
+	go func() {
+		// Stop waits for the running jobs.
+		scheduler.Stop()
+		close(stopped)
+	}()
+	select {
+	case <-stopped:
+	case <-time.After(checksShutdownTimeout):
+		slog.Warn("canceling in-flight checks", "timeout", checksShutdownTimeout)
+		cancelChecks()
+		<-stopped
+	}
+}
+
+// stopServer stops the admin or metrics server within checksShutdownTimeout.
+func stopServer(server *nethttp.Server, name string) {
+	ctx, cancel := context.WithTimeout(context.Background(), checksShutdownTimeout)
+	defer cancel()
+	if err := server.Shutdown(ctx); err != nil {
+		slog.Error("stopping "+name+" server", err)
+	}
+}
+
+// shutdownProviders flushes and stops the providers within flushShutdownTimeout.
+func shutdownProviders(tracerProvider *trace.TracerProvider, meterProvider *metric.MeterProvider) error {
+	ctx, cancel := context.WithTimeout(context.Background(), flushShutdownTimeout)
+	defer cancel()
+
+	tracerErr := tracerProvider.Shutdown(ctx)
+	if tracerErr != nil {
+		tracerErr = fmt.Errorf("shutting down tracer provider: %w", tracerErr)
+	}
+	meterErr := meterProvider.Shutdown(ctx)
+	if meterErr != nil {
+		meterErr = fmt.Errorf("shutting down meter provider: %w", meterErr)
+	}
+	switch {
+	case tracerErr != nil && meterErr != nil:
+		return fmt.Errorf("%v; %w", tracerErr, meterErr)
+	case tracerErr != nil:
+		return tracerErr
+	default:
+		return meterErr
+	}
 }
 
 // initTracer prepares connection to Open Telemetry Traces.
-// All the configuration is done via environment variables.
-func initTracer() error {
-	exporter, err := otlptrace.New(
-		context.Background(),
-		otlptracegrpc.NewClient(),
-	)
+// All the configuration is done via environment variables, see spanExporters.
+func initTracer() (*trace.TracerProvider, error) {
+	exporters, err := spanExporters(context.Background())
 	if err != nil {
-		return fmt.Errorf("creating Open Telemetry traces exporter: %w", err)
+		return nil, fmt.Errorf("creating Open Telemetry traces exporter: %w", err)
 	}
 
 	resources, err := resource.New(
@@ -145,28 +281,28 @@ func initTracer() error {
 		),
 	)
 	if err != nil {
-		return fmt.Errorf("creating Open Telemetry traces resources: %w", err)
+		return nil, fmt.Errorf("creating Open Telemetry traces resources: %w", err)
 	}
 
-	tracerProvider := trace.NewTracerProvider(
-		trace.WithSpanProcessor(trace.NewBatchSpanProcessor(exporter)),
-		trace.WithResource(resources),
-	)
+	options := []trace.TracerProviderOption{trace.WithResource(resources)}
+	for _, exporter := range exporters {
+		options = append(options, trace.WithSpanProcessor(trace.NewBatchSpanProcessor(exporter)))
+	}
+	tracerProvider := trace.NewTracerProvider(options...)
 
 	otel.SetTracerProvider(tracerProvider)
 	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(propagation.TraceContext{}, propagation.Baggage{}))
 
-	return nil
+	return tracerProvider, nil
 }
 
 // initMeter prepares connection to Open Telemetry Metrics.
-// All the configuration is done via environment variables.
-func initMeter() error {
-	exporter, err := otlpmetricgrpc.New(
-		context.Background(),
-	)
+// All the configuration is done via environment variables, see metricReaders.
+// It returns the servers of the metrics too, to stop on shutdown.
+func initMeter() (*metric.MeterProvider, []*nethttp.Server, error) {
+	readers, servers, err := metricReaders(context.Background())
 	if err != nil {
-		return fmt.Errorf("creating Open Telemetry metrics exporter: %w", err)
+		return nil, nil, fmt.Errorf("creating Open Telemetry metrics exporter: %w", err)
 	}
 
 	resources, err := resource.New(
@@ -177,15 +313,16 @@ func initMeter() error {
 		),
 	)
 	if err != nil {
-		return fmt.Errorf("creating Open Telemetry metrics resources: %w", err)
+		return nil, nil, fmt.Errorf("creating Open Telemetry metrics resources: %w", err)
 	}
 
-	meterProvider := metric.NewMeterProvider(
-		metric.WithReader(metric.NewPeriodicReader(exporter)),
-		metric.WithResource(resources),
-	)
+	options := []metric.Option{metric.WithResource(resources)}
+	for _, reader := range readers {
+		options = append(options, metric.WithReader(reader))
+	}
+	meterProvider := metric.NewMeterProvider(options...)
 
 	global.SetMeterProvider(meterProvider)
 
-	return nil
+	return meterProvider, servers, nil
 }
@@ -0,0 +1,159 @@
+/*******************************************************************************
+ * Copyright (c) 2023 Cedric L'homme.
+ *
+ * This file is part of otel-status.
+ *
+ * otel-status is free software: you can redistribute it and/or modify it
+ * under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License,
+ * or (at your option) any later version.
+ *
+ *  otel-status is distributed in the hope that it will be useful, but
+ *  WITHOUT ANY WARRANTY; without even the implied warranty of
+ *  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.
+ *  See the GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with otel-status. If not, see <https://www.gnu.org/licenses/>.
+ ******************************************************************************/
+
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	nethttp "net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/go-co-op/gocron"
+	"github.com/rangzen/otel-status/package/admin"
+	"github.com/rangzen/otel-status/package/status"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel/sdk/metric"
+	"go.opentelemetry.io/otel/sdk/trace"
+)
+
+// events records the steps of a shutdown in their order.
+type events struct {
+	mu   sync.Mutex
+	list []string
+}
+
+func (e *events) add(event string) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.list = append(e.list, event)
+}
+
+// flushExporter calls flushed on its shutdown, the flush of the traces, and fails it with err.
+type flushExporter struct {
+	flushed func()
+	err     error
+}
+
+func (f flushExporter) ExportSpans(context.Context, []trace.ReadOnlySpan) error {
+	return nil
+}
+
+func (f flushExporter) Shutdown(context.Context) error {
+	f.flushed()
+	return f.err
+}
+
+// serve serves the handler on a local address until the server is shut down.
+func serve(t *testing.T, handler nethttp.Handler) (*nethttp.Server, string) {
+	t.Helper()
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	server := &nethttp.Server{Handler: handler, ReadHeaderTimeout: time.Second}
+	go func() { _ = server.Serve(listener) }()
+	t.Cleanup(func() { _ = server.Close() })
+	return server, listener.Addr().String()
+}
+
+// serving returns whether the server at the address answers.
+func serving(address string) bool {
+	client := &nethttp.Client{Transport: &nethttp.Transport{DisableKeepAlives: true}, Timeout: time.Second}
+	res, err := client.Get("http://" + address + "/healthz")
+	if err != nil {
+		return false
+	}
+	res.Body.Close()
+	return true
+}
+
+func TestShutdown(t *testing.T) {
+	tests := []struct {
+		name     string
+		flushErr error
+		want     int
+	}{
+		{name: "a successful flush, should stop the checks, then the servers and flush last", want: 0},
+		{name: "a failed flush, should return 1", flushErr: errors.New("collector unavailable"), want: 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var ev events
+			adminServer := admin.NewServer(nil)
+			adminServer.SetReady(true)
+			httpServer, adminAddress := serve(t, adminServer.Handler())
+			metricsServer, metricsAddress := serve(t, nethttp.NotFoundHandler())
+
+			// The in-flight check ends after the shutdown starts.
+			scheduler := gocron.NewScheduler(time.UTC)
+			started := make(chan struct{})
+			_, err := scheduler.Every(time.Hour).Do(func() {
+				close(started)
+				time.Sleep(50 * time.Millisecond)
+				ev.add(fmt.Sprintf("check done, admin serving %t", serving(adminAddress)))
+			})
+			require.NoError(t, err)
+			scheduler.StartAsync()
+			<-started
+
+			tracerProvider := trace.NewTracerProvider(trace.WithSyncer(flushExporter{
+				flushed: func() {
+					ev.add(fmt.Sprintf("flush, admin serving %t, metrics serving %t", serving(adminAddress), serving(metricsAddress)))
+				},
+				err: tt.flushErr,
+			}))
+
+			code := shutdown(scheduler, func() {}, adminServer, httpServer, []*nethttp.Server{metricsServer},
+				tracerProvider, metric.NewMeterProvider())
+			assert.Equal(t, tt.want, code)
+			assert.Equal(t, []string{
+				"check done, admin serving true",
+				"flush, admin serving false, metrics serving false",
+			}, ev.list)
+
+			rec := httptest.NewRecorder()
+			adminServer.Handler().ServeHTTP(rec, httptest.NewRequest(nethttp.MethodGet, "/readyz", nil))
+			assert.Equal(t, nethttp.StatusServiceUnavailable, rec.Code)
+		})
+	}
+}
+
+func TestRedactHeaders(t *testing.T) {
+	tests := []struct {
+		name    string
+		headers string
+		want    string
+	}{
+		{name: "a header, should redact its value", headers: "Authorization=Bearer s3cr3t", want: "Authorization=" + status.Redacted},
+		{name: "several headers, should redact all their values", headers: "api-key=s3cr3t,tenant=acme",
+			want: "api-key=" + status.Redacted + ",tenant=" + status.Redacted},
+		{name: "a value with an equal sign, should redact all of it", headers: "token=a=b", want: "token=" + status.Redacted},
+		{name: "a header without value, should keep its key", headers: "flag", want: "flag=" + status.Redacted},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, redactHeaders(tt.headers))
+		})
+	}
+}
@@ -0,0 +1,271 @@
+/*******************************************************************************
+ * Copyright (c) 2023 Cedric L'homme.
+ *
+ * This file is part of otel-status.
+ *
+ * otel-status is free software: you can redistribute it and/or modify it
+ * under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License,
+ * or (at your option) any later version.
+ *
+ *  otel-status is distributed in the hope that it will be useful, but
+ *  WITHOUT ANY WARRANTY; without even the implied warranty of
+ *  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.
+ *  See the GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with otel-status. If not, see <https://www.gnu.org/licenses/>.
+ ******************************************************************************/
+
+package main
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/go-co-op/gocron"
+	"github.com/rangzen/otel-status/package/admin"
+	"github.com/rangzen/otel-status/package/config"
+	"github.com/rangzen/otel-status/package/status"
+	"go.opentelemetry.io/otel/attribute"
+	apimetric "go.opentelemetry.io/otel/metric"
+	"go.opentelemetry.io/otel/metric/instrument"
+	"go.opentelemetry.io/otel/metric/unit"
+	apitrace "go.opentelemetry.io/otel/trace"
+	"golang.org/x/exp/slog"
+)
+
+const (
+	otelStatusConfigReload       = "otelstatus.config.reload"
+	otelStatusConfigReloadResult = "result"
+)
+
+// runner schedules the checks of a configuration and applies the changes of the next ones.
+// It is not safe for concurrent use.
+type runner struct {
+	scheduler *gocron.Scheduler
+	// ctx is the context of the scheduled checks.
+	ctx    context.Context
+	tracer apitrace.Tracer
+	meter  apimetric.Meter
+	// admin is updated with the scheduled checks, if not nil.
+	admin *admin.Server
+	// limiter limits the checks running at the same time.
+	limiter *limiter
+	// spread spreads the first runs of the checks across their interval, see spreadOffsets.
+	spread bool
+
+	conf   config.Config
+	checks map[string]scheduledCheck
+	// reloads counts the reloads of the configuration, see recordMetricReload.
+	reloads status.Instruments[instrument.Int64Counter]
+}
+
+// scheduledCheck is a check with its job in the scheduler.
+type scheduledCheck struct {
+	check *status.Check
+	job   *gocron.Job
+}
+
+// newRunner returns a runner without checks.
+func newRunner(ctx context.Context, scheduler *gocron.Scheduler, tracer apitrace.Tracer, meter apimetric.Meter,
+	adminServer *admin.Server, limiter *limiter, spread bool) *runner {
+	return &runner{
+		scheduler: scheduler,
+		ctx:       ctx,
+		tracer:    tracer,
+		meter:     meter,
+		admin:     adminServer,
+		limiter:   limiter,
+		spread:    spread,
+		checks:    map[string]scheduledCheck{},
+	}
+}
+
+// apply schedules the checks of the configuration.
+// The removed and changed checks are unscheduled, the unchanged ones keep their job and their state.
+// On error, the running configuration is kept.
+func (r *runner) apply(conf config.Config) (config.Changes, error) {
+	staters, err := conf.Staters()
+	if err != nil {
+		return config.Changes{}, err
+	}
+	changes := conf.Changes(r.conf)
+	changed := make(map[string]bool, len(changes.Changed))
+	for _, name := range changes.Changed {
+		changed[name] = true
+	}
+	var offsets map[string]time.Duration
+	if r.spread {
+		offsets = spreadOffsets(staters)
+	}
+
+	// The added and changed checks are scheduled before the others are unscheduled,
+	// so that a failure leaves the running configuration as it is.
+	added := map[string]scheduledCheck{}
+	for i, stater := range staters {
+		name := stater.Config().Name
+		if _, ok := r.checks[name]; ok && !changed[name] {
+			// Unchanged check, the new stater is not used.
+			if closer, ok := stater.(io.Closer); ok {
+				_ = closer.Close()
+			}
+			continue
+		}
+		check := status.NewCheck(stater)
+		slog.Info("scheduling", "name", name, "cron", stater.Config().Cron)
+		jobs, err := schedule(r.scheduler, []*status.Check{check}, offsets, r.runState)
+		if err != nil {
+			for _, scheduled := range added {
+				r.scheduler.RemoveByReference(scheduled.job)
+				_ = scheduled.check.Close()
+			}
+			for _, stater := range staters[i:] {
+				if closer, ok := stater.(io.Closer); ok {
+					_ = closer.Close()
+				}
+			}
+			return config.Changes{}, err
+		}
+		added[name] = scheduledCheck{check: check, job: jobs[0]}
+	}
+
+	for _, name := range changes.Removed {
+		r.unschedule(name)
+	}
+	for _, name := range changes.Changed {
+		r.unschedule(name)
+	}
+	for name, scheduled := range added {
+		r.checks[name] = scheduled
+	}
+	adminChecks := make([]admin.Check, 0, len(staters))
+	for _, stater := range staters {
+		scheduled := r.checks[stater.Config().Name]
+		adminChecks = append(adminChecks, admin.Check{Check: scheduled.check, NextRun: scheduled.job.NextRun})
+	}
+	r.conf = conf
+
+	if r.admin != nil {
+		r.admin.SetChecks(adminChecks)
+	}
+	return changes, nil
+}
+
+// unschedule removes the check from the scheduler and stops reporting its metrics once its running run ends.
+func (r *runner) unschedule(name string) {
+	scheduled, ok := r.checks[name]
+	if !ok {
+		return
+	}
+	slog.Info("unscheduling", "name", name)
+	r.scheduler.RemoveByReference(scheduled.job)
+	// Close waits for a running run of the check, the reload must not.
+	go func(check *status.Check) {
+		if err := check.Close(); err != nil {
+			slog.Error("closing check", err, "name", name)
+		}
+	}(scheduled.check)
+	delete(r.checks, name)
+}
+
+// runState runs the check with the context, tracer and meter of the runner,
+// after its random jitter and once the limiter has a free slot.
+// The check is canceled if it is still running after its timeout or when the context is done.
+func (r *runner) runState(check *status.Check) {
+	if d := jitter(check.Stater.Config().Jitter); d > 0 {
+		timer := time.NewTimer(d)
+		defer timer.Stop()
+		select {
+		case <-timer.C:
+		case <-r.ctx.Done():
+			return
+		}
+	}
+	// Errors are already logged and recorded by the stater.
+	_, _ = r.limiter.run(r.ctx, check, r.tracer, r.meter)
+}
+
+// reload loads the configuration file and applies it.
+// On failure, the running configuration is kept.
+func (r *runner) reload(path string) {
+	slog.Info("reloading configuration", "path", path)
+	conf, ok := loadConfig(path)
+	if !ok {
+		r.recordMetricReload(false)
+		return
+	}
+	changes, err := r.apply(conf)
+	if err != nil {
+		slog.Error("reloading configuration", err, "path", path)
+		r.recordMetricReload(false)
+		return
+	}
+	// The secrets of the previous configuration are not redacted anymore.
+	status.SetSecrets(conf.Secrets())
+	slog.Info("reloaded configuration", "path", path,
+		"added", changes.Added, "removed", changes.Removed, "changed", changes.Changed)
+	r.recordMetricReload(true)
+}
+
+// watch reloads the configuration on SIGHUP, and when the content of the file changes
+// if interval is not zero. It returns when ctx is done.
+func (r *runner) watch(ctx context.Context, path string, interval time.Duration) {
+	hangup := make(chan os.Signal, 1)
+	signal.Notify(hangup, syscall.SIGHUP)
+	defer signal.Stop(hangup)
+
+	var tick <-chan time.Time
+	if interval > 0 {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		tick = ticker.C
+	}
+
+	last, _ := os.ReadFile(path)
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-hangup:
+			last, _ = os.ReadFile(path)
+			r.reload(path)
+		case <-tick:
+			content, err := os.ReadFile(path)
+			if err != nil {
+				slog.Error("watching configuration", err, "path", path)
+				continue
+			}
+			if bytes.Equal(content, last) {
+				continue
+			}
+			last = content
+			r.reload(path)
+		}
+	}
+}
+
+// recordMetricReload records the result of a reload of the configuration.
+func (r *runner) recordMetricReload(success bool) {
+	reloadMetric, err := r.reloads.Get(r.meter, func(meter apimetric.Meter) (instrument.Int64Counter, error) {
+		return meter.Int64Counter(
+			otelStatusConfigReload,
+			instrument.WithUnit(unit.Dimensionless),
+			instrument.WithDescription("Reloads of the configuration"),
+		)
+	})
+	if err != nil {
+		slog.Error("creating configuration reload metric", err)
+		return
+	}
+	result := "success"
+	if !success {
+		result = "failure"
+	}
+	reloadMetric.Add(context.Background(), 1, attribute.String(otelStatusConfigReloadResult, result))
+}
@@ -0,0 +1,189 @@
+/*******************************************************************************
+ * Copyright (c) 2023 Cedric L'homme.
+ *
+ * This file is part of otel-status.
+ *
+ * otel-status is free software: you can redistribute it and/or modify it
+ * under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License,
+ * or (at your option) any later version.
+ *
+ *  otel-status is distributed in the hope that it will be useful, but
+ *  WITHOUT ANY WARRANTY; without even the implied warranty of
+ *  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.
+ *  See the GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with otel-status. If not, see <https://www.gnu.org/licenses/>.
+ ******************************************************************************/
+
+package main
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/go-co-op/gocron"
+	"github.com/rangzen/otel-status/package/config"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel/sdk/metric"
+	"go.opentelemetry.io/otel/sdk/metric/metricdata"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const (
+	reloadConfig = `
+states:
+  exec:
+    - name: Batch
+      cron: "@1h"
+      command: "true"
+    - name: Backup
+      cron: "@1h"
+      command: "true"
+`
+	reloadedConfig = `
+states:
+  exec:
+    - name: Batch
+      cron: "@2h"
+      command: "true"
+    - name: Report
+      cron: "@1h"
+      command: "true"
+`
+)
+
+// newTestRunner returns a runner with a scheduler that is not started, and the reader of its metrics.
+func newTestRunner(t *testing.T) (*runner, metric.Reader) {
+	t.Helper()
+	rdr := metric.NewManualReader()
+	meter := metric.NewMeterProvider(metric.WithReader(rdr)).Meter("test-meter")
+	scheduler := gocron.NewScheduler(time.UTC)
+	t.Cleanup(scheduler.Clear)
+	r := newRunner(context.Background(), scheduler, trace.NewNoopTracerProvider().Tracer("test-tracer"), meter,
+		nil, newLimiter(0, meter), false)
+	return r, rdr
+}
+
+// reloadResults returns the count of the reloads by result.
+func reloadResults(t *testing.T, rdr metric.Reader) map[string]int64 {
+	t.Helper()
+	m, err := rdr.Collect(context.Background())
+	require.NoError(t, err)
+	results := map[string]int64{}
+	for _, sm := range m.ScopeMetrics {
+		for _, mm := range sm.Metrics {
+			if mm.Name != otelStatusConfigReload {
+				continue
+			}
+			for _, dp := range mm.Data.(metricdata.Sum[int64]).DataPoints {
+				result, _ := dp.Attributes.Value(otelStatusConfigReloadResult)
+				results[result.AsString()] = dp.Value
+			}
+		}
+	}
+	return results
+}
+
+func TestRunner_Apply(t *testing.T) {
+	r, _ := newTestRunner(t)
+	conf, err := config.FromBytes([]byte(reloadConfig))
+	require.NoError(t, err)
+
+	changes, err := r.apply(conf)
+	require.NoError(t, err)
+	assert.ElementsMatch(t, []string{"Batch", "Backup"}, changes.Added)
+	assert.Equal(t, 2, r.scheduler.Len())
+	batch := r.checks["Batch"].check
+
+	t.Run("the same configuration, should keep the checks", func(t *testing.T) {
+		changes, err := r.apply(conf)
+		require.NoError(t, err)
+		assert.True(t, changes.IsEmpty())
+		assert.Equal(t, 2, r.scheduler.Len())
+		assert.Same(t, batch, r.checks["Batch"].check)
+	})
+
+	t.Run("an added, a removed and a changed check, should reschedule only them", func(t *testing.T) {
+		reloaded, err := config.FromBytes([]byte(reloadedConfig))
+		require.NoError(t, err)
+
+		changes, err := r.apply(reloaded)
+		require.NoError(t, err)
+		assert.Equal(t, []string{"Report"}, changes.Added)
+		assert.Equal(t, []string{"Backup"}, changes.Removed)
+		assert.Equal(t, []string{"Batch"}, changes.Changed)
+
+		assert.Equal(t, 2, r.scheduler.Len())
+		require.Len(t, r.checks, 2)
+		assert.Contains(t, r.checks, "Report")
+		assert.NotContains(t, r.checks, "Backup")
+		assert.NotSame(t, batch, r.checks["Batch"].check)
+		assert.Equal(t, "@2h", r.checks["Batch"].check.Stater.Config().Cron)
+	})
+}
+
+func TestRunner_Reload(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	require.NoError(t, os.WriteFile(path, []byte(reloadConfig), 0o600))
+	r, rdr := newTestRunner(t)
+	conf, ok := loadConfig(path)
+	require.True(t, ok)
+	_, err := r.apply(conf)
+	require.NoError(t, err)
+
+	t.Run("an invalid file, should keep the running configuration", func(t *testing.T) {
+		require.NoError(t, os.WriteFile(path, []byte("states:\n  exec:\n    - name: Batch\n      cron: nope\n"), 0o600))
+
+		r.reload(path)
+		assert.Equal(t, 2, r.scheduler.Len())
+		assert.Contains(t, r.checks, "Backup")
+		assert.Equal(t, map[string]int64{"failure": 1}, reloadResults(t, rdr))
+	})
+
+	t.Run("a valid file, should apply it", func(t *testing.T) {
+		require.NoError(t, os.WriteFile(path, []byte(reloadedConfig), 0o600))
+
+		r.reload(path)
+		assert.Equal(t, 2, r.scheduler.Len())
+		assert.Contains(t, r.checks, "Report")
+		assert.NotContains(t, r.checks, "Backup")
+		assert.Equal(t, map[string]int64{"failure": 1, "success": 1}, reloadResults(t, rdr))
+	})
+}
+
+func TestRunner_Watch(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	require.NoError(t, os.WriteFile(path, []byte(reloadConfig), 0o600))
+	r, rdr := newTestRunner(t)
+	conf, ok := loadConfig(path)
+	require.True(t, ok)
+	_, err := r.apply(conf)
+	require.NoError(t, err)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		r.watch(ctx, path, 10*time.Millisecond)
+		close(done)
+	}()
+
+	// The file is read once by watch before it is changed, an unchanged file is not reloaded.
+	time.Sleep(50 * time.Millisecond)
+	assert.Empty(t, reloadResults(t, rdr))
+	require.NoError(t, os.WriteFile(path, []byte(reloadedConfig), 0o600))
+	assert.Eventually(t, func() bool {
+		return reloadResults(t, rdr)["success"] == 1
+	}, 5*time.Second, 10*time.Millisecond)
+
+	cancel()
+	<-done
+	assert.Contains(t, r.checks, "Report")
+	assert.NotContains(t, r.checks, "Backup")
+	assert.Equal(t, map[string]int64{"success": 1}, reloadResults(t, rdr))
+}
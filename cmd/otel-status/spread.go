@@ -0,0 +1,130 @@
+/*******************************************************************************
+ * Copyright (c) 2023 Cedric L'homme.
+ *
+ * This file is part of otel-status.
+ *
+ * otel-status is free software: you can redistribute it and/or modify it
+ * under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License,
+ * or (at your option) any later version.
+ *
+ *  otel-status is distributed in the hope that it will be useful, but
+ *  WITHOUT ANY WARRANTY; without even the implied warranty of
+ *  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.
+ *  See the GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with otel-status. If not, see <https://www.gnu.org/licenses/>.
+ ******************************************************************************/
+
+package main
+
+import (
+	"context"
+	"math/rand"
+	"sync"
+	"time"
+
+	"github.com/rangzen/otel-status/package/status"
+	"go.opentelemetry.io/otel/attribute"
+	apimetric "go.opentelemetry.io/otel/metric"
+	"go.opentelemetry.io/otel/metric/instrument"
+	"go.opentelemetry.io/otel/metric/unit"
+	apitrace "go.opentelemetry.io/otel/trace"
+	"golang.org/x/exp/slog"
+)
+
+const otelStatusQueueWait = "otelstatus.queue.wait"
+
+// spreadOffsets returns the delay of the first run of the checks with a duration as cron,
+// spreading evenly the checks with the same duration across it.
+// The checks with a cron expression have no offset.
+func spreadOffsets(staters []status.Stater) map[string]time.Duration {
+	groups := map[string][]string{}
+	var durations []string
+	for _, stater := range staters {
+		c := stater.Config()
+		if !c.IsDuration() {
+			continue
+		}
+		if _, ok := groups[c.CronDuration()]; !ok {
+			durations = append(durations, c.CronDuration())
+		}
+		groups[c.CronDuration()] = append(groups[c.CronDuration()], c.Name)
+	}
+
+	offsets := map[string]time.Duration{}
+	for _, duration := range durations {
+		// The cron is validated with the configuration.
+		interval, _ := time.ParseDuration(duration)
+		names := groups[duration]
+		for i, name := range names {
+			offsets[name] = interval * time.Duration(i) / time.Duration(len(names))
+		}
+	}
+	return offsets
+}
+
+var (
+	jitterMu   sync.Mutex
+	jitterRand = rand.New(rand.NewSource(time.Now().UnixNano()))
+)
+
+// jitter returns a random duration in [0, max).
+func jitter(max time.Duration) time.Duration {
+	if max <= 0 {
+		return 0
+	}
+	jitterMu.Lock()
+	defer jitterMu.Unlock()
+	return time.Duration(jitterRand.Int63n(int64(max)))
+}
+
+// limiter limits the number of checks running at the same time.
+type limiter struct {
+	// slots is nil without limit.
+	slots chan struct{}
+	// wait is nil if it cannot be created.
+	wait instrument.Int64Histogram
+}
+
+// newLimiter returns a limiter of max checks running at the same time, without limit if max is 0.
+func newLimiter(max int, meter apimetric.Meter) *limiter {
+	l := &limiter{}
+	if max <= 0 {
+		return l
+	}
+	l.slots = make(chan struct{}, max)
+	wait, err := meter.Int64Histogram(
+		otelStatusQueueWait,
+		instrument.WithUnit(unit.Milliseconds),
+		instrument.WithDescription("Wait of the checks for a free slot before running"),
+	)
+	if err != nil {
+		slog.Error("creating queue wait metric", err)
+		return l
+	}
+	l.wait = wait
+	return l
+}
+
+// run runs the check once fewer than max checks are running.
+// The wait is recorded in the otelstatus.queue.wait histogram.
+func (l *limiter) run(ctx context.Context, check *status.Check, tracer apitrace.Tracer, meter apimetric.Meter) (status.Result, error) {
+	if l.slots != nil {
+		start := time.Now()
+		select {
+		case l.slots <- struct{}{}:
+		case <-ctx.Done():
+			return status.Result{}, ctx.Err()
+		}
+		defer func() { <-l.slots }()
+		if l.wait != nil {
+			l.wait.Record(context.Background(), time.Since(start).Milliseconds(),
+				attribute.String(status.OtelStatusName, check.Stater.Config().Name),
+				attribute.String(status.OtelStatusPluginName, check.Stater.Plugin()),
+			)
+		}
+	}
+	return check.Run(ctx, tracer, meter)
+}
@@ -0,0 +1,201 @@
+/*******************************************************************************
+ * Copyright (c) 2023 Cedric L'homme.
+ *
+ * This file is part of otel-status.
+ *
+ * otel-status is free software: you can redistribute it and/or modify it
+ * under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License,
+ * or (at your option) any later version.
+ *
+ *  otel-status is distributed in the hope that it will be useful, but
+ *  WITHOUT ANY WARRANTY; without even the implied warranty of
+ *  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.
+ *  See the GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with otel-status. If not, see <https://www.gnu.org/licenses/>.
+ ******************************************************************************/
+
+package main
+
+import (
+	"context"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/rangzen/otel-status/package/status"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel/metric"
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+	"go.opentelemetry.io/otel/sdk/metric/metricdata"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// fakeStater is up, after its delay if any.
+type fakeStater struct {
+	name   string
+	plugin string
+	cron   string
+	delay  time.Duration
+	// running is the number of runs in progress, if not nil.
+	running *int32
+	// maxRunning is the maximum of running, if not nil.
+	maxRunning *int32
+}
+
+func (f fakeStater) Config() status.Config {
+	return status.Config{Name: f.name, Cron: f.cron}
+}
+
+func (f fakeStater) Plugin() string {
+	return f.plugin
+}
+
+func (f fakeStater) State(context.Context, trace.Tracer, metric.Meter) (status.Result, error) {
+	if f.running != nil {
+		n := atomic.AddInt32(f.running, 1)
+		defer atomic.AddInt32(f.running, -1)
+		for max := atomic.LoadInt32(f.maxRunning); n > max; max = atomic.LoadInt32(f.maxRunning) {
+			if atomic.CompareAndSwapInt32(f.maxRunning, max, n) {
+				break
+			}
+		}
+	}
+	time.Sleep(f.delay)
+	return status.Result{Up: true}, nil
+}
+
+func TestSpreadOffsets(t *testing.T) {
+	tests := []struct {
+		name    string
+		staters []status.Stater
+		want    map[string]time.Duration
+	}{
+		{
+			name:    "no check, should return no offset",
+			staters: nil,
+			want:    map[string]time.Duration{},
+		},
+		{
+			name: "checks with the same duration, should be spread evenly across it",
+			staters: []status.Stater{
+				fakeStater{name: "A", cron: "@1m"},
+				fakeStater{name: "B", cron: "@1m"},
+				fakeStater{name: "C", cron: "@1m"},
+				fakeStater{name: "D", cron: "@1m"},
+			},
+			want: map[string]time.Duration{"A": 0, "B": 15 * time.Second, "C": 30 * time.Second, "D": 45 * time.Second},
+		},
+		{
+			name: "checks with different durations, should be spread across their own duration",
+			staters: []status.Stater{
+				fakeStater{name: "A", cron: "@1m"},
+				fakeStater{name: "B", cron: "@10s"},
+				fakeStater{name: "C", cron: "@1m"},
+			},
+			want: map[string]time.Duration{"A": 0, "B": 0, "C": 30 * time.Second},
+		},
+		{
+			name: "a check with a cron expression, should have no offset",
+			staters: []status.Stater{
+				fakeStater{name: "A", cron: "*/5 * * * *"},
+				fakeStater{name: "B", cron: "@1m"},
+			},
+			want: map[string]time.Duration{"B": 0},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, spreadOffsets(tt.staters))
+		})
+	}
+}
+
+func TestJitter(t *testing.T) {
+	tests := []struct {
+		name string
+		max  time.Duration
+	}{
+		{name: "no jitter, should return 0", max: 0},
+		{name: "a negative jitter, should return 0", max: -time.Second},
+		{name: "a jitter, should return a duration below it", max: 10 * time.Millisecond},
+		{name: "a jitter of 1ns, should return 0", max: time.Nanosecond},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for i := 0; i < 100; i++ {
+				d := jitter(tt.max)
+				assert.GreaterOrEqual(t, d, time.Duration(0))
+				if tt.max > 0 {
+					assert.Less(t, d, tt.max)
+				} else {
+					assert.Equal(t, time.Duration(0), d)
+				}
+			}
+		})
+	}
+}
+
+func TestLimiter(t *testing.T) {
+	tests := []struct {
+		name        string
+		max         int
+		wantRunning int32
+		wantWaits   uint64
+	}{
+		{name: "no limit, should run the checks at the same time", max: 0, wantRunning: 3},
+		{name: "a limit of 1, should run the checks one at a time and record their waits", max: 1, wantRunning: 1, wantWaits: 3},
+		{name: "a limit of 2, should run two checks at the same time", max: 2, wantRunning: 2, wantWaits: 3},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rdr := sdkmetric.NewManualReader()
+			meter := sdkmetric.NewMeterProvider(sdkmetric.WithReader(rdr)).Meter("test-meter")
+			l := newLimiter(tt.max, meter)
+
+			var running, maxRunning int32
+			done := make(chan struct{})
+			for _, name := range []string{"A", "B", "C"} {
+				check := status.NewCheck(fakeStater{name: name, cron: "@1m", delay: 20 * time.Millisecond,
+					running: &running, maxRunning: &maxRunning})
+				go func() {
+					_, err := l.run(context.Background(), check, trace.NewNoopTracerProvider().Tracer("test-tracer"), meter)
+					assert.NoError(t, err)
+					done <- struct{}{}
+				}()
+			}
+			for i := 0; i < 3; i++ {
+				<-done
+			}
+			assert.Equal(t, tt.wantRunning, maxRunning)
+
+			m, err := rdr.Collect(context.Background())
+			require.NoError(t, err)
+			var waits uint64
+			for _, sm := range m.ScopeMetrics {
+				for _, mm := range sm.Metrics {
+					if mm.Name == otelStatusQueueWait {
+						for _, dp := range mm.Data.(metricdata.Histogram).DataPoints {
+							waits += dp.Count
+						}
+					}
+				}
+			}
+			assert.Equal(t, tt.wantWaits, waits)
+		})
+	}
+
+	t.Run("a canceled context while waiting, should return its error", func(t *testing.T) {
+		l := newLimiter(1, metric.NewNoopMeter())
+		l.slots <- struct{}{}
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+
+		_, err := l.run(ctx, status.NewCheck(fakeStater{name: "A", cron: "@1m"}),
+			trace.NewNoopTracerProvider().Tracer("test-tracer"), metric.NewNoopMeter())
+		assert.ErrorIs(t, err, context.Canceled)
+	})
+}
@@ -0,0 +1,239 @@
+/*******************************************************************************
+ * Copyright (c) 2023 Cedric L'homme.
+ *
+ * This file is part of otel-status.
+ *
+ * otel-status is free software: you can redistribute it and/or modify it
+ * under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License,
+ * or (at your option) any later version.
+ *
+ *  otel-status is distributed in the hope that it will be useful, but
+ *  WITHOUT ANY WARRANTY; without even the implied warranty of
+ *  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.
+ *  See the GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with otel-status. If not, see <https://www.gnu.org/licenses/>.
+ ******************************************************************************/
+
+// Package admin provides the HTTP server to follow and trigger the checks of otel-status.
+package admin
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/rangzen/otel-status/package/status"
+	"golang.org/x/exp/slog"
+)
+
+const checksPath = "/api/v1/checks"
+
+// Check is a check served by the admin API.
+type Check struct {
+	*status.Check
+	// NextRun returns the next scheduled run of the check, it is nil for a check that is not scheduled.
+	NextRun func() time.Time
+}
+
+// RunFunc runs a check on demand.
+type RunFunc func(ctx context.Context, check *status.Check) (status.Result, error)
+
+// Server serves the health endpoints of otel-status and the API of its checks:
+//   - GET /healthz is always OK while the process is running.
+//   - GET /readyz is OK once the checks are scheduled.
+//   - GET /api/v1/checks lists the checks with their last run and next run.
+//   - POST /api/v1/checks/{name}/run runs a check and returns its result,
+//     with a 502 if the run fails, a 409 if the check is closed by a reload and a 503 if the run is canceled.
+type Server struct {
+	run RunFunc
+
+	mu     sync.RWMutex
+	checks []Check
+	ready  bool
+}
+
+// NewServer returns a new Server running the checks on demand with run.
+func NewServer(run RunFunc) *Server {
+	return &Server{run: run}
+}
+
+// SetChecks replaces the checks served by the API.
+func (s *Server) SetChecks(checks []Check) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.checks = checks
+}
+
+// SetReady sets the readiness reported by /readyz.
+func (s *Server) SetReady(ready bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.ready = ready
+}
+
+// Handler returns the HTTP handler of the server.
+func (s *Server) Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/healthz", s.healthz)
+	mux.HandleFunc("/readyz", s.readyz)
+	mux.HandleFunc(checksPath, s.listChecks)
+	mux.HandleFunc(checksPath+"/", s.runCheck)
+	return mux
+}
+
+// healthz reports that the process is alive.
+func (s *Server) healthz(w http.ResponseWriter, _ *http.Request) {
+	writeJSON(w, http.StatusOK, map[string]string{"status": "ok"})
+}
+
+// readyz reports whether the checks are scheduled.
+func (s *Server) readyz(w http.ResponseWriter, _ *http.Request) {
+	s.mu.RLock()
+	ready := s.ready
+	s.mu.RUnlock()
+	if !ready {
+		writeJSON(w, http.StatusServiceUnavailable, map[string]string{"status": "not ready"})
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]string{"status": "ok"})
+}
+
+// checkResponse is a check in the API responses.
+type checkResponse struct {
+	Name        string       `json:"name"`
+	Plugin      string       `json:"plugin"`
+	Description string       `json:"description,omitempty"`
+	Cron        string       `json:"cron"`
+	LastRun     *runResponse `json:"last_run"`
+	NextRun     *time.Time   `json:"next_run"`
+}
+
+// runResponse is a run of a check in the API responses.
+type runResponse struct {
+	Start      time.Time `json:"start"`
+	DurationMs int64     `json:"duration_ms"`
+	Attempts   int       `json:"attempts"`
+	Up         bool      `json:"up"`
+	Message    string    `json:"message,omitempty"`
+	Error      string    `json:"error,omitempty"`
+}
+
+// listChecks lists the checks with their last run and next run.
+func (s *Server) listChecks(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+	s.mu.RLock()
+	checks := s.checks
+	s.mu.RUnlock()
+
+	res := make([]checkResponse, 0, len(checks))
+	for _, c := range checks {
+		res = append(res, newCheckResponse(c))
+	}
+	writeJSON(w, http.StatusOK, res)
+}
+
+// runCheck runs the check of POST /api/v1/checks/{name}/run and returns it with its new last run.
+func (s *Server) runCheck(w http.ResponseWriter, r *http.Request) {
+	escaped := strings.TrimPrefix(r.URL.EscapedPath(), checksPath+"/")
+	escapedName := strings.TrimSuffix(escaped, "/run")
+	if escapedName == escaped || escapedName == "" {
+		writeError(w, http.StatusNotFound, "not found")
+		return
+	}
+	if r.Method != http.MethodPost {
+		writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+	name, err := url.PathUnescape(escapedName)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "invalid check name")
+		return
+	}
+	check, ok := s.find(name)
+	if !ok {
+		writeError(w, http.StatusNotFound, "unknown check "+name)
+		return
+	}
+
+	slog.Info("running check on demand", "name", name)
+	_, err = s.run(r.Context(), check.Check)
+	switch {
+	case err == nil:
+		writeJSON(w, http.StatusOK, newCheckResponse(check))
+	case errors.Is(err, status.ErrCheckClosed):
+		// The check was removed or changed by a reload since it was found.
+		writeError(w, http.StatusConflict, "check "+name+" is closed")
+	case r.Context().Err() != nil:
+		writeError(w, http.StatusServiceUnavailable, err.Error())
+	default:
+		// Errors are already logged and recorded by the stater, and returned in the last run.
+		writeJSON(w, http.StatusBadGateway, newCheckResponse(check))
+	}
+}
+
+// find returns the check with the name.
+func (s *Server) find(name string) (Check, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	for _, c := range s.checks {
+		if c.Stater.Config().Name == name {
+			return c, true
+		}
+	}
+	return Check{}, false
+}
+
+// newCheckResponse returns the API response of the check.
+func newCheckResponse(c Check) checkResponse {
+	config := c.Stater.Config()
+	res := checkResponse{
+		Name:        config.Name,
+		Plugin:      c.Stater.Plugin(),
+		Description: config.Description,
+		Cron:        config.Cron,
+	}
+	if last := c.Last(); !last.Start.IsZero() {
+		res.LastRun = &runResponse{
+			Start:      last.Start,
+			DurationMs: last.Duration.Milliseconds(),
+			Attempts:   last.Attempts,
+			Up:         last.Result.Up,
+		}
+		if last.Err != nil {
+			res.LastRun.Error = last.Err.Error()
+		} else {
+			res.LastRun.Message = last.Result.Message
+		}
+	}
+	if c.NextRun != nil {
+		if next := c.NextRun(); !next.IsZero() {
+			res.NextRun = &next
+		}
+	}
+	return res
+}
+
+// writeError writes the error message as JSON.
+func writeError(w http.ResponseWriter, code int, msg string) {
+	writeJSON(w, code, map[string]string{"error": msg})
+}
+
+// writeJSON writes the value as JSON with the status code.
+func writeJSON(w http.ResponseWriter, code int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		slog.Error("writing admin response", err)
+	}
+}
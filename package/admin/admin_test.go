@@ -0,0 +1,168 @@
+/*******************************************************************************
+ * Copyright (c) 2023 Cedric L'homme.
+ *
+ * This file is part of otel-status.
+ *
+ * otel-status is free software: you can redistribute it and/or modify it
+ * under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License,
+ * or (at your option) any later version.
+ *
+ *  otel-status is distributed in the hope that it will be useful, but
+ *  WITHOUT ANY WARRANTY; without even the implied warranty of
+ *  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.
+ *  See the GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with otel-status. If not, see <https://www.gnu.org/licenses/>.
+ ******************************************************************************/
+
+package admin_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/rangzen/otel-status/package/admin"
+	"github.com/rangzen/otel-status/package/status"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel/metric"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// fakeStater is up, unless it has an error.
+type fakeStater struct {
+	name string
+	err  error
+}
+
+func (f fakeStater) Config() status.Config {
+	return status.Config{Name: f.name, Cron: "@1m"}
+}
+
+func (f fakeStater) Plugin() string {
+	return "fake"
+}
+
+func (f fakeStater) State(context.Context, trace.Tracer, metric.Meter) (status.Result, error) {
+	return status.Result{Up: f.err == nil}, f.err
+}
+
+func newServer() *admin.Server {
+	server := admin.NewServer(func(ctx context.Context, check *status.Check) (status.Result, error) {
+		return check.Run(ctx, trace.NewNoopTracerProvider().Tracer("test"), metric.NewNoopMeter())
+	})
+	next := time.Date(2023, 3, 1, 12, 0, 0, 0, time.UTC)
+	server.SetChecks([]admin.Check{
+		{Check: status.NewCheck(fakeStater{name: "API"}), NextRun: func() time.Time { return next }},
+		{Check: status.NewCheck(fakeStater{name: "My DB"})},
+	})
+	return server
+}
+
+func TestServer_Health(t *testing.T) {
+	server := newServer()
+	handler := server.Handler()
+
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/healthz", nil))
+	assert.Equal(t, http.StatusOK, rec.Code)
+
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/readyz", nil))
+	assert.Equal(t, http.StatusServiceUnavailable, rec.Code)
+
+	server.SetReady(true)
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/readyz", nil))
+	assert.Equal(t, http.StatusOK, rec.Code)
+}
+
+func TestServer_Checks(t *testing.T) {
+	t.Run("a list of checks, should return the checks with their next run", func(t *testing.T) {
+		rec := httptest.NewRecorder()
+		newServer().Handler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/v1/checks", nil))
+		require.Equal(t, http.StatusOK, rec.Code)
+
+		var checks []map[string]interface{}
+		require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &checks))
+		require.Len(t, checks, 2)
+		assert.Equal(t, "API", checks[0]["name"])
+		assert.Equal(t, "fake", checks[0]["plugin"])
+		assert.Nil(t, checks[0]["last_run"])
+		assert.Equal(t, "2023-03-01T12:00:00Z", checks[0]["next_run"])
+		assert.Nil(t, checks[1]["next_run"])
+	})
+
+	t.Run("a run of a check, should return its last run", func(t *testing.T) {
+		handler := newServer().Handler()
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/api/v1/checks/My%20DB/run", nil))
+		require.Equal(t, http.StatusOK, rec.Code)
+
+		var check map[string]interface{}
+		require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &check))
+		assert.Equal(t, "My DB", check["name"])
+		lastRun, ok := check["last_run"].(map[string]interface{})
+		require.True(t, ok)
+		assert.Equal(t, true, lastRun["up"])
+	})
+
+	t.Run("a run with an error, should return a 502 with its last run", func(t *testing.T) {
+		server := newServer()
+		server.SetChecks([]admin.Check{{Check: status.NewCheck(fakeStater{name: "API", err: errors.New("connection refused")})}})
+		rec := httptest.NewRecorder()
+		server.Handler().ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/api/v1/checks/API/run", nil))
+		require.Equal(t, http.StatusBadGateway, rec.Code)
+
+		var check map[string]interface{}
+		require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &check))
+		lastRun, ok := check["last_run"].(map[string]interface{})
+		require.True(t, ok)
+		assert.Equal(t, false, lastRun["up"])
+		assert.Equal(t, "connection refused", lastRun["error"])
+	})
+
+	t.Run("a run of a closed check, should return a 409", func(t *testing.T) {
+		server := newServer()
+		check := status.NewCheck(fakeStater{name: "API"})
+		require.NoError(t, check.Close())
+		server.SetChecks([]admin.Check{{Check: check}})
+		rec := httptest.NewRecorder()
+		server.Handler().ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/api/v1/checks/API/run", nil))
+		assert.Equal(t, http.StatusConflict, rec.Code)
+		assert.Contains(t, rec.Body.String(), "check API is closed")
+	})
+
+	t.Run("a canceled run, should return a 503", func(t *testing.T) {
+		server := admin.NewServer(func(ctx context.Context, _ *status.Check) (status.Result, error) {
+			<-ctx.Done()
+			return status.Result{}, ctx.Err()
+		})
+		server.SetChecks([]admin.Check{{Check: status.NewCheck(fakeStater{name: "API"})}})
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+		rec := httptest.NewRecorder()
+		server.Handler().ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/api/v1/checks/API/run", nil).WithContext(ctx))
+		assert.Equal(t, http.StatusServiceUnavailable, rec.Code)
+		assert.Contains(t, rec.Body.String(), context.Canceled.Error())
+	})
+
+	t.Run("a run of an unknown check, should return a 404", func(t *testing.T) {
+		rec := httptest.NewRecorder()
+		newServer().Handler().ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/api/v1/checks/nope/run", nil))
+		assert.Equal(t, http.StatusNotFound, rec.Code)
+	})
+
+	t.Run("a run with GET, should return a 405", func(t *testing.T) {
+		rec := httptest.NewRecorder()
+		newServer().Handler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/v1/checks/API/run", nil))
+		assert.Equal(t, http.StatusMethodNotAllowed, rec.Code)
+	})
+}
@@ -21,29 +21,202 @@
 package config
 
 import (
+	"errors"
 	"fmt"
+	"io"
 	"os"
+	"reflect"
 
+	"github.com/rangzen/otel-status/package/status"
+	"github.com/rangzen/otel-status/package/status/dns"
+	"github.com/rangzen/otel-status/package/status/exec"
+	"github.com/rangzen/otel-status/package/status/grpc"
 	"github.com/rangzen/otel-status/package/status/http"
+	"github.com/rangzen/otel-status/package/status/icmp"
+	"github.com/rangzen/otel-status/package/status/mail"
+	"github.com/rangzen/otel-status/package/status/redis"
+	"github.com/rangzen/otel-status/package/status/sql"
+	"github.com/rangzen/otel-status/package/status/tcp"
 	"gopkg.in/yaml.v3"
 )
 
 // Config is the configuration root type for configuration file.
 type Config struct {
 	States States `yaml:"states"`
+
+	// secrets are the values read from files and the values of the secret fields.
+	secrets []string
+}
+
+// Secrets returns the secrets of the configuration: the values read from files, see interpolate,
+// and the values of the fields tagged with secret:"true", e.g. the passwords.
+// They are registered by FromBytes, see status.RegisterSecret.
+func (c Config) Secrets() []string {
+	return append([]string(nil), c.secrets...)
 }
 
 // States is the configuration for all the status.
 type States struct {
-	HTTP []http.Config `yaml:"http"`
+	HTTP  []http.Config  `yaml:"http"`
+	TCP   []tcp.Config   `yaml:"tcp"`
+	DNS   []dns.Config   `yaml:"dns"`
+	GRPC  []grpc.Config  `yaml:"grpc"`
+	ICMP  []icmp.Config  `yaml:"icmp"`
+	SQL   []sql.Config   `yaml:"sql"`
+	Redis []redis.Config `yaml:"redis"`
+	SMTP  []mail.Config  `yaml:"smtp"`
+	IMAP  []mail.Config  `yaml:"imap"`
+	POP3  []mail.Config  `yaml:"pop3"`
+	Exec  []exec.Config  `yaml:"exec"`
+}
+
+// entry is the configuration of a check with its position in the states.
+type entry struct {
+	// key is the YAML key of the plugin in the states.
+	key    string
+	index  int
+	config status.Config
+	// plugin is the full configuration of the check for its plugin.
+	plugin interface{}
+	// newStater creates the stater of the check.
+	newStater func() (status.Stater, error)
+}
+
+// entries returns the configuration of all the checks, in the order of the plugins.
+func (s States) entries() []entry {
+	var entries []entry
+	for i, c := range s.HTTP {
+		c := c
+		entries = append(entries, entry{"http", i, c.Config, c, func() (status.Stater, error) { return http.New(c) }})
+	}
+	for i, c := range s.TCP {
+		c := c
+		entries = append(entries, entry{"tcp", i, c.Config, c, func() (status.Stater, error) { return tcp.New(c) }})
+	}
+	for i, c := range s.DNS {
+		c := c
+		entries = append(entries, entry{"dns", i, c.Config, c, func() (status.Stater, error) { return dns.New(c) }})
+	}
+	for i, c := range s.GRPC {
+		c := c
+		entries = append(entries, entry{"grpc", i, c.Config, c, func() (status.Stater, error) { return grpc.New(c) }})
+	}
+	for i, c := range s.ICMP {
+		c := c
+		entries = append(entries, entry{"icmp", i, c.Config, c, func() (status.Stater, error) { return icmp.New(c) }})
+	}
+	for i, c := range s.SQL {
+		c := c
+		entries = append(entries, entry{"sql", i, c.Config, c, func() (status.Stater, error) { return sql.New(c) }})
+	}
+	for i, c := range s.Redis {
+		c := c
+		entries = append(entries, entry{"redis", i, c.Config, c, func() (status.Stater, error) { return redis.New(c) }})
+	}
+	for i, c := range s.SMTP {
+		c := c
+		entries = append(entries, entry{"smtp", i, c.Config, c, func() (status.Stater, error) { return mail.NewSMTP(c) }})
+	}
+	for i, c := range s.IMAP {
+		c := c
+		entries = append(entries, entry{"imap", i, c.Config, c, func() (status.Stater, error) { return mail.NewIMAP(c) }})
+	}
+	for i, c := range s.POP3 {
+		c := c
+		entries = append(entries, entry{"pop3", i, c.Config, c, func() (status.Stater, error) { return mail.NewPOP3(c) }})
+	}
+	for i, c := range s.Exec {
+		c := c
+		entries = append(entries, entry{"exec", i, c.Config, c, func() (status.Stater, error) { return exec.New(c) }})
+	}
+	return entries
+}
+
+// Changes lists the names of the checks that differ between two configurations.
+type Changes struct {
+	Added   []string
+	Removed []string
+	Changed []string
+}
+
+// IsEmpty returns true if there is no change.
+func (c Changes) IsEmpty() bool {
+	return len(c.Added) == 0 && len(c.Removed) == 0 && len(c.Changed) == 0
+}
+
+// Changes returns the changes from the old configuration to c.
+// The checks are identified by their name.
+func (c Config) Changes(old Config) Changes {
+	oldEntries := map[string]entry{}
+	for _, e := range old.States.entries() {
+		oldEntries[e.config.Name] = e
+	}
+	var changes Changes
+	for _, e := range c.States.entries() {
+		o, ok := oldEntries[e.config.Name]
+		switch {
+		case !ok:
+			changes.Added = append(changes.Added, e.config.Name)
+		case o.key != e.key || !reflect.DeepEqual(o.plugin, e.plugin):
+			changes.Changed = append(changes.Changed, e.config.Name)
+		}
+		delete(oldEntries, e.config.Name)
+	}
+	for _, e := range old.States.entries() {
+		if _, ok := oldEntries[e.config.Name]; ok {
+			changes.Removed = append(changes.Removed, e.config.Name)
+		}
+	}
+	return changes
+}
+
+// Staters returns the staters of all the checks.
+func (c Config) Staters() ([]status.Stater, error) {
+	var staters []status.Stater
+	for _, e := range c.States.entries() {
+		stater, err := e.newStater()
+		if err != nil {
+			return nil, fmt.Errorf("%s[%d] %q: %w", e.key, e.index, e.config.Name, err)
+		}
+		staters = append(staters, stater)
+	}
+	return staters, nil
 }
 
 // FromBytes returns the States from the given slice of bytes.
+// The environment variables and files are substituted in the values, see interpolate.
+// The default values are applied and the configuration is validated,
+// a *ValidationError lists all the problems.
 func FromBytes(data []byte) (Config, error) {
-	var config Config
-	if err := yaml.Unmarshal(data, &config); err != nil {
+	var root yaml.Node
+	if err := yaml.Unmarshal(data, &root); err != nil {
 		return Config{}, fmt.Errorf("unmarshaling config file: %w", err)
 	}
+	var secrets []string
+	problems := interpolate(&root, false, &secrets)
+	// The values can be in the errors, e.g. of the decoding.
+	for _, secret := range secrets {
+		status.RegisterSecret(secret)
+	}
+	if len(problems) > 0 {
+		return Config{}, &ValidationError{Problems: problems}
+	}
+	var config Config
+	if err := root.Decode(&config); err != nil {
+		return Config{}, fmt.Errorf("unmarshaling config file: %w", status.RedactError(err))
+	}
+	if err := applyDefaults(reflect.ValueOf(&config)); err != nil {
+		return Config{}, fmt.Errorf("applying defaults: %w", err)
+	}
+	fieldSecrets := len(secrets)
+	collectSecrets(reflect.ValueOf(&config), &secrets)
+	for _, secret := range secrets[fieldSecrets:] {
+		status.RegisterSecret(secret)
+	}
+	config.secrets = secrets
+	if err := validate(&root, config); err != nil {
+		return Config{}, err
+	}
 	return config, nil
 }
 
@@ -55,3 +228,87 @@ func FromFile(path string) (Config, error) {
 	}
 	return FromBytes(configData)
 }
+
+// validate returns a *ValidationError with all the problems of the configuration, nil if there is none.
+func validate(root *yaml.Node, config Config) error {
+	var problems []Problem
+	add := func(e entry, field string, err error) {
+		var configErr *status.ConfigError
+		if field == "" && errors.As(err, &configErr) {
+			field = configErr.Field
+		}
+		problems = append(problems, Problem{
+			Line:  line(root, e.key, e.index, field),
+			Check: fmt.Sprintf("%s[%d] %q", e.key, e.index, e.config.Name),
+			Err:   status.RedactError(err),
+		})
+	}
+
+	names := map[string]bool{}
+	for _, e := range config.States.entries() {
+		switch {
+		case e.config.Name == "":
+			add(e, "name", errors.New("name is empty"))
+		case names[e.config.Name]:
+			add(e, "name", fmt.Errorf("name %q is already used", e.config.Name))
+		}
+		names[e.config.Name] = true
+
+		if err := e.config.Validate(); err != nil {
+			add(e, "", err)
+		}
+		stater, err := e.newStater()
+		if err != nil {
+			add(e, "", err)
+		} else if closer, ok := stater.(io.Closer); ok {
+			// The stater is only created to validate its configuration, e.g. a database is opened.
+			_ = closer.Close()
+		}
+	}
+
+	if len(problems) > 0 {
+		return &ValidationError{Problems: problems}
+	}
+	return nil
+}
+
+// line returns the line of the field of the check in the YAML document.
+// It falls back to the line of the check, or of its plugin, if the field is not found.
+func line(root *yaml.Node, key string, index int, field string) int {
+	n := root
+	if n.Kind == yaml.DocumentNode && len(n.Content) > 0 {
+		n = n.Content[0]
+	}
+	states := mappingValue(n, "states")
+	if states == nil {
+		return n.Line
+	}
+	checks := mappingValue(states, key)
+	if checks == nil {
+		return states.Line
+	}
+	if checks.Kind != yaml.SequenceNode || index >= len(checks.Content) {
+		return checks.Line
+	}
+	check := checks.Content[index]
+	for _, content := range check.Content {
+		// Keys of the inlined configurations are in the check mapping too.
+		if content.Kind == yaml.ScalarNode && content.Value == field {
+			return content.Line
+		}
+	}
+	return check.Line
+}
+
+// mappingValue returns the value of the key in the mapping node, nil if not found.
+func mappingValue(n *yaml.Node, key string) *yaml.Node {
+	if n.Kind != yaml.MappingNode {
+		return nil
+	}
+	for i := 0; i+1 < len(n.Content); i += 2 {
+		if n.Content[i].Value == key {
+			return n.Content[i+1]
+		}
+	}
+	return nil
+}
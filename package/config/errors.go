@@ -0,0 +1,57 @@
+/*******************************************************************************
+ * Copyright (c) 2023 Cedric L'homme.
+ *
+ * This file is part of otel-status.
+ *
+ * otel-status is free software: you can redistribute it and/or modify it
+ * under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License,
+ * or (at your option) any later version.
+ *
+ *  otel-status is distributed in the hope that it will be useful, but
+ *  WITHOUT ANY WARRANTY; without even the implied warranty of
+ *  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.
+ *  See the GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with otel-status. If not, see <https://www.gnu.org/licenses/>.
+ ******************************************************************************/
+
+package config
+
+import (
+	"fmt"
+	"strings"
+)
+
+// ValidationError lists all the problems of a configuration.
+type ValidationError struct {
+	Problems []Problem
+}
+
+// Problem is a problem in the configuration of a check.
+type Problem struct {
+	// Line is the line of the problem in the YAML document.
+	Line int
+	// Check identifies the check, e.g. http[0] "My API", empty if the problem is not in a check.
+	Check string
+	Err   error
+}
+
+// Error implements the error interface.
+func (p Problem) Error() string {
+	if p.Check == "" {
+		return fmt.Sprintf("line %d: %v", p.Line, p.Err)
+	}
+	return fmt.Sprintf("line %d: %s: %v", p.Line, p.Check, p.Err)
+}
+
+// Error implements the error interface with one problem per line.
+func (e *ValidationError) Error() string {
+	lines := make([]string, 0, len(e.Problems)+1)
+	lines = append(lines, fmt.Sprintf("invalid configuration, %d problem(s):", len(e.Problems)))
+	for _, p := range e.Problems {
+		lines = append(lines, "  "+p.Error())
+	}
+	return strings.Join(lines, "\n")
+}
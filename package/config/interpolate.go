@@ -0,0 +1,133 @@
+/*******************************************************************************
+ * Copyright (c) 2023 Cedric L'homme.
+ *
+ * This file is part of otel-status.
+ *
+ * otel-status is free software: you can redistribute it and/or modify it
+ * under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License,
+ * or (at your option) any later version.
+ *
+ *  otel-status is distributed in the hope that it will be useful, but
+ *  WITHOUT ANY WARRANTY; without even the implied warranty of
+ *  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.
+ *  See the GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with otel-status. If not, see <https://www.gnu.org/licenses/>.
+ ******************************************************************************/
+
+package config
+
+import (
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// envName is the syntax of an environment variable name.
+var envName = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// sensitiveKeys are the keys of the values that are sent with the requests of the checks,
+// the environment variables substituted in them are secrets, e.g. a token in a URL or in a header.
+var sensitiveKeys = map[string]bool{
+	"url":      true,
+	"dsn":      true,
+	"headers":  true,
+	"metadata": true,
+	"args":     true,
+	"env":      true,
+}
+
+// interpolate substitutes the ${ENV}, ${ENV:-default} and ${file:path} expressions
+// in the scalar values of the node and its children, $${ is a literal ${.
+// The values read from files are secrets, they are appended to secrets,
+// and so are the values of the environment variables if sensitive, see sensitiveKeys.
+func interpolate(n *yaml.Node, sensitive bool, secrets *[]string) []Problem {
+	var problems []Problem
+	switch n.Kind {
+	case yaml.ScalarNode:
+		if !strings.Contains(n.Value, "${") {
+			return nil
+		}
+		value, err := interpolateString(n.Value, sensitive, secrets)
+		if err != nil {
+			return []Problem{{Line: n.Line, Err: err}}
+		}
+		n.Value = value
+		if n.Style == 0 {
+			// A plain scalar is resolved from its new value, e.g. to a bool.
+			n.Tag = ""
+		}
+	case yaml.MappingNode:
+		// Only the values are interpolated, not the keys.
+		for i := 1; i < len(n.Content); i += 2 {
+			problems = append(problems, interpolate(n.Content[i], sensitive || sensitiveKeys[n.Content[i-1].Value], secrets)...)
+		}
+	default:
+		for _, c := range n.Content {
+			problems = append(problems, interpolate(c, sensitive, secrets)...)
+		}
+	}
+	return problems
+}
+
+// interpolateString substitutes the expressions of s, the values read from files are appended to secrets,
+// and so are the values of the environment variables if sensitive.
+func interpolateString(s string, sensitive bool, secrets *[]string) (string, error) {
+	var b strings.Builder
+	for i := 0; i < len(s); {
+		switch {
+		case strings.HasPrefix(s[i:], "$${"):
+			b.WriteString("${")
+			i += 3
+		case strings.HasPrefix(s[i:], "${"):
+			end := strings.IndexByte(s[i+2:], '}')
+			if end < 0 {
+				return "", fmt.Errorf("unclosed expression in %q", s)
+			}
+			value, secret, env, err := resolve(s[i+2 : i+2+end])
+			if err != nil {
+				return "", err
+			}
+			if secret || sensitive && env {
+				*secrets = append(*secrets, value)
+			}
+			b.WriteString(value)
+			i += 2 + end + 1
+		default:
+			b.WriteByte(s[i])
+			i++
+		}
+	}
+	return b.String(), nil
+}
+
+// resolve returns the value of the expression between ${ and }, whether it is read from a file (secret),
+// and whether it is the value of an environment variable (env), not its default.
+func resolve(expr string) (value string, secret bool, env bool, err error) {
+	if path := strings.TrimPrefix(expr, "file:"); path != expr {
+		content, err := os.ReadFile(path)
+		if err != nil {
+			return "", false, false, fmt.Errorf("reading secret file: %w", err)
+		}
+		return strings.TrimRight(string(content), "\r\n"), true, false, nil
+	}
+
+	name, def, hasDefault := strings.Cut(expr, ":-")
+	if !envName.MatchString(name) {
+		return "", false, false, fmt.Errorf("invalid environment variable name %q", name)
+	}
+	value, ok := os.LookupEnv(name)
+	switch {
+	case value == "" && hasDefault:
+		// The default is written in the configuration, it is not a secret.
+		return def, false, false, nil
+	case !ok:
+		return "", false, false, fmt.Errorf("environment variable %s is not set", name)
+	}
+	return value, false, true, nil
+}
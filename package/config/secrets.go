@@ -0,0 +1,63 @@
+/*******************************************************************************
+ * Copyright (c) 2023 Cedric L'homme.
+ *
+ * This file is part of otel-status.
+ *
+ * otel-status is free software: you can redistribute it and/or modify it
+ * under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License,
+ * or (at your option) any later version.
+ *
+ *  otel-status is distributed in the hope that it will be useful, but
+ *  WITHOUT ANY WARRANTY; without even the implied warranty of
+ *  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.
+ *  See the GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with otel-status. If not, see <https://www.gnu.org/licenses/>.
+ ******************************************************************************/
+
+package config
+
+import (
+	"reflect"
+)
+
+// secreter is implemented by the plugin configurations with secrets that are not fields of their own,
+// e.g. the password of a DSN.
+type secreter interface {
+	Secrets() []string
+}
+
+// collectSecrets appends to secrets the values of the string fields of v with a secret:"true" tag,
+// and the secrets of the secreter values.
+// It walks through the nested structs, pointers to structs and slices.
+func collectSecrets(v reflect.Value, secrets *[]string) {
+	switch v.Kind() {
+	case reflect.Pointer:
+		if v.IsNil() {
+			return
+		}
+		collectSecrets(v.Elem(), secrets)
+	case reflect.Slice:
+		for i := 0; i < v.Len(); i++ {
+			collectSecrets(v.Index(i), secrets)
+		}
+	case reflect.Struct:
+		if s, ok := v.Interface().(secreter); ok {
+			*secrets = append(*secrets, s.Secrets()...)
+		}
+		t := v.Type()
+		for i := 0; i < t.NumField(); i++ {
+			field := t.Field(i)
+			if !field.IsExported() {
+				continue
+			}
+			if field.Tag.Get("secret") == "true" && field.Type.Kind() == reflect.String {
+				*secrets = append(*secrets, v.Field(i).String())
+				continue
+			}
+			collectSecrets(v.Field(i), secrets)
+		}
+	}
+}
@@ -0,0 +1,270 @@
+/*******************************************************************************
+ * Copyright (c) 2023 Cedric L'homme.
+ *
+ * This file is part of otel-status.
+ *
+ * otel-status is free software: you can redistribute it and/or modify it
+ * under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License,
+ * or (at your option) any later version.
+ *
+ *  otel-status is distributed in the hope that it will be useful, but
+ *  WITHOUT ANY WARRANTY; without even the implied warranty of
+ *  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.
+ *  See the GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with otel-status. If not, see <https://www.gnu.org/licenses/>.
+ ******************************************************************************/
+
+package status
+
+import (
+	"context"
+	"errors"
+	"io"
+	"sync"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/metric"
+	"go.opentelemetry.io/otel/metric/instrument"
+	"go.opentelemetry.io/otel/metric/unit"
+	"go.opentelemetry.io/otel/trace"
+	"golang.org/x/exp/slog"
+)
+
+// ErrCheckClosed is returned by Check.Run once the check is closed.
+var ErrCheckClosed = errors.New("check is closed")
+
+// Check runs a Stater and reports its latest result in the OtelStatusUp gauge.
+// A failed attempt is retried as configured, and the up status only changes
+// after the configured number of consecutive failed or successful runs.
+type Check struct {
+	Stater Stater
+
+	up Gauge[int64]
+	// failure counts the failed attempts, see recordMetricFailure.
+	failure Instruments[instrument.Int64Counter]
+
+	mu   sync.Mutex
+	last Run
+	// closed is set by Close, the runs started before are waited for with running.
+	closed  bool
+	running sync.WaitGroup
+	// failures and successes are the numbers of consecutive failed and successful runs.
+	failures  int
+	successes int
+}
+
+// Run is a run of a check.
+type Run struct {
+	// Result is the result of the last attempt, with the up status of the check after the thresholds.
+	Result   Result
+	Err      error
+	Start    time.Time
+	Duration time.Duration
+	// Attempts is the number of attempts of the run.
+	Attempts int
+}
+
+// NewCheck returns a new Check of the stater.
+func NewCheck(stater Stater) *Check {
+	return &Check{Stater: stater}
+}
+
+// Run checks the status, retrying a failed attempt as configured.
+// Each attempt has the timeout of the stater.
+// With retries, the attempts are the children of a span of the check.
+// The up status is recorded in the OtelStatusUp gauge, a check that returns an error is down.
+func (c *Check) Run(ctx context.Context, tracer trace.Tracer, meter metric.Meter) (Result, error) {
+	c.mu.Lock()
+	if c.closed {
+		c.mu.Unlock()
+		return Result{}, ErrCheckClosed
+	}
+	c.running.Add(1)
+	c.mu.Unlock()
+	defer c.running.Done()
+
+	conf := c.Stater.Config()
+	start := time.Now()
+
+	var span trace.Span
+	if conf.Retries > 0 {
+		ctx, span = tracer.Start(ctx, conf.Name,
+			trace.WithAttributes(
+				attribute.String(OtelStatusName, conf.Name),
+				attribute.String(OtelStatusPluginName, c.Stater.Plugin()),
+			),
+		)
+		defer span.End()
+	}
+
+	var res Result
+	var err error
+	attempts := 0
+	for attempts <= conf.Retries {
+		if attempts > 0 {
+			if !sleep(ctx, conf.RetryDelay(attempts)) {
+				break
+			}
+			// The previous attempt failed and is retried.
+			c.recordMetricFailure(meter, false)
+		}
+		attempts++
+		res, err = c.attempt(ctx, tracer, meter, Attempt{Number: attempts, Last: attempts > conf.Retries})
+		if err == nil && res.Up {
+			break
+		}
+	}
+
+	// The last attempt failed, whatever the thresholds report.
+	failed := err != nil || !res.Up
+	c.mu.Lock()
+	res.Up = c.verdict(res.Up)
+	c.last = Run{Result: res, Err: err, Start: start, Duration: time.Since(start), Attempts: attempts}
+	c.mu.Unlock()
+
+	if span != nil {
+		span.SetAttributes(
+			attribute.Int(OtelStatusAttempts, attempts),
+			attribute.Bool(OtelStatusUp, res.Up),
+		)
+		if err != nil {
+			span.RecordError(err)
+		}
+		if !res.Up {
+			span.SetStatus(codes.Error, res.Message)
+		}
+	}
+
+	if gaugeErr := c.recordMetricUp(meter, res.Up); gaugeErr != nil {
+		slog.Error("creating up metric", gaugeErr,
+			slog.String("plugin", c.Stater.Plugin()),
+			slog.String("name", conf.Name))
+	}
+	if failed {
+		c.recordMetricFailure(meter, true)
+	}
+	return res, err
+}
+
+// attempt checks the status once with the timeout of the stater.
+func (c *Check) attempt(ctx context.Context, tracer trace.Tracer, meter metric.Meter, attempt Attempt) (Result, error) {
+	ctx, cancel := context.WithTimeout(WithAttempt(ctx, attempt), c.Stater.Config().EffectiveTimeout())
+	defer cancel()
+
+	res, err := c.Stater.State(ctx, tracer, meter)
+	if err != nil {
+		res = Result{Up: false, Message: err.Error()}
+	}
+	return res, err
+}
+
+// verdict counts the run and returns the up status of the check after the thresholds.
+// The first run sets the status without thresholds. c.mu must be held.
+func (c *Check) verdict(up bool) bool {
+	if up {
+		c.successes++
+		c.failures = 0
+	} else {
+		c.failures++
+		c.successes = 0
+	}
+
+	conf := c.Stater.Config()
+	switch {
+	case c.last.Start.IsZero():
+		return up
+	case c.last.Result.Up && c.failures < conf.EffectiveFailureThreshold():
+		return true
+	case !c.last.Result.Up && c.successes < conf.EffectiveSuccessThreshold():
+		return false
+	default:
+		return up
+	}
+}
+
+// sleep waits for d and returns false if ctx is done before.
+func sleep(ctx context.Context, d time.Duration) bool {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return false
+	case <-timer.C:
+		return true
+	}
+}
+
+// Last returns the latest run of the check, the zero Run if the check has never run.
+func (c *Check) Last() Run {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.last
+}
+
+// Close stops reporting the metrics of the check, e.g. when it is removed from the configuration.
+// It waits for the running runs, so that they do not report their metrics again,
+// and the next runs return ErrCheckClosed.
+// The stater is closed too if it implements io.Closer.
+func (c *Check) Close() error {
+	c.mu.Lock()
+	c.closed = true
+	c.mu.Unlock()
+	c.running.Wait()
+
+	err := c.up.Unregister()
+	if closer, ok := c.Stater.(io.Closer); ok {
+		if closeErr := closer.Close(); closeErr != nil && err == nil {
+			err = closeErr
+		}
+	}
+	return err
+}
+
+// recordMetricFailure counts a failed attempt of the check, an error or a down result,
+// with the OtelStatusVerdict attribute: true for the final attempt of the run.
+func (c *Check) recordMetricFailure(meter metric.Meter, verdict bool) {
+	failure, err := c.failure.Get(meter, func(meter metric.Meter) (instrument.Int64Counter, error) {
+		return meter.Int64Counter(
+			OtelStatusFailure,
+			instrument.WithUnit(unit.Dimensionless),
+			instrument.WithDescription("Failed attempts of the check"),
+		)
+	})
+	if err != nil {
+		slog.Error("creating failure metric", err,
+			slog.String("plugin", c.Stater.Plugin()),
+			slog.String("name", c.Stater.Config().Name))
+		return
+	}
+	failure.Add(context.Background(), 1,
+		attribute.String(OtelStatusName, c.Stater.Config().Name),
+		attribute.String(OtelStatusPluginName, c.Stater.Plugin()),
+		attribute.Bool(OtelStatusVerdict, verdict),
+	)
+}
+
+// recordMetricUp records the up (1) or down (0) status of the check.
+func (c *Check) recordMetricUp(meter metric.Meter, up bool) error {
+	val := int64(0)
+	if up {
+		val = 1
+	}
+	return c.up.Set(meter, OtelStatusUp,
+		[]instrument.Option{
+			instrument.WithUnit(unit.Dimensionless),
+			instrument.WithDescription("Up (1) or down (0) status of the check"),
+		},
+		GaugePoint[int64]{
+			Value: val,
+			Attributes: []attribute.KeyValue{
+				attribute.String(OtelStatusName, c.Stater.Config().Name),
+				attribute.String(OtelStatusPluginName, c.Stater.Plugin()),
+			},
+		},
+	)
+}
@@ -0,0 +1,301 @@
+/*******************************************************************************
+ * Copyright (c) 2023 Cedric L'homme.
+ *
+ * This file is part of otel-status.
+ *
+ * otel-status is free software: you can redistribute it and/or modify it
+ * under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License,
+ * or (at your option) any later version.
+ *
+ *  otel-status is distributed in the hope that it will be useful, but
+ *  WITHOUT ANY WARRANTY; without even the implied warranty of
+ *  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.
+ *  See the GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with otel-status. If not, see <https://www.gnu.org/licenses/>.
+ ******************************************************************************/
+
+package status_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/rangzen/otel-status/package/status"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/metric"
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+	"go.opentelemetry.io/otel/sdk/metric/metricdata"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// fakeStater returns the configured result and error.
+type fakeStater struct {
+	result status.Result
+	err    error
+}
+
+func (f *fakeStater) Config() status.Config {
+	return status.Config{Name: "Test"}
+}
+
+func (f *fakeStater) Plugin() string {
+	return "fake"
+}
+
+func (f *fakeStater) State(context.Context, trace.Tracer, metric.Meter) (status.Result, error) {
+	return f.result, f.err
+}
+
+// sequenceStater returns the configured results in sequence, in a span per attempt.
+type sequenceStater struct {
+	config   status.Config
+	results  []status.Result
+	attempts []status.Attempt
+}
+
+func (s *sequenceStater) Config() status.Config {
+	return s.config
+}
+
+func (s *sequenceStater) Plugin() string {
+	return "sequence"
+}
+
+func (s *sequenceStater) State(ctx context.Context, tracer trace.Tracer, _ metric.Meter) (status.Result, error) {
+	_, span := tracer.Start(ctx, "attempt")
+	defer span.End()
+	s.attempts = append(s.attempts, status.AttemptFromContext(ctx))
+	return s.results[len(s.attempts)-1], nil
+}
+
+func TestCheck_Run(t *testing.T) {
+	tests := []struct {
+		name   string
+		stater *fakeStater
+		want   int64
+	}{
+		{
+			name:   "an up result, should report 1",
+			stater: &fakeStater{result: status.Result{Up: true}},
+			want:   1,
+		},
+		{
+			name:   "a down result, should report 0",
+			stater: &fakeStater{result: status.Result{Message: "down"}},
+			want:   0,
+		},
+		{
+			name:   "an error, should report 0",
+			stater: &fakeStater{result: status.Result{Up: true}, err: errors.New("failure")},
+			want:   0,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rdr := sdkmetric.NewManualReader()
+			mp := sdkmetric.NewMeterProvider(sdkmetric.WithReader(rdr))
+			mockMeter := mp.Meter("test-meter")
+			mockTracer := trace.NewNoopTracerProvider().Tracer("test-tracer")
+
+			check := status.NewCheck(tt.stater)
+			res, err := check.Run(context.Background(), mockTracer, mockMeter)
+			assert.Equal(t, tt.stater.err, err)
+			assert.Equal(t, tt.want == 1, res.Up)
+			assert.Equal(t, res, check.Last().Result)
+
+			m, err := rdr.Collect(context.Background())
+			require.NoError(t, err)
+			require.Len(t, m.ScopeMetrics, 1)
+			if tt.want == 1 {
+				require.Len(t, m.ScopeMetrics[0].Metrics, 1)
+			} else {
+				// A failed run is counted with its verdict.
+				require.Len(t, m.ScopeMetrics[0].Metrics, 2)
+				failure := m.ScopeMetrics[0].Metrics[1]
+				assert.Equal(t, status.OtelStatusFailure, failure.Name)
+				failureDps := failure.Data.(metricdata.Sum[int64]).DataPoints
+				require.Len(t, failureDps, 1)
+				assert.Equal(t, int64(1), failureDps[0].Value)
+				assert.Contains(t, failureDps[0].Attributes.ToSlice(), attribute.Bool(status.OtelStatusVerdict, true))
+			}
+			up := m.ScopeMetrics[0].Metrics[0]
+			assert.Equal(t, status.OtelStatusUp, up.Name)
+			dps := up.Data.(metricdata.Gauge[int64]).DataPoints
+			require.Len(t, dps, 1)
+			assert.Equal(t, tt.want, dps[0].Value)
+			name, _ := dps[0].Attributes.Value(status.OtelStatusName)
+			assert.Equal(t, "Test", name.AsString())
+			plugin, _ := dps[0].Attributes.Value(status.OtelStatusPluginName)
+			assert.Equal(t, "fake", plugin.AsString())
+		})
+	}
+}
+
+// blockingStater is up once released.
+type blockingStater struct {
+	started  chan struct{}
+	released chan struct{}
+}
+
+func (b *blockingStater) Config() status.Config {
+	return status.Config{Name: "Test"}
+}
+
+func (b *blockingStater) Plugin() string {
+	return "blocking"
+}
+
+func (b *blockingStater) State(context.Context, trace.Tracer, metric.Meter) (status.Result, error) {
+	close(b.started)
+	<-b.released
+	return status.Result{Up: true}, nil
+}
+
+func TestCheck_Close(t *testing.T) {
+	t.Run("a running check, should be waited for and not report its status after the close", func(t *testing.T) {
+		rdr := sdkmetric.NewManualReader()
+		mp := sdkmetric.NewMeterProvider(sdkmetric.WithReader(rdr))
+		mockMeter := mp.Meter("test-meter")
+		mockTracer := trace.NewNoopTracerProvider().Tracer("test-tracer")
+
+		stater := &blockingStater{started: make(chan struct{}), released: make(chan struct{})}
+		check := status.NewCheck(stater)
+		go func() { _, _ = check.Run(context.Background(), mockTracer, mockMeter) }()
+		<-stater.started
+
+		closed := make(chan error)
+		go func() { closed <- check.Close() }()
+		select {
+		case <-closed:
+			t.Fatal("the check is closed before the end of its run")
+		case <-time.After(50 * time.Millisecond):
+		}
+		close(stater.released)
+		require.NoError(t, <-closed)
+
+		m, err := rdr.Collect(context.Background())
+		require.NoError(t, err)
+		for _, sm := range m.ScopeMetrics {
+			for _, mm := range sm.Metrics {
+				assert.Empty(t, mm.Data.(metricdata.Gauge[int64]).DataPoints, mm.Name)
+			}
+		}
+
+		_, err = check.Run(context.Background(), mockTracer, mockMeter)
+		assert.ErrorIs(t, err, status.ErrCheckClosed)
+	})
+}
+
+func TestCheck_Retries(t *testing.T) {
+	t.Run("a failed attempt followed by a successful one, should be up after 2 attempts", func(t *testing.T) {
+		exp := tracetest.NewInMemoryExporter()
+		tp := sdktrace.NewTracerProvider(sdktrace.WithSyncer(exp))
+		mockTracer := tp.Tracer("test-tracer")
+		mockMeter := metric.NewNoopMeter()
+
+		stater := &sequenceStater{
+			config:  status.Config{Name: "Test", Retries: 2, RetryInterval: time.Millisecond},
+			results: []status.Result{{Message: "down"}, {Up: true}},
+		}
+		check := status.NewCheck(stater)
+		res, err := check.Run(context.Background(), mockTracer, mockMeter)
+		require.NoError(t, err)
+		assert.True(t, res.Up)
+		assert.Equal(t, 2, check.Last().Attempts)
+		assert.Equal(t, []status.Attempt{{Number: 1}, {Number: 2}}, stater.attempts)
+
+		spans := exp.GetSpans()
+		require.Len(t, spans, 3)
+		parent := spans[2]
+		assert.Equal(t, "Test", parent.Name)
+		assert.Contains(t, parent.Attributes, attribute.Int(status.OtelStatusAttempts, 2))
+		for _, s := range spans[:2] {
+			assert.Equal(t, "attempt", s.Name)
+			assert.Equal(t, parent.SpanContext.SpanID(), s.Parent.SpanID())
+		}
+	})
+
+	t.Run("failed attempts, should stop after the retries", func(t *testing.T) {
+		exp := tracetest.NewInMemoryExporter()
+		tp := sdktrace.NewTracerProvider(sdktrace.WithSyncer(exp))
+		mockTracer := tp.Tracer("test-tracer")
+		rdr := sdkmetric.NewManualReader()
+		mp := sdkmetric.NewMeterProvider(sdkmetric.WithReader(rdr))
+		mockMeter := mp.Meter("test-meter")
+
+		stater := &sequenceStater{
+			config:  status.Config{Name: "Test", Retries: 1, Backoff: status.BackoffExponential},
+			results: []status.Result{{Message: "down"}, {Message: "still down"}},
+		}
+		check := status.NewCheck(stater)
+		res, err := check.Run(context.Background(), mockTracer, mockMeter)
+		require.NoError(t, err)
+		assert.Equal(t, status.Result{Message: "still down"}, res)
+		assert.Equal(t, []status.Attempt{{Number: 1}, {Number: 2, Last: true}}, stater.attempts)
+
+		spans := exp.GetSpans()
+		require.Len(t, spans, 3)
+		assert.Equal(t, codes.Error, spans[2].Status.Code)
+
+		// The down results without errors are counted, with the verdict of the final attempt only.
+		m, err := rdr.Collect(context.Background())
+		require.NoError(t, err)
+		var verdicts []bool
+		for _, mm := range m.ScopeMetrics[0].Metrics {
+			if mm.Name != status.OtelStatusFailure {
+				continue
+			}
+			for _, dp := range mm.Data.(metricdata.Sum[int64]).DataPoints {
+				assert.Equal(t, int64(1), dp.Value)
+				verdict, _ := dp.Attributes.Value(status.OtelStatusVerdict)
+				verdicts = append(verdicts, verdict.AsBool())
+			}
+		}
+		assert.ElementsMatch(t, []bool{false, true}, verdicts)
+	})
+}
+
+func TestCheck_Thresholds(t *testing.T) {
+	t.Run("thresholds of 2, should change the status after 2 consecutive runs", func(t *testing.T) {
+		mockTracer := trace.NewNoopTracerProvider().Tracer("test-tracer")
+		mockMeter := metric.NewNoopMeter()
+
+		results := []status.Result{{Up: true}, {}, {Up: true}, {}, {}, {Up: true}, {}, {Up: true}, {Up: true}}
+		stater := &sequenceStater{
+			config:  status.Config{Name: "Test", FailureThreshold: 2, SuccessThreshold: 2},
+			results: results,
+		}
+		check := status.NewCheck(stater)
+		var got []bool
+		for range results {
+			res, err := check.Run(context.Background(), mockTracer, mockMeter)
+			require.NoError(t, err)
+			got = append(got, res.Up)
+		}
+		assert.Equal(t, []bool{true, true, true, true, false, false, false, false, true}, got)
+	})
+}
+
+func TestConfig_RetryDelay(t *testing.T) {
+	constant := status.Config{RetryInterval: time.Second}
+	exponential := status.Config{RetryInterval: time.Second, Backoff: status.BackoffExponential}
+	for retry, want := range map[int]time.Duration{1: time.Second, 2: 2 * time.Second, 3: 4 * time.Second} {
+		assert.Equal(t, time.Second, constant.RetryDelay(retry))
+		assert.Equal(t, want, exponential.RetryDelay(retry))
+	}
+	for _, retry := range []int{10, 63, 64, 1000} {
+		assert.Equal(t, status.MaxRetryDelay, exponential.RetryDelay(retry), retry)
+	}
+	long := status.Config{RetryInterval: time.Hour, Backoff: status.BackoffExponential}
+	assert.Equal(t, time.Hour, long.RetryDelay(5))
+}
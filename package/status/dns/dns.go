@@ -0,0 +1,571 @@
+/*******************************************************************************
+ * Copyright (c) 2023 Cedric L'homme.
+ *
+ * This file is part of otel-status.
+ *
+ * otel-status is free software: you can redistribute it and/or modify it
+ * under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License,
+ * or (at your option) any later version.
+ *
+ *  otel-status is distributed in the hope that it will be useful, but
+ *  WITHOUT ANY WARRANTY; without even the implied warranty of
+ *  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.
+ *  See the GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with otel-status. If not, see <https://www.gnu.org/licenses/>.
+ ******************************************************************************/
+
+// Package dns is the package to get status through DNS resolution.
+package dns
+
+import (
+	"bufio"
+	"context"
+	"crypto/rand"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/rangzen/otel-status/package/status"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/metric"
+	"go.opentelemetry.io/otel/metric/instrument"
+	"go.opentelemetry.io/otel/metric/unit"
+	"go.opentelemetry.io/otel/semconv/v1.17.0"
+	"go.opentelemetry.io/otel/trace"
+	"golang.org/x/exp/slog"
+	"golang.org/x/net/dns/dnsmessage"
+)
+
+// PluginName is the name of the plugin.
+const PluginName = "dns"
+
+const (
+	otelStatusDNSName     = "otelstatus.dns.name"
+	otelStatusDNSQuery    = "otelstatus.dns.query"
+	otelStatusDNSType     = "otelstatus.dns.type"
+	otelStatusDNSResolver = "otelstatus.dns.resolver"
+	otelStatusDNSDuration = "otelstatus.dns.duration"
+	otelStatusDNSAnswers  = "otelstatus.dns.answers"
+	otelStatusDNSError    = "otelstatus.dns.error"
+	// dnsRcode is the key for the response code, e.g. NOERROR or NXDOMAIN.
+	dnsRcode = "dns.rcode"
+	// dnsAnswer is the key for the answers of the response.
+	dnsAnswer = "dns.answer"
+	// dnsAnswerCount is the key for the number of answers of the response.
+	dnsAnswerCount = "dns.answer.count"
+)
+
+// resolvConf is the file used to find the resolver if none is configured.
+const resolvConf = "/etc/resolv.conf"
+
+// maxUDPSize is the size of the buffer for UDP responses, larger responses are truncated.
+const maxUDPSize = 512
+
+var types = map[string]dnsmessage.Type{
+	"A":     dnsmessage.TypeA,
+	"AAAA":  dnsmessage.TypeAAAA,
+	"CNAME": dnsmessage.TypeCNAME,
+	"MX":    dnsmessage.TypeMX,
+	"TXT":   dnsmessage.TypeTXT,
+	"SRV":   dnsmessage.TypeSRV,
+	"NS":    dnsmessage.TypeNS,
+}
+
+var rcodes = map[dnsmessage.RCode]string{
+	dnsmessage.RCodeSuccess:        "NOERROR",
+	dnsmessage.RCodeFormatError:    "FORMERR",
+	dnsmessage.RCodeServerFailure:  "SERVFAIL",
+	dnsmessage.RCodeNameError:      "NXDOMAIN",
+	dnsmessage.RCodeNotImplemented: "NOTIMP",
+	dnsmessage.RCodeRefused:        "REFUSED",
+}
+
+// Config is the configuration for a DNS status.
+type Config struct {
+	status.Config `yaml:",inline"`
+	// Resolver is the host:port of the DNS server, the first nameserver of /etc/resolv.conf if empty.
+	Resolver string `yaml:"resolver"`
+	// Protocol is udp or tcp.
+	Protocol string `yaml:"protocol" default:"udp"`
+	// Query is the domain name to resolve.
+	Query string `yaml:"query"`
+	// Type is the type of record: A, AAAA, CNAME, MX, TXT, SRV or NS.
+	Type string `yaml:"type" default:"A"`
+	// Rcode is the expected response code.
+	Rcode string `yaml:"rcode" default:"NOERROR"`
+	// Expect is the list of answers that must be in the response,
+	// e.g. "192.0.2.1" for A, "10 mail.example.com" for MX or "10 5 5060 sip.example.com" for SRV.
+	Expect []string `yaml:"expect"`
+	// Values is a map of key/value to add to the spans.
+	Values map[string]string `yaml:"values"`
+}
+
+// DNS is the main structure to use DNS status.
+type DNS struct {
+	SC       status.Config
+	Resolver string
+	Protocol string
+	Query    string
+	Type     string
+	Rcode    string
+	Expect   []string
+	Values   map[string]string
+	// answers reports the number of answers of the last response.
+	answers     status.Gauge[int64]
+	instruments status.Instruments[instruments]
+}
+
+// instruments are the synchronous instruments of the DNS status.
+type instruments struct {
+	duration instrument.Int64Histogram
+	error    instrument.Int64Counter
+}
+
+// newInstruments creates the synchronous instruments of the DNS status on the meter.
+func newInstruments(meter metric.Meter) (instruments, error) {
+	var i instruments
+	var err error
+	i.duration, err = meter.Int64Histogram(
+		otelStatusDNSDuration,
+		instrument.WithUnit(unit.Milliseconds),
+		instrument.WithDescription("Duration of the DNS query"),
+	)
+	if err != nil {
+		return i, fmt.Errorf("creating DNS query duration metric: %w", err)
+	}
+	i.error, err = meter.Int64Counter(
+		otelStatusDNSError,
+		instrument.WithUnit(unit.Dimensionless),
+		instrument.WithDescription("Error of the DNS query"),
+	)
+	if err != nil {
+		return i, fmt.Errorf("creating DNS query error metric: %w", err)
+	}
+	return i, nil
+}
+
+// New returns the DNS status of the configuration.
+func New(c Config) (*DNS, error) {
+	d := &DNS{
+		SC:       c.Config,
+		Resolver: c.Resolver,
+		Protocol: strings.ToLower(c.Protocol),
+		Query:    c.Query,
+		Type:     strings.ToUpper(c.Type),
+		Rcode:    strings.ToUpper(c.Rcode),
+		Expect:   c.Expect,
+		Values:   c.Values,
+	}
+	if d.Protocol == "" {
+		d.Protocol = "udp"
+	}
+	if d.Type == "" {
+		d.Type = "A"
+	}
+	if d.Rcode == "" {
+		d.Rcode = rcodes[dnsmessage.RCodeSuccess]
+	}
+	rcode, ok := parseRcode(d.Rcode)
+	if !ok {
+		return nil, &status.ConfigError{Field: "rcode", Err: fmt.Errorf("unknown response code %q", c.Rcode)}
+	}
+	d.Rcode = rcode
+	if d.Protocol != "udp" && d.Protocol != "tcp" {
+		return nil, &status.ConfigError{Field: "protocol", Err: fmt.Errorf("unknown protocol %q", c.Protocol)}
+	}
+	if _, ok := types[d.Type]; !ok {
+		return nil, &status.ConfigError{Field: "type", Err: fmt.Errorf("unknown record type %q", c.Type)}
+	}
+	if _, err := dnsmessage.NewName(fqdn(d.Query)); err != nil || d.Query == "" {
+		return nil, &status.ConfigError{Field: "query", Err: fmt.Errorf("invalid query %q", c.Query)}
+	}
+	return d, nil
+}
+
+// Config returns the status.Config of the DNS status.
+func (d *DNS) Config() status.Config {
+	return d.SC
+}
+
+// Close stops reporting the gauges of the DNS status.
+func (d *DNS) Close() error {
+	return d.answers.Unregister()
+}
+
+// Plugin returns the name of the DNS plugin.
+func (d *DNS) Plugin() string {
+	return PluginName
+}
+
+// State do the traces about the DNS status.
+func (d *DNS) State(ctx context.Context, tracer trace.Tracer, meter metric.Meter) (status.Result, error) {
+	metricCtx := status.WithoutCancel(ctx)
+
+	resolver, err := d.resolver()
+	span := d.newSpan(ctx, tracer, resolver)
+	defer span.End()
+	if err != nil {
+		return status.Result{}, d.errorHandling(metricCtx, span, meter, err, "finding resolver")
+	}
+
+	start := time.Now()
+	msg, err := d.exchange(ctx, resolver)
+	if err != nil {
+		return status.Result{}, d.errorHandling(metricCtx, span, meter, err, "querying DNS")
+	}
+	elapsedTime := time.Since(start).Milliseconds()
+
+	rcode := rcodeName(msg.Header.RCode)
+	answers := formatAnswers(msg.Answers, types[d.Type])
+	span.SetAttributes(
+		attribute.Int64("duration", elapsedTime),
+		attribute.String(dnsRcode, rcode),
+		attribute.StringSlice(dnsAnswer, answers),
+		attribute.Int(dnsAnswerCount, len(answers)),
+	)
+
+	slog.Info("status",
+		slog.String("plugin", PluginName),
+		slog.String("query", d.Query),
+		slog.String("type", d.Type),
+		slog.String("rcode", rcode),
+		slog.Int("answers", len(answers)),
+		slog.Int64("duration", elapsedTime),
+	)
+
+	result := d.recordSpanStatus(span, rcode, answers)
+
+	if err = d.recordMetricDuration(metricCtx, meter, elapsedTime, rcode); err != nil {
+		return status.Result{}, d.errorHandling(metricCtx, span, meter, err, "creating DNS query duration metric")
+	}
+	if err = d.recordMetricAnswers(meter, len(answers)); err != nil {
+		return status.Result{}, d.errorHandling(metricCtx, span, meter, err, "creating DNS answers metric")
+	}
+	return result, nil
+}
+
+// resolver returns the address of the DNS server.
+func (d *DNS) resolver() (string, error) {
+	resolver := d.Resolver
+	if resolver == "" {
+		var err error
+		if resolver, err = systemResolver(resolvConf); err != nil {
+			return "", err
+		}
+	}
+	if _, _, err := net.SplitHostPort(resolver); err != nil {
+		resolver = net.JoinHostPort(resolver, "53")
+	}
+	return resolver, nil
+}
+
+// systemResolver returns the first nameserver of the resolv.conf file.
+func systemResolver(path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) >= 2 && fields[0] == "nameserver" {
+			return fields[1], nil
+		}
+	}
+	if err = scanner.Err(); err != nil {
+		return "", err
+	}
+	return "", fmt.Errorf("no nameserver in %s", path)
+}
+
+// exchange sends the query to the resolver and returns the response.
+// A truncated UDP response is retried over TCP.
+func (d *DNS) exchange(ctx context.Context, resolver string) (*dnsmessage.Message, error) {
+	// The ID is not predictable, so that a spoofed response cannot guess it.
+	var b [2]byte
+	if _, err := rand.Read(b[:]); err != nil {
+		return nil, fmt.Errorf("generating query ID: %w", err)
+	}
+	id := binary.BigEndian.Uint16(b[:])
+	query, err := d.query(id)
+	if err != nil {
+		return nil, err
+	}
+
+	msg, err := exchange(ctx, d.Protocol, resolver, id, query)
+	if err == nil && msg.Header.Truncated && d.Protocol == "udp" {
+		msg, err = exchange(ctx, "tcp", resolver, id, query)
+	}
+	return msg, err
+}
+
+// query returns the packed DNS query.
+func (d *DNS) query(id uint16) ([]byte, error) {
+	name, err := dnsmessage.NewName(fqdn(d.Query))
+	if err != nil {
+		return nil, err
+	}
+	msg := dnsmessage.Message{
+		Header: dnsmessage.Header{ID: id, RecursionDesired: true},
+		Questions: []dnsmessage.Question{{
+			Name:  name,
+			Type:  types[d.Type],
+			Class: dnsmessage.ClassINET,
+		}},
+	}
+	return msg.Pack()
+}
+
+// exchange sends a packed query over the network and returns the unpacked response.
+// Over UDP, the replies with another ID than the one of the query, e.g. the late reply of a previous query,
+// and the datagrams that are not responses are ignored until the deadline.
+func exchange(ctx context.Context, network, resolver string, id uint16, query []byte) (*dnsmessage.Message, error) {
+	dialer := &net.Dialer{}
+	conn, err := dialer.DialContext(ctx, network, resolver)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	if deadline, ok := ctx.Deadline(); ok {
+		if err = conn.SetDeadline(deadline); err != nil {
+			return nil, err
+		}
+	}
+
+	if network == "tcp" {
+		// Over TCP, messages are prefixed by their length.
+		packet := make([]byte, 2+len(query))
+		binary.BigEndian.PutUint16(packet, uint16(len(query)))
+		copy(packet[2:], query)
+		if _, err = conn.Write(packet); err != nil {
+			return nil, err
+		}
+		var length [2]byte
+		if _, err = io.ReadFull(conn, length[:]); err != nil {
+			return nil, err
+		}
+		response := make([]byte, binary.BigEndian.Uint16(length[:]))
+		if _, err = io.ReadFull(conn, response); err != nil {
+			return nil, err
+		}
+		msg, err := unpack(response)
+		if err != nil {
+			return nil, err
+		}
+		if msg.Header.ID != id {
+			return nil, fmt.Errorf("response ID %d does not match query ID %d", msg.Header.ID, id)
+		}
+		return msg, nil
+	}
+
+	if _, err = conn.Write(query); err != nil {
+		return nil, err
+	}
+	response := make([]byte, maxUDPSize)
+	for {
+		n, err := conn.Read(response)
+		if err != nil {
+			return nil, err
+		}
+		msg, err := unpack(response[:n])
+		if err != nil {
+			continue
+		}
+		if msg.Header.ID == id {
+			return msg, nil
+		}
+	}
+}
+
+// unpack returns the unpacked response.
+func unpack(response []byte) (*dnsmessage.Message, error) {
+	var msg dnsmessage.Message
+	if err := msg.Unpack(response); err != nil {
+		return nil, fmt.Errorf("unpacking response: %w", err)
+	}
+	if !msg.Header.Response {
+		return nil, errors.New("the message received is not a response")
+	}
+	return &msg, nil
+}
+
+// formatAnswers returns the answers of the given type as strings.
+// Names are returned without the trailing dot.
+func formatAnswers(resources []dnsmessage.Resource, t dnsmessage.Type) []string {
+	answers := make([]string, 0, len(resources))
+	for _, r := range resources {
+		if r.Header.Type != t {
+			continue
+		}
+		switch b := r.Body.(type) {
+		case *dnsmessage.AResource:
+			answers = append(answers, net.IP(b.A[:]).String())
+		case *dnsmessage.AAAAResource:
+			answers = append(answers, net.IP(b.AAAA[:]).String())
+		case *dnsmessage.CNAMEResource:
+			answers = append(answers, trimDot(b.CNAME.String()))
+		case *dnsmessage.NSResource:
+			answers = append(answers, trimDot(b.NS.String()))
+		case *dnsmessage.MXResource:
+			answers = append(answers, fmt.Sprintf("%d %s", b.Pref, trimDot(b.MX.String())))
+		case *dnsmessage.TXTResource:
+			answers = append(answers, strings.Join(b.TXT, ""))
+		case *dnsmessage.SRVResource:
+			answers = append(answers, fmt.Sprintf("%d %d %d %s", b.Priority, b.Weight, b.Port, trimDot(b.Target.String())))
+		}
+	}
+	return answers
+}
+
+// missingAnswers returns the expected answers not found in the response.
+// Names are compared case-insensitively and without the trailing dot.
+func missingAnswers(expected, answers []string) []string {
+	var missing []string
+	for _, e := range expected {
+		found := false
+		for _, a := range answers {
+			if strings.EqualFold(trimDot(e), a) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			missing = append(missing, e)
+		}
+	}
+	return missing
+}
+
+// rcodeName returns the usual name of the response code, e.g. NXDOMAIN.
+func rcodeName(rcode dnsmessage.RCode) string {
+	if name, ok := rcodes[rcode]; ok {
+		return name
+	}
+	return "RCODE" + strconv.Itoa(int(rcode))
+}
+
+// parseRcode returns the name of the response code as returned by rcodeName,
+// the name is a usual one, e.g. NXDOMAIN, or RCODE followed by the code, e.g. RCODE3 for NXDOMAIN.
+func parseRcode(name string) (string, bool) {
+	for _, n := range rcodes {
+		if n == name {
+			return name, true
+		}
+	}
+	digits := strings.TrimPrefix(name, "RCODE")
+	if digits == name {
+		return "", false
+	}
+	code, err := strconv.ParseUint(digits, 10, 12)
+	if err != nil {
+		return "", false
+	}
+	return rcodeName(dnsmessage.RCode(code)), true
+}
+
+// fqdn returns the fully qualified domain name, with a trailing dot.
+func fqdn(name string) string {
+	if strings.HasSuffix(name, ".") {
+		return name
+	}
+	return name + "."
+}
+
+// trimDot returns the name without the trailing dot.
+func trimDot(name string) string {
+	return strings.TrimSuffix(name, ".")
+}
+
+// newSpan creates a new span for the DNS query data.
+func (d *DNS) newSpan(ctx context.Context, tracer trace.Tracer, resolver string) trace.Span {
+	host, port, _ := net.SplitHostPort(resolver)
+	_, span := tracer.Start(ctx, fmt.Sprintf("DNS %s %s", d.Type, d.Query),
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(
+			attribute.String(status.OtelStatusPluginName, PluginName),
+			attribute.String(otelStatusDNSQuery, d.Query),
+			attribute.String(otelStatusDNSType, d.Type),
+			attribute.String(otelStatusDNSResolver, resolver),
+			semconv.NetPeerNameKey.String(host),
+			semconv.NetPeerPortKey.String(port),
+		),
+		trace.WithAttributes(d.configAttributes()...),
+	)
+	return span
+}
+
+// configAttributes returns the attributes from the config.
+func (d *DNS) configAttributes() []attribute.KeyValue {
+	var valuesAttributes []attribute.KeyValue
+	for k, v := range d.Values {
+		valuesAttributes = append(valuesAttributes, attribute.String(k, status.Redact(v)))
+	}
+	return valuesAttributes
+}
+
+// recordSpanStatus sets the span status from the response code and the expected answers.
+// The result is up if the response is the expected one.
+func (d *DNS) recordSpanStatus(span trace.Span, rcode string, answers []string) status.Result {
+	var message string
+	if rcode != d.Rcode {
+		message = fmt.Sprintf("DNS response code %s, expected %s", rcode, d.Rcode)
+	} else if missing := missingAnswers(d.Expect, answers); len(missing) > 0 {
+		message = fmt.Sprintf("DNS answers %v not found in %v", missing, answers)
+	}
+	if message != "" {
+		span.SetStatus(codes.Error, message)
+	}
+	return status.Result{Up: message == "", Message: message}
+}
+
+// metricAttributes returns the attributes common to all the metrics.
+func (d *DNS) metricAttributes() []attribute.KeyValue {
+	return []attribute.KeyValue{
+		attribute.String(otelStatusDNSName, d.SC.Name),
+		attribute.String(otelStatusDNSQuery, d.Query),
+		attribute.String(otelStatusDNSType, d.Type),
+	}
+}
+
+// recordMetricDuration records the duration of the DNS query in a metric.
+func (d *DNS) recordMetricDuration(ctx context.Context, meter metric.Meter, elapsedTime int64, rcode string) error {
+	inst, err := d.instruments.Get(meter, newInstruments)
+	if err != nil {
+		return err
+	}
+	inst.duration.Record(ctx, elapsedTime, append(d.metricAttributes(), attribute.String(dnsRcode, rcode))...)
+	return nil
+}
+
+// recordMetricAnswers records the number of answers of the last response in a gauge.
+func (d *DNS) recordMetricAnswers(meter metric.Meter, count int) error {
+	return d.answers.Set(meter, otelStatusDNSAnswers,
+		[]instrument.Option{
+			instrument.WithUnit(unit.Dimensionless),
+			instrument.WithDescription("Number of answers of the DNS response"),
+		},
+		status.GaugePoint[int64]{Value: int64(count), Attributes: d.metricAttributes()},
+	)
+}
+
+// errorHandling is a helper function to handle errors.
+// It logs the error, records it in the span and in the error metric, and returns it.
+func (d *DNS) errorHandling(ctx context.Context, span trace.Span, meter metric.Meter, err error, msg string) error {
+	e := status.RedactError(fmt.Errorf("%s: %w", msg, err))
+	attributes := status.RecordError(ctx, span, PluginName, msg, e, status.ErrorClass(e))
+	if inst, err := d.instruments.Get(meter, newInstruments); err == nil {
+		inst.error.Add(ctx, 1, append(d.metricAttributes(), attributes...)...)
+	}
+	return e
+}
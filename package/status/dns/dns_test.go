@@ -0,0 +1,383 @@
+/*******************************************************************************
+ * Copyright (c) 2023 Cedric L'homme.
+ *
+ * This file is part of otel-status.
+ *
+ * otel-status is free software: you can redistribute it and/or modify it
+ * under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License,
+ * or (at your option) any later version.
+ *
+ *  otel-status is distributed in the hope that it will be useful, but
+ *  WITHOUT ANY WARRANTY; without even the implied warranty of
+ *  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.
+ *  See the GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with otel-status. If not, see <https://www.gnu.org/licenses/>.
+ ******************************************************************************/
+
+package dns_test
+
+import (
+	"context"
+	"encoding/binary"
+	"io"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/rangzen/otel-status/package/status"
+	"github.com/rangzen/otel-status/package/status/dns"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/sdk/metric"
+	"go.opentelemetry.io/otel/sdk/metric/metricdata"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"golang.org/x/net/dns/dnsmessage"
+)
+
+// zone is the content of the test DNS server.
+var zone = map[dnsmessage.Type]map[string][]dnsmessage.ResourceBody{
+	dnsmessage.TypeA: {
+		"www.example.com.": {
+			&dnsmessage.AResource{A: [4]byte{192, 0, 2, 1}},
+			&dnsmessage.AResource{A: [4]byte{192, 0, 2, 2}},
+		},
+	},
+	dnsmessage.TypeMX: {
+		"example.com.": {
+			&dnsmessage.MXResource{Pref: 10, MX: dnsmessage.MustNewName("mail.example.com.")},
+		},
+	},
+	dnsmessage.TypeTXT: {
+		"example.com.": {
+			&dnsmessage.TXTResource{TXT: []string{"v=spf1 -all"}},
+		},
+	},
+	dnsmessage.TypeSRV: {
+		"_sip._udp.example.com.": {
+			&dnsmessage.SRVResource{Priority: 10, Weight: 5, Port: 5060, Target: dnsmessage.MustNewName("sip.example.com.")},
+		},
+	},
+}
+
+// answer returns the packed response to the packed query.
+func answer(t *testing.T, query []byte) []byte {
+	var msg dnsmessage.Message
+	require.NoError(t, msg.Unpack(query))
+	q := msg.Questions[0]
+
+	b := dnsmessage.NewBuilder(nil, dnsmessage.Header{ID: msg.Header.ID, Response: true})
+	b.EnableCompression()
+	require.NoError(t, b.StartQuestions())
+	require.NoError(t, b.Question(q))
+	require.NoError(t, b.StartAnswers())
+	bodies, ok := zone[q.Type][q.Name.String()]
+	if !ok {
+		b = dnsmessage.NewBuilder(nil, dnsmessage.Header{ID: msg.Header.ID, Response: true, RCode: dnsmessage.RCodeNameError})
+		require.NoError(t, b.StartQuestions())
+		require.NoError(t, b.Question(q))
+	}
+	for _, body := range bodies {
+		h := dnsmessage.ResourceHeader{Name: q.Name, Class: dnsmessage.ClassINET, TTL: 60}
+		switch r := body.(type) {
+		case *dnsmessage.AResource:
+			require.NoError(t, b.AResource(h, *r))
+		case *dnsmessage.MXResource:
+			require.NoError(t, b.MXResource(h, *r))
+		case *dnsmessage.TXTResource:
+			require.NoError(t, b.TXTResource(h, *r))
+		case *dnsmessage.SRVResource:
+			require.NoError(t, b.SRVResource(h, *r))
+		}
+	}
+	res, err := b.Finish()
+	require.NoError(t, err)
+	return res
+}
+
+// newUDPServer starts an in-process DNS server over UDP and returns its address.
+func newUDPServer(t *testing.T) string {
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	require.NoError(t, err)
+	t.Cleanup(func() { conn.Close() })
+	go func() {
+		buf := make([]byte, 512)
+		for {
+			n, addr, err := conn.ReadFrom(buf)
+			if err != nil {
+				return
+			}
+			_, _ = conn.WriteTo(answer(t, buf[:n]), addr)
+		}
+	}()
+	return conn.LocalAddr().String()
+}
+
+// newSpoofedUDPServer starts an in-process DNS server over UDP that sends a reply with another ID,
+// a datagram that is not a DNS message and the query back first, and returns its address.
+func newSpoofedUDPServer(t *testing.T) string {
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	require.NoError(t, err)
+	t.Cleanup(func() { conn.Close() })
+	go func() {
+		buf := make([]byte, 512)
+		for {
+			n, addr, err := conn.ReadFrom(buf)
+			if err != nil {
+				return
+			}
+			res := answer(t, buf[:n])
+			spoofed := append([]byte(nil), res...)
+			binary.BigEndian.PutUint16(spoofed, binary.BigEndian.Uint16(res)+1)
+			_, _ = conn.WriteTo(spoofed, addr)
+			_, _ = conn.WriteTo([]byte("garbage"), addr)
+			_, _ = conn.WriteTo(buf[:n], addr)
+			_, _ = conn.WriteTo(res, addr)
+		}
+	}()
+	return conn.LocalAddr().String()
+}
+
+// newTCPServer starts an in-process DNS server over TCP and returns its address.
+func newTCPServer(t *testing.T) string {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	t.Cleanup(func() { listener.Close() })
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			var length [2]byte
+			if _, err = io.ReadFull(conn, length[:]); err == nil {
+				query := make([]byte, binary.BigEndian.Uint16(length[:]))
+				if _, err = io.ReadFull(conn, query); err == nil {
+					res := answer(t, query)
+					binary.BigEndian.PutUint16(length[:], uint16(len(res)))
+					_, _ = conn.Write(append(length[:], res...))
+				}
+			}
+			conn.Close()
+		}
+	}()
+	return listener.Addr().String()
+}
+
+func TestDNS_State(t *testing.T) {
+	tests := []struct {
+		name     string
+		protocol string
+		query    string
+		typ      string
+		rcode    string
+		expect   []string
+		wantCode codes.Code
+		answers  int64
+	}{
+		{
+			name:     "an A record with the expected answer, should create a span without an error status",
+			query:    "www.example.com",
+			typ:      "A",
+			expect:   []string{"192.0.2.2"},
+			wantCode: codes.Unset,
+			answers:  2,
+		},
+		{
+			name:     "an A record over TCP, should create a span without an error status",
+			protocol: "tcp",
+			query:    "www.example.com",
+			typ:      "A",
+			expect:   []string{"192.0.2.1"},
+			wantCode: codes.Unset,
+			answers:  2,
+		},
+		{
+			name:     "an MX record with the expected answer, should create a span without an error status",
+			query:    "example.com",
+			typ:      "MX",
+			expect:   []string{"10 mail.example.com."},
+			wantCode: codes.Unset,
+			answers:  1,
+		},
+		{
+			name:     "a TXT record with the expected answer, should create a span without an error status",
+			query:    "example.com",
+			typ:      "TXT",
+			expect:   []string{"v=spf1 -all"},
+			wantCode: codes.Unset,
+			answers:  1,
+		},
+		{
+			name:     "a SRV record with the expected answer, should create a span without an error status",
+			query:    "_sip._udp.example.com",
+			typ:      "SRV",
+			expect:   []string{"10 5 5060 sip.example.com"},
+			wantCode: codes.Unset,
+			answers:  1,
+		},
+		{
+			name:     "an A record without the expected answer, should create a span with an error status",
+			query:    "www.example.com",
+			typ:      "A",
+			expect:   []string{"192.0.2.3"},
+			wantCode: codes.Error,
+			answers:  2,
+		},
+		{
+			name:     "an unknown name, should create a span with an error status",
+			query:    "unknown.example.com",
+			typ:      "A",
+			wantCode: codes.Error,
+			answers:  0,
+		},
+		{
+			name:     "an unknown name with an expected NXDOMAIN, should create a span without an error status",
+			query:    "unknown.example.com",
+			typ:      "A",
+			rcode:    "NXDOMAIN",
+			wantCode: codes.Unset,
+			answers:  0,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resolver := newUDPServer(t)
+			if tt.protocol == "tcp" {
+				resolver = newTCPServer(t)
+			}
+
+			exp := tracetest.NewInMemoryExporter()
+			tp := sdktrace.NewTracerProvider(
+				sdktrace.WithSyncer(exp),
+			)
+			mockTracer := tp.Tracer("test-tracer")
+
+			rdr := metric.NewManualReader()
+			mp := metric.NewMeterProvider(metric.WithReader(rdr))
+			mockMeter := mp.Meter("test-meter")
+
+			stater, err := dns.New(dns.Config{
+				Config: status.Config{
+					Name:        "Test",
+					Description: "Test DNS",
+					Cron:        "@99m",
+				},
+				Resolver: resolver,
+				Protocol: tt.protocol,
+				Query:    tt.query,
+				Type:     tt.typ,
+				Rcode:    tt.rcode,
+				Expect:   tt.expect,
+			})
+			require.NoError(t, err)
+
+			_, err = stater.State(context.Background(), mockTracer, mockMeter)
+			require.NoError(t, err)
+
+			spans := exp.GetSpans()
+			require.Len(t, spans, 1)
+			require.Equal(t, tt.wantCode, spans[0].Status.Code)
+			assert.Contains(t, spans[0].Attributes, attribute.Int("dns.answer.count", int(tt.answers)))
+
+			m, err := rdr.Collect(context.Background())
+			assert.NoError(t, err)
+
+			require.Len(t, m.ScopeMetrics, 1)
+			require.Len(t, m.ScopeMetrics[0].Metrics, 2)
+			for _, mm := range m.ScopeMetrics[0].Metrics {
+				if mm.Name == "otelstatus.dns.answers" {
+					answers := mm.Data.(metricdata.Gauge[int64])
+					require.Len(t, answers.DataPoints, 1)
+					assert.Equal(t, tt.answers, answers.DataPoints[0].Value)
+				}
+			}
+		})
+	}
+
+	t.Run("an unreachable resolver, should create a span with an error status", func(t *testing.T) {
+		listener, err := net.Listen("tcp", "127.0.0.1:0")
+		require.NoError(t, err)
+		resolver := listener.Addr().String()
+		require.NoError(t, listener.Close())
+
+		exp := tracetest.NewInMemoryExporter()
+		tp := sdktrace.NewTracerProvider(
+			sdktrace.WithSyncer(exp),
+		)
+		mockTracer := tp.Tracer("test-tracer")
+
+		rdr := metric.NewManualReader()
+		mp := metric.NewMeterProvider(metric.WithReader(rdr))
+		mockMeter := mp.Meter("test-meter")
+
+		stater, err := dns.New(dns.Config{
+			Config: status.Config{
+				Name:        "Test",
+				Description: "Test DNS",
+				Cron:        "@99m",
+			},
+			Resolver: resolver,
+			Protocol: "tcp",
+			Query:    "www.example.com",
+		})
+		require.NoError(t, err)
+
+		_, err = stater.State(context.Background(), mockTracer, mockMeter)
+		require.Error(t, err)
+
+		spans := exp.GetSpans()
+		require.Len(t, spans, 1)
+		require.Equal(t, codes.Error, spans[0].Status.Code)
+
+		m, err := rdr.Collect(context.Background())
+		assert.NoError(t, err)
+
+		require.Len(t, m.ScopeMetrics, 1)
+		require.Len(t, m.ScopeMetrics[0].Metrics, 1)
+	})
+
+	t.Run("a reply with another ID, garbage and a query before the reply, should be ignored", func(t *testing.T) {
+		mockTracer := sdktrace.NewTracerProvider().Tracer("test-tracer")
+		mockMeter := metric.NewMeterProvider().Meter("test-meter")
+
+		stater, err := dns.New(dns.Config{
+			Config:   status.Config{Name: "Test"},
+			Resolver: newSpoofedUDPServer(t),
+			Query:    "www.example.com",
+			Expect:   []string{"192.0.2.1"},
+		})
+		require.NoError(t, err)
+
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		res, err := stater.State(ctx, mockTracer, mockMeter)
+		require.NoError(t, err)
+		assert.True(t, res.Up)
+	})
+
+	t.Run("an unknown record type, should return an error", func(t *testing.T) {
+		_, err := dns.New(dns.Config{Query: "example.com", Type: "PTR"})
+		require.Error(t, err)
+	})
+}
+
+func TestDNS_New(t *testing.T) {
+	t.Run("an unknown response code, should return an error", func(t *testing.T) {
+		_, err := dns.New(dns.Config{Query: "example.com", Rcode: "NXDOMIAN"})
+		var configErr *status.ConfigError
+		require.ErrorAs(t, err, &configErr)
+		assert.Equal(t, "rcode", configErr.Field)
+	})
+
+	t.Run("a numeric response code, should use its usual name", func(t *testing.T) {
+		stater, err := dns.New(dns.Config{Query: "example.com", Rcode: "rcode3"})
+		require.NoError(t, err)
+		assert.Equal(t, "NXDOMAIN", stater.Rcode)
+	})
+}
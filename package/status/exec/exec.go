@@ -0,0 +1,468 @@
+/*******************************************************************************
+ * Copyright (c) 2023 Cedric L'homme.
+ *
+ * This file is part of otel-status.
+ *
+ * otel-status is free software: you can redistribute it and/or modify it
+ * under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License,
+ * or (at your option) any later version.
+ *
+ *  otel-status is distributed in the hope that it will be useful, but
+ *  WITHOUT ANY WARRANTY; without even the implied warranty of
+ *  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.
+ *  See the GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with otel-status. If not, see <https://www.gnu.org/licenses/>.
+ ******************************************************************************/
+
+// Package exec is the package to get status by running a command.
+package exec
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	osexec "os/exec"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/rangzen/otel-status/package/status"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/metric"
+	"go.opentelemetry.io/otel/metric/instrument"
+	"go.opentelemetry.io/otel/metric/unit"
+	"go.opentelemetry.io/otel/semconv/v1.17.0"
+	"go.opentelemetry.io/otel/trace"
+	"golang.org/x/exp/slog"
+)
+
+// PluginName is the name of the plugin.
+const PluginName = "exec"
+
+const (
+	otelStatusExecName     = "otelstatus.exec.name"
+	otelStatusExecDuration = "otelstatus.exec.duration"
+	otelStatusExecError    = "otelstatus.exec.error"
+	otelStatusExecExitCode = "otelstatus.exec.exit_code"
+	otelStatusExecValue    = "otelstatus.exec.value"
+	// execLabelPrefix is the prefix of the keys of the labels of the JSON output, e.g. "exec.label.server".
+	execLabelPrefix = "exec.label."
+	// execValueName is the key for the path of a value in the JSON output, e.g. "queue.size".
+	execValueName = "exec.value.name"
+	// processExitCode is the key for the exit code of the command.
+	processExitCode = "process.exit_code"
+)
+
+// DefaultMaxOutput is the number of bytes of stdout and stderr kept if none is configured.
+const DefaultMaxOutput = 4096
+
+// Config is the configuration for a command status.
+type Config struct {
+	status.Config `yaml:",inline"`
+	// Command is the path or the name in the PATH of the command to run.
+	Command string `yaml:"command"`
+	// Args are the arguments of the command.
+	Args []string `yaml:"args"`
+	// Env is added to the environment of otel-status.
+	Env map[string]string `yaml:"env"`
+	// Dir is the working directory of the command, the one of otel-status if empty.
+	Dir string `yaml:"dir"`
+	// MaxOutput is the number of bytes of stdout and stderr kept, each.
+	MaxOutput int `yaml:"max_output" default:"4096"`
+	// Labels are the keys of the strings of the JSON output added to its values, e.g. "server".
+	Labels []string `yaml:"labels"`
+	// Values is a map of key/value to add to the spans.
+	Values map[string]string `yaml:"values"`
+}
+
+// Exec is the main structure to use command status.
+type Exec struct {
+	SC        status.Config
+	Command   string
+	Args      []string
+	Env       map[string]string
+	Dir       string
+	MaxOutput int
+	Labels    []string
+	Values    map[string]string
+	// exitCode reports the exit code of the latest run.
+	exitCode status.Gauge[int64]
+	// values reports the numbers of the JSON output of the latest run.
+	values      status.Gauge[float64]
+	instruments status.Instruments[instruments]
+}
+
+// instruments are the synchronous instruments of the command status.
+type instruments struct {
+	duration instrument.Int64Histogram
+	error    instrument.Int64Counter
+}
+
+// newInstruments creates the synchronous instruments of the command status on the meter.
+func newInstruments(meter metric.Meter) (instruments, error) {
+	var i instruments
+	var err error
+	i.duration, err = meter.Int64Histogram(
+		otelStatusExecDuration,
+		instrument.WithUnit(unit.Milliseconds),
+		instrument.WithDescription("Duration of the command"),
+	)
+	if err != nil {
+		return i, fmt.Errorf("creating command duration metric: %w", err)
+	}
+	i.error, err = meter.Int64Counter(
+		otelStatusExecError,
+		instrument.WithUnit(unit.Dimensionless),
+		instrument.WithDescription("Error of the command"),
+	)
+	if err != nil {
+		return i, fmt.Errorf("creating command error metric: %w", err)
+	}
+	return i, nil
+}
+
+// New returns the command status of the configuration.
+func New(c Config) (*Exec, error) {
+	if c.Command == "" {
+		return nil, &status.ConfigError{Field: "command", Err: errors.New("command is empty")}
+	}
+	if c.MaxOutput < 0 {
+		return nil, &status.ConfigError{Field: "max_output", Err: fmt.Errorf("max output %d must not be negative", c.MaxOutput)}
+	}
+	for _, l := range c.Labels {
+		if l == "" {
+			return nil, &status.ConfigError{Field: "labels", Err: errors.New("empty label")}
+		}
+	}
+	if c.MaxOutput == 0 {
+		c.MaxOutput = DefaultMaxOutput
+	}
+	return &Exec{
+		SC:        c.Config,
+		Command:   c.Command,
+		Args:      c.Args,
+		Env:       c.Env,
+		Dir:       c.Dir,
+		MaxOutput: c.MaxOutput,
+		Labels:    c.Labels,
+		Values:    c.Values,
+	}, nil
+}
+
+// Config returns the status.Config of the command status.
+func (e *Exec) Config() status.Config {
+	return e.SC
+}
+
+// Close stops reporting the gauges of the command status.
+func (e *Exec) Close() error {
+	err := e.exitCode.Unregister()
+	if valuesErr := e.values.Unregister(); valuesErr != nil && err == nil {
+		err = valuesErr
+	}
+	return err
+}
+
+// Plugin returns the name of the command plugin.
+func (e *Exec) Plugin() string {
+	return PluginName
+}
+
+// State do the traces about the command status.
+// The command and its children are killed when the context is done, e.g. after the timeout of the check.
+// A non-zero exit code sets the status down.
+func (e *Exec) State(ctx context.Context, tracer trace.Tracer, meter metric.Meter) (status.Result, error) {
+	start := time.Now()
+	metricCtx := status.WithoutCancel(ctx)
+
+	ctx, span := e.newSpan(ctx, tracer)
+	defer span.End()
+
+	cmd := osexec.Command(e.Command, e.Args...)
+	cmd.Dir = e.Dir
+	setProcessGroup(cmd)
+	if len(e.Env) > 0 {
+		cmd.Env = os.Environ()
+		for k, v := range e.Env {
+			cmd.Env = append(cmd.Env, k+"="+v)
+		}
+	}
+	stdout := &boundedBuffer{max: e.MaxOutput}
+	stderr := &boundedBuffer{max: e.MaxOutput}
+	cmd.Stdout, cmd.Stderr = stdout, stderr
+
+	err := run(ctx, cmd)
+	elapsedTime := time.Since(start).Milliseconds()
+	recordSpanOutput(span, "stdout", stdout)
+	recordSpanOutput(span, "stderr", stderr)
+	if err != nil && ctx.Err() != nil {
+		// The process is killed, its exit code is meaningless.
+		e.clearMetrics(meter)
+		return status.Result{}, e.errorHandling(metricCtx, span, meter, ctx.Err(), "running command")
+	}
+	var exitErr *osexec.ExitError
+	if err != nil && !errors.As(err, &exitErr) {
+		e.clearMetrics(meter)
+		return status.Result{}, e.errorHandling(metricCtx, span, meter, err, "running command")
+	}
+
+	exitCode := cmd.ProcessState.ExitCode()
+	span.SetAttributes(
+		attribute.Int(processExitCode, exitCode),
+		attribute.Int64("duration", elapsedTime),
+	)
+	slog.Info("status",
+		slog.String("plugin", PluginName),
+		slog.String("command", e.Command),
+		slog.Int("exit_code", exitCode),
+		slog.Int64("duration", elapsedTime),
+	)
+
+	var message string
+	if exitCode != 0 {
+		message = fmt.Sprintf("exit code %d", exitCode)
+		if signal, ok := exitSignal(cmd.ProcessState); ok {
+			// The exit code of a process terminated by a signal is -1.
+			message = "terminated by signal " + signal.String()
+		}
+		if line := lastLine(stderr.String()); line != "" {
+			message += ": " + line
+		}
+		message = status.Redact(message)
+		span.SetStatus(codes.Error, message)
+	}
+
+	inst, err := e.instruments.Get(meter, newInstruments)
+	if err != nil {
+		return status.Result{}, e.errorHandling(metricCtx, span, meter, err, "creating command metrics")
+	}
+	inst.duration.Record(metricCtx, elapsedTime, e.metricAttributes()...)
+
+	if err = e.recordMetricExitCode(meter, exitCode); err != nil {
+		return status.Result{}, e.errorHandling(metricCtx, span, meter, err, "creating command exit code metric")
+	}
+	// A truncated output is not parsed, the values of the previous run are not reported anymore.
+	var values []value
+	var strs map[string]string
+	if !stdout.truncated {
+		values, strs = parseValues(stdout.Bytes())
+	}
+	if err = e.recordMetricValues(meter, values, strs); err != nil {
+		return status.Result{}, e.errorHandling(metricCtx, span, meter, err, "creating command value metric")
+	}
+	return status.Result{Up: exitCode == 0, Message: message}, nil
+}
+
+// run starts the command and waits for it, killing its process group when the context is done.
+// Killing only the command would leave its children running with the output open, and Wait would block.
+func run(ctx context.Context, cmd *osexec.Cmd) error {
+	if err := cmd.Start(); err != nil {
+		return err
+	}
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		select {
+		case <-ctx.Done():
+			killProcessGroup(cmd.Process)
+		case <-done:
+		}
+	}()
+	return cmd.Wait()
+}
+
+// boundedBuffer is a buffer keeping the first max bytes written to it.
+// The writes never fail, so that the command is not blocked by a full buffer.
+// The bytes.Buffer is not embedded, its ReadFrom would be used by the copy of the output.
+type boundedBuffer struct {
+	buf       bytes.Buffer
+	max       int
+	truncated bool
+}
+
+func (b *boundedBuffer) Write(p []byte) (int, error) {
+	if room := b.max - b.buf.Len(); len(p) > room {
+		b.truncated = true
+		if room > 0 {
+			b.buf.Write(p[:room])
+		}
+		return len(p), nil
+	}
+	return b.buf.Write(p)
+}
+
+// Len returns the number of bytes kept.
+func (b *boundedBuffer) Len() int {
+	return b.buf.Len()
+}
+
+// Bytes returns the bytes kept.
+func (b *boundedBuffer) Bytes() []byte {
+	return b.buf.Bytes()
+}
+
+// String returns the bytes kept as a string.
+func (b *boundedBuffer) String() string {
+	return b.buf.String()
+}
+
+// recordSpanOutput adds the output of the command to the span, as an event named after the stream.
+func recordSpanOutput(span trace.Span, stream string, output *boundedBuffer) {
+	if output.Len() == 0 {
+		return
+	}
+	span.AddEvent(stream, trace.WithAttributes(
+		attribute.String("exec.output", status.Redact(output.String())),
+		attribute.Bool("exec.output.truncated", output.truncated),
+	))
+}
+
+// lastLine returns the last non-empty line of the output.
+func lastLine(output string) string {
+	lines := strings.Split(strings.TrimSpace(output), "\n")
+	return strings.TrimSpace(lines[len(lines)-1])
+}
+
+// value is a number of the JSON output.
+type value struct {
+	name  string
+	value float64
+}
+
+// parseValues returns the numbers of the output if it is a JSON object, with the paths of their keys as name,
+// e.g. {"queue": {"size": 3}} gives queue.size, and the strings of the root object by key.
+// It returns nothing if the output is not a JSON object.
+func parseValues(output []byte) ([]value, map[string]string) {
+	var root map[string]interface{}
+	if err := json.Unmarshal(output, &root); err != nil {
+		return nil, nil
+	}
+	var values []value
+	strs := map[string]string{}
+	var walk func(prefix string, object map[string]interface{})
+	walk = func(prefix string, object map[string]interface{}) {
+		for k, v := range object {
+			switch v := v.(type) {
+			case float64:
+				values = append(values, value{prefix + k, v})
+			case map[string]interface{}:
+				walk(prefix+k+".", v)
+			case string:
+				if prefix == "" {
+					strs[k] = v
+				}
+			}
+		}
+	}
+	walk("", root)
+	sort.Slice(values, func(i, j int) bool { return values[i].name < values[j].name })
+	return values, strs
+}
+
+// newSpan creates a new span for the command data.
+func (e *Exec) newSpan(ctx context.Context, tracer trace.Tracer) (context.Context, trace.Span) {
+	return tracer.Start(ctx, fmt.Sprintf("Exec %s", e.Command),
+		trace.WithSpanKind(trace.SpanKindInternal),
+		trace.WithAttributes(
+			attribute.String(status.OtelStatusPluginName, PluginName),
+			semconv.ProcessCommandKey.String(e.Command),
+			semconv.ProcessCommandArgsKey.StringSlice(e.redactedArgs()),
+		),
+		trace.WithAttributes(e.configAttributes()...),
+	)
+}
+
+// redactedArgs returns the arguments with the secrets redacted.
+func (e *Exec) redactedArgs() []string {
+	args := make([]string, 0, len(e.Args))
+	for _, a := range e.Args {
+		args = append(args, status.Redact(a))
+	}
+	return args
+}
+
+// configAttributes returns the attributes from the config.
+func (e *Exec) configAttributes() []attribute.KeyValue {
+	var valuesAttributes []attribute.KeyValue
+	for k, v := range e.Values {
+		valuesAttributes = append(valuesAttributes, attribute.String(k, status.Redact(v)))
+	}
+	return valuesAttributes
+}
+
+// metricAttributes returns the attributes of the metrics.
+func (e *Exec) metricAttributes() []attribute.KeyValue {
+	return []attribute.KeyValue{
+		attribute.String(otelStatusExecName, e.SC.Name),
+	}
+}
+
+// recordMetricExitCode records the exit code of the latest run in a gauge.
+func (e *Exec) recordMetricExitCode(meter metric.Meter, exitCode int) error {
+	return e.setMetricExitCode(meter, status.GaugePoint[int64]{Value: int64(exitCode), Attributes: e.metricAttributes()})
+}
+
+// setMetricExitCode replaces the points of the exit code gauge, none if the command did not exit.
+func (e *Exec) setMetricExitCode(meter metric.Meter, points ...status.GaugePoint[int64]) error {
+	return e.exitCode.Set(meter, otelStatusExecExitCode,
+		[]instrument.Option{
+			instrument.WithUnit(unit.Dimensionless),
+			instrument.WithDescription("Exit code of the command"),
+		},
+		points...,
+	)
+}
+
+// clearMetrics stops reporting the exit code and the values of the previous run, the command did not exit.
+// The errors are logged, the error of the run is the one returned.
+func (e *Exec) clearMetrics(meter metric.Meter) {
+	if err := e.setMetricExitCode(meter); err != nil {
+		slog.Error("creating command exit code metric", err, slog.String("plugin", PluginName))
+	}
+	if err := e.recordMetricValues(meter, nil, nil); err != nil {
+		slog.Error("creating command value metric", err, slog.String("plugin", PluginName))
+	}
+}
+
+// recordMetricValues records the numbers of the JSON output of the latest run in a gauge,
+// with the name of the value and the configured labels as attributes.
+// The labels are taken from the strings of the output, empty if missing.
+func (e *Exec) recordMetricValues(meter metric.Meter, values []value, strs map[string]string) error {
+	labels := make([]attribute.KeyValue, 0, len(e.Labels))
+	for _, l := range e.Labels {
+		labels = append(labels, attribute.String(execLabelPrefix+l, status.Redact(strs[l])))
+	}
+	points := make([]status.GaugePoint[float64], 0, len(values))
+	for _, v := range values {
+		attributes := append(e.metricAttributes(), labels...)
+		points = append(points, status.GaugePoint[float64]{
+			Value:      v.value,
+			Attributes: append(attributes, attribute.String(execValueName, v.name)),
+		})
+	}
+	return e.values.Set(meter, otelStatusExecValue,
+		[]instrument.Option{
+			instrument.WithUnit(unit.Dimensionless),
+			instrument.WithDescription("Value of the JSON output of the command"),
+		},
+		points...,
+	)
+}
+
+// errorHandling is a helper function to handle errors.
+// It logs the error, records it in the span and in the error metric, and returns it.
+func (e *Exec) errorHandling(ctx context.Context, span trace.Span, meter metric.Meter, err error, msg string) error {
+	re := status.RedactError(fmt.Errorf("%s: %w", msg, err))
+	attributes := status.RecordError(ctx, span, PluginName, msg, re, status.ErrorClass(re))
+	if inst, err := e.instruments.Get(meter, newInstruments); err == nil {
+		inst.error.Add(ctx, 1, append(e.metricAttributes(), attributes...)...)
+	}
+	return re
+}
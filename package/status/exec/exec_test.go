@@ -0,0 +1,307 @@
+/*******************************************************************************
+ * Copyright (c) 2023 Cedric L'homme.
+ *
+ * This file is part of otel-status.
+ *
+ * otel-status is free software: you can redistribute it and/or modify it
+ * under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License,
+ * or (at your option) any later version.
+ *
+ *  otel-status is distributed in the hope that it will be useful, but
+ *  WITHOUT ANY WARRANTY; without even the implied warranty of
+ *  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.
+ *  See the GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with otel-status. If not, see <https://www.gnu.org/licenses/>.
+ ******************************************************************************/
+
+package exec_test
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/rangzen/otel-status/package/status"
+	"github.com/rangzen/otel-status/package/status/exec"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/sdk/metric"
+	"go.opentelemetry.io/otel/sdk/metric/metricdata"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+func TestExec_State(t *testing.T) {
+	tests := []struct {
+		name    string
+		script  string
+		up      bool
+		message string
+		events  []string
+	}{
+		{
+			name:   "a successful command, should create a span without an error status",
+			script: `echo "checked $BATCH in $(basename "$PWD")"`,
+			up:     true,
+			events: []string{"stdout"},
+		},
+		{
+			name:    "a failed command, should create a span with an error status",
+			script:  `echo processing; echo "batch is empty" >&2; exit 2`,
+			message: "exit code 2: batch is empty",
+			events:  []string{"stdout", "stderr"},
+		},
+		{
+			name:    "a command killed by a signal, should report the signal",
+			script:  `echo "out of memory" >&2; kill -9 $$`,
+			message: "terminated by signal killed: out of memory",
+			events:  []string{"stderr"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			exp := tracetest.NewInMemoryExporter()
+			tp := sdktrace.NewTracerProvider(
+				sdktrace.WithSyncer(exp),
+			)
+			mockTracer := tp.Tracer("test-tracer")
+
+			rdr := metric.NewManualReader()
+			mp := metric.NewMeterProvider(metric.WithReader(rdr))
+			mockMeter := mp.Meter("test-meter")
+
+			dir := t.TempDir()
+			stater, err := exec.New(exec.Config{
+				Config: status.Config{
+					Name:        "Test",
+					Description: "Test command",
+					Cron:        "@99m",
+				},
+				Command: "sh",
+				Args:    []string{"-c", tt.script},
+				Env:     map[string]string{"BATCH": "orders.csv"},
+				Dir:     dir,
+			})
+			require.NoError(t, err)
+			defer stater.Close()
+
+			res, err := stater.State(context.Background(), mockTracer, mockMeter)
+			require.NoError(t, err)
+			assert.Equal(t, status.Result{Up: tt.up, Message: tt.message}, res)
+
+			spans := exp.GetSpans()
+			require.Len(t, spans, 1)
+			wantCode := codes.Unset
+			if !tt.up {
+				wantCode = codes.Error
+			}
+			assert.Equal(t, wantCode, spans[0].Status.Code)
+			var events []string
+			for _, e := range spans[0].Events {
+				events = append(events, e.Name)
+			}
+			assert.Equal(t, tt.events, events)
+			if tt.up {
+				assert.Contains(t, spans[0].Events[0].Attributes,
+					attribute.String("exec.output", "checked orders.csv in "+dir[strings.LastIndex(dir, "/")+1:]+"\n"))
+			}
+
+			m, err := rdr.Collect(context.Background())
+			require.NoError(t, err)
+			require.Len(t, m.ScopeMetrics, 1)
+			var metrics []string
+			for _, mm := range m.ScopeMetrics[0].Metrics {
+				metrics = append(metrics, mm.Name)
+			}
+			assert.ElementsMatch(t, []string{
+				"otelstatus.exec.duration",
+				"otelstatus.exec.exit_code",
+			}, metrics)
+		})
+	}
+
+	t.Run("a JSON output, should record its numbers with the configured labels", func(t *testing.T) {
+		exp := tracetest.NewInMemoryExporter()
+		tp := sdktrace.NewTracerProvider(
+			sdktrace.WithSyncer(exp),
+		)
+		rdr := metric.NewManualReader()
+		mp := metric.NewMeterProvider(metric.WithReader(rdr))
+
+		stater, err := exec.New(exec.Config{
+			Config:  status.Config{Name: "Test", Description: "Test JSON", Cron: "@99m"},
+			Command: "echo",
+			Args:    []string{`{"server": "license-1", "checked_at": "2023-05-01T10:00:00Z", "seats": {"used": 12, "free": 3.5}}`},
+			Labels:  []string{"server"},
+		})
+		require.NoError(t, err)
+		defer stater.Close()
+
+		res, err := stater.State(context.Background(), tp.Tracer("test-tracer"), mp.Meter("test-meter"))
+		require.NoError(t, err)
+		assert.True(t, res.Up)
+
+		m, err := rdr.Collect(context.Background())
+		require.NoError(t, err)
+		require.Len(t, m.ScopeMetrics, 1)
+		var values map[string]float64
+		for _, mm := range m.ScopeMetrics[0].Metrics {
+			if mm.Name != "otelstatus.exec.value" {
+				continue
+			}
+			values = map[string]float64{}
+			for _, dp := range mm.Data.(metricdata.Gauge[float64]).DataPoints {
+				name, _ := dp.Attributes.Value("exec.value.name")
+				server, _ := dp.Attributes.Value("exec.label.server")
+				assert.Equal(t, "license-1", server.AsString())
+				assert.False(t, dp.Attributes.HasValue("exec.label.checked_at"))
+				values[name.AsString()] = dp.Value
+			}
+		}
+		assert.Equal(t, map[string]float64{"seats.used": 12, "seats.free": 3.5}, values)
+	})
+
+	t.Run("a truncated output or a timeout, should stop reporting the metrics of the previous run", func(t *testing.T) {
+		rdr := metric.NewManualReader()
+		mp := metric.NewMeterProvider(metric.WithReader(rdr))
+		mode := filepath.Join(t.TempDir(), "mode")
+		stater, err := exec.New(exec.Config{
+			Config:  status.Config{Name: "Test", Description: "Test previous run", Cron: "@99m"},
+			Command: "sh",
+			Args: []string{"-c", `case $(cat "$0") in
+				json) echo '{"used": 12}' ;;
+				long) echo '{"used": 12, "free": 3}' ;;
+				*) sleep 10 ;;
+			esac`, mode},
+			MaxOutput: 16,
+		})
+		require.NoError(t, err)
+		defer stater.Close()
+
+		// points returns the number of points of the gauges, the ones without points are not collected.
+		points := func() map[string]int {
+			m, err := rdr.Collect(context.Background())
+			require.NoError(t, err)
+			got := map[string]int{}
+			for _, sm := range m.ScopeMetrics {
+				for _, mm := range sm.Metrics {
+					switch data := mm.Data.(type) {
+					case metricdata.Gauge[int64]:
+						got[mm.Name] = len(data.DataPoints)
+					case metricdata.Gauge[float64]:
+						got[mm.Name] = len(data.DataPoints)
+					}
+				}
+			}
+			return got
+		}
+		state := func(m string, timeout time.Duration) {
+			require.NoError(t, os.WriteFile(mode, []byte(m), 0o600))
+			ctx, cancel := context.WithTimeout(context.Background(), timeout)
+			defer cancel()
+			_, _ = stater.State(ctx, sdktrace.NewTracerProvider().Tracer("test-tracer"), mp.Meter("test-meter"))
+		}
+
+		state("json", 5*time.Second)
+		assert.Equal(t, map[string]int{"otelstatus.exec.exit_code": 1, "otelstatus.exec.value": 1}, points())
+
+		state("long", 5*time.Second)
+		assert.Equal(t, map[string]int{"otelstatus.exec.exit_code": 1}, points())
+
+		state("json", 5*time.Second)
+		state("sleep", 100*time.Millisecond)
+		assert.Empty(t, points())
+	})
+
+	t.Run("a long output, should be truncated", func(t *testing.T) {
+		exp := tracetest.NewInMemoryExporter()
+		tp := sdktrace.NewTracerProvider(
+			sdktrace.WithSyncer(exp),
+		)
+		stater, err := exec.New(exec.Config{
+			Config:    status.Config{Name: "Test", Description: "Test output", Cron: "@99m"},
+			Command:   "echo",
+			Args:      []string{"0123456789"},
+			MaxOutput: 4,
+		})
+		require.NoError(t, err)
+
+		_, err = stater.State(context.Background(), tp.Tracer("test-tracer"), metric.NewMeterProvider().Meter("test-meter"))
+		require.NoError(t, err)
+
+		spans := exp.GetSpans()
+		require.Len(t, spans, 1)
+		require.Len(t, spans[0].Events, 1)
+		assert.Contains(t, spans[0].Events[0].Attributes, attribute.String("exec.output", "0123"))
+		assert.Contains(t, spans[0].Events[0].Attributes, attribute.Bool("exec.output.truncated", true))
+	})
+
+	t.Run("a command running after the timeout, should return an error", func(t *testing.T) {
+		exp := tracetest.NewInMemoryExporter()
+		tp := sdktrace.NewTracerProvider(
+			sdktrace.WithSyncer(exp),
+		)
+		stater, err := exec.New(exec.Config{
+			Config:  status.Config{Name: "Test", Description: "Test timeout", Cron: "@99m"},
+			Command: "sleep",
+			Args:    []string{"10"},
+		})
+		require.NoError(t, err)
+
+		ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+		defer cancel()
+		_, err = stater.State(ctx, tp.Tracer("test-tracer"), metric.NewMeterProvider().Meter("test-meter"))
+		require.ErrorIs(t, err, context.DeadlineExceeded)
+
+		spans := exp.GetSpans()
+		require.Len(t, spans, 1)
+		assert.Equal(t, codes.Error, spans[0].Status.Code)
+	})
+
+	t.Run("a command with a child running after the timeout, should return at the timeout", func(t *testing.T) {
+		stater, err := exec.New(exec.Config{
+			Config:  status.Config{Name: "Test", Description: "Test child", Cron: "@99m"},
+			Command: "sh",
+			// The sleep is a child of the shell, with the output of the shell.
+			Args: []string{"-c", "sleep 10; echo done"},
+		})
+		require.NoError(t, err)
+
+		ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+		defer cancel()
+		start := time.Now()
+		_, err = stater.State(ctx, sdktrace.NewTracerProvider().Tracer("test-tracer"),
+			metric.NewMeterProvider().Meter("test-meter"))
+		require.ErrorIs(t, err, context.DeadlineExceeded)
+		assert.Less(t, time.Since(start), 5*time.Second)
+	})
+
+	t.Run("an unknown command, should return an error", func(t *testing.T) {
+		stater, err := exec.New(exec.Config{
+			Config:  status.Config{Name: "Test", Description: "Test unknown", Cron: "@99m"},
+			Command: "otel-status-unknown-command",
+		})
+		require.NoError(t, err)
+
+		_, err = stater.State(context.Background(), sdktrace.NewTracerProvider().Tracer("test-tracer"),
+			metric.NewMeterProvider().Meter("test-meter"))
+		require.Error(t, err)
+	})
+}
+
+func TestExec_New(t *testing.T) {
+	t.Run("an empty command, should return an error", func(t *testing.T) {
+		_, err := exec.New(exec.Config{})
+		var configErr *status.ConfigError
+		require.ErrorAs(t, err, &configErr)
+		assert.Equal(t, "command", configErr.Field)
+	})
+}
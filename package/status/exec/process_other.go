@@ -0,0 +1,40 @@
+//go:build !(linux || darwin || dragonfly || freebsd || netbsd || openbsd)
+
+/*******************************************************************************
+ * Copyright (c) 2023 Cedric L'homme.
+ *
+ * This file is part of otel-status.
+ *
+ * otel-status is free software: you can redistribute it and/or modify it
+ * under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License,
+ * or (at your option) any later version.
+ *
+ *  otel-status is distributed in the hope that it will be useful, but
+ *  WITHOUT ANY WARRANTY; without even the implied warranty of
+ *  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.
+ *  See the GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with otel-status. If not, see <https://www.gnu.org/licenses/>.
+ ******************************************************************************/
+
+package exec
+
+import (
+	"os"
+	osexec "os/exec"
+)
+
+// setProcessGroup does nothing, process groups are not supported.
+func setProcessGroup(*osexec.Cmd) {}
+
+// killProcessGroup kills the command only, its children are left running.
+func killProcessGroup(p *os.Process) {
+	_ = p.Kill()
+}
+
+// exitSignal returns false, the signal that terminated the process is not known.
+func exitSignal(*os.ProcessState) (os.Signal, bool) {
+	return nil, false
+}
@@ -0,0 +1,132 @@
+/*******************************************************************************
+ * Copyright (c) 2023 Cedric L'homme.
+ *
+ * This file is part of otel-status.
+ *
+ * otel-status is free software: you can redistribute it and/or modify it
+ * under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License,
+ * or (at your option) any later version.
+ *
+ *  otel-status is distributed in the hope that it will be useful, but
+ *  WITHOUT ANY WARRANTY; without even the implied warranty of
+ *  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.
+ *  See the GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with otel-status. If not, see <https://www.gnu.org/licenses/>.
+ ******************************************************************************/
+
+package status
+
+import (
+	"context"
+	"sync"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+	"go.opentelemetry.io/otel/metric/instrument"
+)
+
+// Gauge reports the latest values of a check through an observable gauge of int64 or float64 values.
+// The zero value is ready to use, the callback is registered on the meter by the first call to Set.
+type Gauge[T int64 | float64] struct {
+	// mu protects points, it is the only lock taken by the callback.
+	mu     sync.Mutex
+	points []GaugePoint[T]
+
+	// regMu protects the registration of the callback.
+	regMu sync.Mutex
+	meter metric.Meter
+	reg   metric.Registration
+}
+
+// GaugePoint is a value reported by a Gauge with its attributes.
+type GaugePoint[T int64 | float64] struct {
+	Value      T
+	Attributes []attribute.KeyValue
+}
+
+// Set replaces the values reported by the gauge name of the meter.
+func (g *Gauge[T]) Set(meter metric.Meter, name string, options []instrument.Option, points ...GaugePoint[T]) error {
+	g.mu.Lock()
+	g.points = points
+	g.mu.Unlock()
+
+	g.regMu.Lock()
+	defer g.regMu.Unlock()
+	if g.reg != nil && g.meter == meter {
+		return nil
+	}
+	if g.reg != nil {
+		if err := g.reg.Unregister(); err != nil {
+			return err
+		}
+		g.reg = nil
+	}
+
+	gauge, observe, err := g.newObservable(meter, name, options)
+	if err != nil {
+		return err
+	}
+	reg, err := meter.RegisterCallback(func(_ context.Context, o metric.Observer) error {
+		g.mu.Lock()
+		defer g.mu.Unlock()
+		for _, p := range g.points {
+			observe(o, p)
+		}
+		return nil
+	}, gauge)
+	if err != nil {
+		return err
+	}
+	g.meter, g.reg = meter, reg
+	return nil
+}
+
+// newObservable creates the observable gauge of the type of the values,
+// with the function observing a point of the gauge.
+func (g *Gauge[T]) newObservable(meter metric.Meter, name string, options []instrument.Option) (
+	instrument.Asynchronous, func(metric.Observer, GaugePoint[T]), error) {
+	var zero T
+	if _, ok := any(zero).(float64); ok {
+		floatOptions := make([]instrument.Float64ObserverOption, 0, len(options))
+		for _, o := range options {
+			floatOptions = append(floatOptions, o)
+		}
+		gauge, err := meter.Float64ObservableGauge(name, floatOptions...)
+		if err != nil {
+			return nil, nil, err
+		}
+		return gauge, func(o metric.Observer, p GaugePoint[T]) {
+			o.ObserveFloat64(gauge, float64(p.Value), p.Attributes...)
+		}, nil
+	}
+	intOptions := make([]instrument.Int64ObserverOption, 0, len(options))
+	for _, o := range options {
+		intOptions = append(intOptions, o)
+	}
+	gauge, err := meter.Int64ObservableGauge(name, intOptions...)
+	if err != nil {
+		return nil, nil, err
+	}
+	return gauge, func(o metric.Observer, p GaugePoint[T]) {
+		o.ObserveInt64(gauge, int64(p.Value), p.Attributes...)
+	}, nil
+}
+
+// Unregister stops reporting the values of the gauge.
+func (g *Gauge[T]) Unregister() error {
+	g.mu.Lock()
+	g.points = nil
+	g.mu.Unlock()
+
+	g.regMu.Lock()
+	defer g.regMu.Unlock()
+	if g.reg == nil {
+		return nil
+	}
+	err := g.reg.Unregister()
+	g.meter, g.reg = nil, nil
+	return err
+}
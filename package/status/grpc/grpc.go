@@ -0,0 +1,333 @@
+/*******************************************************************************
+ * Copyright (c) 2023 Cedric L'homme.
+ *
+ * This file is part of otel-status.
+ *
+ * otel-status is free software: you can redistribute it and/or modify it
+ * under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License,
+ * or (at your option) any later version.
+ *
+ *  otel-status is distributed in the hope that it will be useful, but
+ *  WITHOUT ANY WARRANTY; without even the implied warranty of
+ *  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.
+ *  See the GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with otel-status. If not, see <https://www.gnu.org/licenses/>.
+ ******************************************************************************/
+
+// Package grpc is the package to get status through the gRPC health checking protocol.
+// See https://github.com/grpc/grpc/blob/master/doc/health-checking.md.
+package grpc
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"time"
+
+	"github.com/rangzen/otel-status/package/status"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/metric"
+	"go.opentelemetry.io/otel/metric/instrument"
+	"go.opentelemetry.io/otel/metric/unit"
+	"go.opentelemetry.io/otel/semconv/v1.17.0"
+	"go.opentelemetry.io/otel/trace"
+	"golang.org/x/exp/slog"
+	gogrpc "google.golang.org/grpc"
+	grpccodes "google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/credentials/insecure"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	grpcmetadata "google.golang.org/grpc/metadata"
+	grpcstatus "google.golang.org/grpc/status"
+)
+
+// PluginName is the name of the plugin.
+const PluginName = "grpc"
+
+const (
+	otelStatusGRPCName     = "otelstatus.grpc.name"
+	otelStatusGRPCAddress  = "otelstatus.grpc.address"
+	otelStatusGRPCService  = "otelstatus.grpc.service"
+	otelStatusGRPCDuration = "otelstatus.grpc.duration"
+	otelStatusGRPCError    = "otelstatus.grpc.error"
+	otelStatusGRPCStatus   = "otelstatus.grpc.status"
+	// grpcHealthStatus is the key for the serving status of the health check.
+	grpcHealthStatus = "grpc.health.status"
+)
+
+// healthService and healthMethod are the names of the RPC for the spans.
+const (
+	healthService = "grpc.health.v1.Health"
+	healthMethod  = "Check"
+)
+
+// servingStatus is the list of the serving status, indexed by their value.
+var servingStatus = [4]healthpb.HealthCheckResponse_ServingStatus{
+	healthpb.HealthCheckResponse_UNKNOWN,
+	healthpb.HealthCheckResponse_SERVING,
+	healthpb.HealthCheckResponse_NOT_SERVING,
+	healthpb.HealthCheckResponse_SERVICE_UNKNOWN,
+}
+
+// Config is the configuration for a gRPC health status.
+type Config struct {
+	status.Config `yaml:",inline"`
+	// Address is the host:port of the gRPC server.
+	Address string `yaml:"address"`
+	// Service is the name of the service to check, the whole server if empty.
+	Service string `yaml:"service"`
+	// TLS enables TLS on the connection if set, the connection is insecure otherwise.
+	TLS *status.TLSConfig `yaml:"tls"`
+	// Metadata is a map of headers to add to the request.
+	Metadata map[string]string `yaml:"metadata"`
+	// Values is a map of key/value to add to the spans.
+	Values map[string]string `yaml:"values"`
+}
+
+// GRPC is the main structure to use gRPC health status.
+type GRPC struct {
+	SC       status.Config
+	Address  string
+	Service  string
+	TLS      *status.TLSConfig
+	Metadata map[string]string
+	Values   map[string]string
+	// servingStatus reports the serving status of the latest health check.
+	servingStatus status.Gauge[int64]
+	instruments   status.Instruments[instruments]
+}
+
+// instruments are the synchronous instruments of the gRPC status.
+type instruments struct {
+	duration instrument.Int64Histogram
+	error    instrument.Int64Counter
+}
+
+// newInstruments creates the synchronous instruments of the gRPC status on the meter.
+func newInstruments(meter metric.Meter) (instruments, error) {
+	var i instruments
+	var err error
+	i.duration, err = meter.Int64Histogram(
+		otelStatusGRPCDuration,
+		instrument.WithUnit(unit.Milliseconds),
+		instrument.WithDescription("Duration of the gRPC health check"),
+	)
+	if err != nil {
+		return i, fmt.Errorf("creating gRPC health check duration metric: %w", err)
+	}
+	i.error, err = meter.Int64Counter(
+		otelStatusGRPCError,
+		instrument.WithUnit(unit.Dimensionless),
+		instrument.WithDescription("Error of the gRPC health check"),
+	)
+	if err != nil {
+		return i, fmt.Errorf("creating gRPC health check error metric: %w", err)
+	}
+	return i, nil
+}
+
+// New returns the gRPC health status of the configuration.
+func New(c Config) (*GRPC, error) {
+	if _, _, err := net.SplitHostPort(c.Address); err != nil {
+		return nil, &status.ConfigError{Field: "address", Err: err}
+	}
+	return &GRPC{
+		SC:       c.Config,
+		Address:  c.Address,
+		Service:  c.Service,
+		TLS:      c.TLS,
+		Metadata: c.Metadata,
+		Values:   c.Values,
+	}, nil
+}
+
+// Config returns the status.Config of the gRPC health status.
+func (g *GRPC) Config() status.Config {
+	return g.SC
+}
+
+// Close stops reporting the gauges of the gRPC health status.
+func (g *GRPC) Close() error {
+	return g.servingStatus.Unregister()
+}
+
+// Plugin returns the name of the gRPC plugin.
+func (g *GRPC) Plugin() string {
+	return PluginName
+}
+
+// State do the traces about the gRPC health status.
+// https://github.com/open-telemetry/opentelemetry-specification/blob/main/specification/trace/semantic_conventions/rpc.md
+func (g *GRPC) State(ctx context.Context, tracer trace.Tracer, meter metric.Meter) (status.Result, error) {
+	start := time.Now()
+	metricCtx := status.WithoutCancel(ctx)
+
+	span := g.newSpan(ctx, tracer)
+	defer span.End()
+
+	creds, err := g.credentials()
+	if err != nil {
+		return status.Result{}, g.errorHandling(metricCtx, span, meter, err, "creating gRPC credentials")
+	}
+	conn, err := gogrpc.DialContext(ctx, g.Address, gogrpc.WithTransportCredentials(creds))
+	if err != nil {
+		return status.Result{}, g.errorHandling(metricCtx, span, meter, err, "dialing gRPC server")
+	}
+	defer conn.Close()
+
+	if len(g.Metadata) > 0 {
+		ctx = grpcmetadata.NewOutgoingContext(ctx, grpcmetadata.New(g.Metadata))
+	}
+	res, err := healthpb.NewHealthClient(conn).Check(ctx, &healthpb.HealthCheckRequest{Service: g.Service})
+	span.SetAttributes(semconv.RPCGRPCStatusCodeKey.Int(int(grpcstatus.Code(err))))
+	if err != nil {
+		return status.Result{}, g.errorHandling(metricCtx, span, meter, err, "checking gRPC health")
+	}
+
+	elapsedTime := time.Since(start).Milliseconds()
+
+	slog.Info("status",
+		slog.String("plugin", PluginName),
+		slog.String("address", g.Address),
+		slog.String("service", g.Service),
+		slog.String("status", res.GetStatus().String()),
+		slog.Int64("duration", elapsedTime),
+	)
+
+	span.SetAttributes(attribute.Int64("duration", elapsedTime))
+	result := recordSpanStatus(span, res.GetStatus())
+
+	if err = g.recordMetricDuration(metricCtx, meter, elapsedTime); err != nil {
+		return status.Result{}, g.errorHandling(metricCtx, span, meter, err, "creating gRPC health duration metric")
+	}
+
+	if err = g.recordMetricStatus(meter, res.GetStatus()); err != nil {
+		return status.Result{}, g.errorHandling(metricCtx, span, meter, err, "creating gRPC health status metric")
+	}
+	return result, nil
+}
+
+// credentials returns the transport credentials of the connection.
+func (g *GRPC) credentials() (credentials.TransportCredentials, error) {
+	if g.TLS == nil {
+		return insecure.NewCredentials(), nil
+	}
+	tlsConfig, err := g.TLS.ClientConfig()
+	if err != nil {
+		return nil, err
+	}
+	return credentials.NewTLS(tlsConfig), nil
+}
+
+// newSpan creates a new span for the gRPC health check data.
+func (g *GRPC) newSpan(ctx context.Context, tracer trace.Tracer) trace.Span {
+	host, port, _ := net.SplitHostPort(g.Address)
+	_, span := tracer.Start(ctx, fmt.Sprintf("%s/%s", healthService, healthMethod),
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(
+			attribute.String(status.OtelStatusPluginName, PluginName),
+			semconv.RPCSystemGRPC,
+			semconv.RPCServiceKey.String(healthService),
+			semconv.RPCMethodKey.String(healthMethod),
+			attribute.String(otelStatusGRPCService, g.Service),
+			semconv.NetPeerNameKey.String(host),
+			semconv.NetPeerPortKey.String(port),
+		),
+		trace.WithAttributes(g.configAttributes()...),
+	)
+	return span
+}
+
+// configAttributes returns the attributes from the config.
+func (g *GRPC) configAttributes() []attribute.KeyValue {
+	var valuesAttributes []attribute.KeyValue
+	for k, v := range g.Values {
+		valuesAttributes = append(valuesAttributes, attribute.String(k, status.Redact(v)))
+	}
+	return valuesAttributes
+}
+
+// recordSpanStatus completes the span with the serving status.
+// Any status other than SERVING is an error, and the result is down.
+func recordSpanStatus(span trace.Span, servingStatus healthpb.HealthCheckResponse_ServingStatus) status.Result {
+	span.SetAttributes(attribute.String(grpcHealthStatus, servingStatus.String()))
+	if servingStatus != healthpb.HealthCheckResponse_SERVING {
+		message := fmt.Sprintf("gRPC health status %s", servingStatus)
+		span.SetStatus(codes.Error, message)
+		return status.Result{Message: message}
+	}
+	return status.Result{Up: true}
+}
+
+// metricAttributes returns the attributes common to all the metrics.
+func (g *GRPC) metricAttributes() []attribute.KeyValue {
+	return []attribute.KeyValue{
+		attribute.String(otelStatusGRPCName, g.SC.Name),
+		attribute.String(otelStatusGRPCAddress, g.Address),
+		attribute.String(otelStatusGRPCService, g.Service),
+	}
+}
+
+// recordMetricDuration records the duration of the health check in a metric.
+func (g *GRPC) recordMetricDuration(ctx context.Context, meter metric.Meter, elapsedTime int64) error {
+	inst, err := g.instruments.Get(meter, newInstruments)
+	if err != nil {
+		return err
+	}
+	inst.duration.Record(ctx, elapsedTime, g.metricAttributes()...)
+	return nil
+}
+
+// recordMetricStatus records the serving status as a breakdown by status, as for the HTTP status classes.
+// The gauge reports 1 for the status of the latest health check and 0 for the others.
+func (g *GRPC) recordMetricStatus(meter metric.Meter, current healthpb.HealthCheckResponse_ServingStatus) error {
+	points := make([]status.GaugePoint[int64], len(servingStatus))
+	for i, s := range servingStatus {
+		val := int64(0)
+		if s == current {
+			val = 1
+		}
+		points[i] = status.GaugePoint[int64]{
+			Value:      val,
+			Attributes: append(g.metricAttributes(), attribute.String(grpcHealthStatus, s.String())),
+		}
+	}
+	return g.servingStatus.Set(meter, otelStatusGRPCStatus,
+		[]instrument.Option{
+			instrument.WithUnit(unit.Dimensionless),
+			instrument.WithDescription("Status of the gRPC health check"),
+		},
+		points...,
+	)
+}
+
+// errorClass returns the class of the error, gRPC deadline errors being timeouts.
+func errorClass(err error) string {
+	if grpcstatus.Code(err) == grpccodes.DeadlineExceeded {
+		return status.ErrorClassTimeout
+	}
+	return status.ErrorClass(err)
+}
+
+// errorHandling is a helper function to handle errors.
+// It logs the error, records it in the span and in the error metric, and returns it.
+// It also records the UNKNOWN serving status.
+func (g *GRPC) errorHandling(ctx context.Context, span trace.Span, meter metric.Meter, err error, msg string) error {
+	// The metadata may contain secrets, e.g. an authorization token.
+	e := status.RedactError(fmt.Errorf("%s: %w", msg, err))
+	attributes := status.RecordError(ctx, span, PluginName, msg, e, errorClass(err))
+	if inst, err := g.instruments.Get(meter, newInstruments); err == nil {
+		inst.error.Add(ctx, 1, append(g.metricAttributes(), attributes...)...)
+	}
+
+	// The serving status of a previous health check must not be reported anymore.
+	if err = g.recordMetricStatus(meter, healthpb.HealthCheckResponse_UNKNOWN); err != nil {
+		slog.Error("creating gRPC health status metric", err, slog.String("plugin", PluginName))
+	}
+
+	return e
+}
@@ -0,0 +1,226 @@
+/*******************************************************************************
+ * Copyright (c) 2023 Cedric L'homme.
+ *
+ * This file is part of otel-status.
+ *
+ * otel-status is free software: you can redistribute it and/or modify it
+ * under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License,
+ * or (at your option) any later version.
+ *
+ *  otel-status is distributed in the hope that it will be useful, but
+ *  WITHOUT ANY WARRANTY; without even the implied warranty of
+ *  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.
+ *  See the GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with otel-status. If not, see <https://www.gnu.org/licenses/>.
+ ******************************************************************************/
+
+package grpc_test
+
+import (
+	"context"
+	"net"
+	"testing"
+
+	"github.com/rangzen/otel-status/package/status"
+	otelgrpc "github.com/rangzen/otel-status/package/status/grpc"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/sdk/metric"
+	"go.opentelemetry.io/otel/sdk/metric/metricdata"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/metadata"
+)
+
+// newServer starts an in-process gRPC server with the health service and returns its address.
+func newServer(t *testing.T, opts ...grpc.ServerOption) (string, *health.Server) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	server := grpc.NewServer(opts...)
+	healthServer := health.NewServer()
+	healthpb.RegisterHealthServer(server, healthServer)
+	go func() { _ = server.Serve(listener) }()
+	t.Cleanup(server.Stop)
+	return listener.Addr().String(), healthServer
+}
+
+func TestGRPC_State(t *testing.T) {
+	t.Run("a SERVING service, should create a span without an error status", func(t *testing.T) {
+		var gotMetadata metadata.MD
+		address, healthServer := newServer(t, grpc.UnaryInterceptor(
+			func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+				gotMetadata, _ = metadata.FromIncomingContext(ctx)
+				return handler(ctx, req)
+			}))
+		healthServer.SetServingStatus("shop.Cart", healthpb.HealthCheckResponse_SERVING)
+
+		exp := tracetest.NewInMemoryExporter()
+		tp := sdktrace.NewTracerProvider(
+			sdktrace.WithSyncer(exp),
+		)
+		mockTracer := tp.Tracer("test-tracer")
+
+		rdr := metric.NewManualReader()
+		mp := metric.NewMeterProvider(metric.WithReader(rdr))
+		mockMeter := mp.Meter("test-meter")
+
+		stater, err := otelgrpc.New(otelgrpc.Config{
+			Config: status.Config{
+				Name:        "Test",
+				Description: "Test SERVING",
+				Cron:        "@99m",
+			},
+			Address:  address,
+			Service:  "shop.Cart",
+			Metadata: map[string]string{"x-probe": "otel-status"},
+		})
+		require.NoError(t, err)
+
+		_, err = stater.State(context.Background(), mockTracer, mockMeter)
+		require.NoError(t, err)
+
+		spans := exp.GetSpans()
+		require.Len(t, spans, 1)
+		require.Equal(t, codes.Unset, spans[0].Status.Code)
+		assert.Contains(t, spans[0].Attributes, attribute.String("grpc.health.status", "SERVING"))
+		assert.Equal(t, []string{"otel-status"}, gotMetadata.Get("x-probe"))
+
+		m, err := rdr.Collect(context.Background())
+		assert.NoError(t, err)
+
+		require.Len(t, m.ScopeMetrics, 1)
+		require.Len(t, m.ScopeMetrics[0].Metrics, 2)
+	})
+
+	t.Run("a NOT_SERVING service, should create a span with an error status", func(t *testing.T) {
+		address, healthServer := newServer(t)
+		healthServer.SetServingStatus("shop.Cart", healthpb.HealthCheckResponse_NOT_SERVING)
+
+		exp := tracetest.NewInMemoryExporter()
+		tp := sdktrace.NewTracerProvider(
+			sdktrace.WithSyncer(exp),
+		)
+		mockTracer := tp.Tracer("test-tracer")
+
+		rdr := metric.NewManualReader()
+		mp := metric.NewMeterProvider(metric.WithReader(rdr))
+		mockMeter := mp.Meter("test-meter")
+
+		stater, err := otelgrpc.New(otelgrpc.Config{
+			Config: status.Config{
+				Name:        "Test",
+				Description: "Test NOT_SERVING",
+				Cron:        "@99m",
+			},
+			Address: address,
+			Service: "shop.Cart",
+		})
+		require.NoError(t, err)
+
+		_, err = stater.State(context.Background(), mockTracer, mockMeter)
+		require.NoError(t, err)
+
+		spans := exp.GetSpans()
+		require.Len(t, spans, 1)
+		require.Equal(t, codes.Error, spans[0].Status.Code)
+		assert.Contains(t, spans[0].Attributes, attribute.String("grpc.health.status", "NOT_SERVING"))
+
+		m, err := rdr.Collect(context.Background())
+		assert.NoError(t, err)
+
+		require.Len(t, m.ScopeMetrics, 1)
+		require.Len(t, m.ScopeMetrics[0].Metrics, 2)
+	})
+
+	t.Run("an unknown service, should create a span with an error status", func(t *testing.T) {
+		address, _ := newServer(t)
+
+		exp := tracetest.NewInMemoryExporter()
+		tp := sdktrace.NewTracerProvider(
+			sdktrace.WithSyncer(exp),
+		)
+		mockTracer := tp.Tracer("test-tracer")
+
+		rdr := metric.NewManualReader()
+		mp := metric.NewMeterProvider(metric.WithReader(rdr))
+		mockMeter := mp.Meter("test-meter")
+
+		stater, err := otelgrpc.New(otelgrpc.Config{
+			Config: status.Config{
+				Name:        "Test",
+				Description: "Test unknown service",
+				Cron:        "@99m",
+			},
+			Address: address,
+			Service: "unknown",
+		})
+		require.NoError(t, err)
+
+		_, err = stater.State(context.Background(), mockTracer, mockMeter)
+		require.Error(t, err)
+
+		spans := exp.GetSpans()
+		require.Len(t, spans, 1)
+		require.Equal(t, codes.Error, spans[0].Status.Code)
+
+		m, err := rdr.Collect(context.Background())
+		assert.NoError(t, err)
+
+		require.Len(t, m.ScopeMetrics, 1)
+		require.Len(t, m.ScopeMetrics[0].Metrics, 2)
+	})
+
+	t.Run("an error after a SERVING service, should report the UNKNOWN status only", func(t *testing.T) {
+		address, healthServer := newServer(t)
+		healthServer.SetServingStatus("shop.Cart", healthpb.HealthCheckResponse_SERVING)
+
+		tp := sdktrace.NewTracerProvider()
+		mockTracer := tp.Tracer("test-tracer")
+
+		rdr := metric.NewManualReader()
+		mp := metric.NewMeterProvider(metric.WithReader(rdr))
+		mockMeter := mp.Meter("test-meter")
+
+		stater, err := otelgrpc.New(otelgrpc.Config{
+			Config:  status.Config{Name: "Test", Description: "Test error", Cron: "@99m"},
+			Address: address,
+			Service: "shop.Cart",
+		})
+		require.NoError(t, err)
+
+		_, err = stater.State(context.Background(), mockTracer, mockMeter)
+		require.NoError(t, err)
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+		_, err = stater.State(ctx, mockTracer, mockMeter)
+		require.Error(t, err)
+
+		m, err := rdr.Collect(context.Background())
+		require.NoError(t, err)
+		require.Len(t, m.ScopeMetrics, 1)
+		statuses := map[string]int64{}
+		for _, mm := range m.ScopeMetrics[0].Metrics {
+			if mm.Name != "otelstatus.grpc.status" {
+				continue
+			}
+			for _, dp := range mm.Data.(metricdata.Gauge[int64]).DataPoints {
+				s, _ := dp.Attributes.Value("grpc.health.status")
+				statuses[s.AsString()] = dp.Value
+			}
+		}
+		assert.Equal(t, map[string]int64{"UNKNOWN": 1, "SERVING": 0, "NOT_SERVING": 0, "SERVICE_UNKNOWN": 0}, statuses)
+	})
+
+	t.Run("an address without port, should return an error", func(t *testing.T) {
+		_, err := otelgrpc.New(otelgrpc.Config{Address: "localhost"})
+		require.Error(t, err)
+	})
+}
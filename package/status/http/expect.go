@@ -0,0 +1,324 @@
+/*******************************************************************************
+ * Copyright (c) 2023 Cedric L'homme.
+ *
+ * This file is part of otel-status.
+ *
+ * otel-status is free software: you can redistribute it and/or modify it
+ * under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License,
+ * or (at your option) any later version.
+ *
+ *  otel-status is distributed in the hope that it will be useful, but
+ *  WITHOUT ANY WARRANTY; without even the implied warranty of
+ *  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.
+ *  See the GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with otel-status. If not, see <https://www.gnu.org/licenses/>.
+ ******************************************************************************/
+
+package http
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	nethttp "net/http"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// maxBodySize is the maximum number of bytes of the response body read for the assertions.
+const maxBodySize = 1 << 20
+
+// Expect is the configuration of the assertions on the HTTP response.
+// Every assertion must pass for the response to be considered as valid.
+type Expect struct {
+	// StatusCodes is the list of accepted status codes.
+	// An item can be a code (200), a class (2xx) or a range (200-299).
+	// If empty, any status code below 400 is accepted.
+	StatusCodes []string `yaml:"status_codes"`
+	// BodyContains is the list of substrings that must be found in the body.
+	BodyContains []string `yaml:"body_contains"`
+	// BodyRegex is the list of regular expressions that must match the body.
+	BodyRegex []string `yaml:"body_regex"`
+	// JSONPath is a map of JSONPath expressions with their expected values,
+	// e.g. "$.status": "ok" or "$.checks[0].healthy": "true".
+	JSONPath map[string]string `yaml:"json_path"`
+	// Headers is a map of headers that must be present in the response.
+	// An empty value only checks the presence of the header.
+	Headers map[string]string `yaml:"headers"`
+
+	// statusCodes and bodyRegex are the parsed StatusCodes and BodyRegex, see compile.
+	statusCodes []statusCodeRange
+	bodyRegex   []*regexp.Regexp
+}
+
+// statusCodeRange is an inclusive range of status codes.
+type statusCodeRange struct {
+	low, high int
+}
+
+// compile returns e with its status codes parsed and its regular expressions compiled.
+func (e Expect) compile() (Expect, error) {
+	e.statusCodes = make([]statusCodeRange, 0, len(e.StatusCodes))
+	for _, spec := range e.StatusCodes {
+		r, err := parseStatusCode(spec)
+		if err != nil {
+			return Expect{}, err
+		}
+		e.statusCodes = append(e.statusCodes, r)
+	}
+	e.bodyRegex = make([]*regexp.Regexp, 0, len(e.BodyRegex))
+	for _, r := range e.BodyRegex {
+		re, err := regexp.Compile(r)
+		if err != nil {
+			return Expect{}, fmt.Errorf("invalid body regex: %w", err)
+		}
+		e.bodyRegex = append(e.bodyRegex, re)
+	}
+	return e, nil
+}
+
+// assertionFailure describes a failed assertion.
+type assertionFailure struct {
+	// name is the name of the assertion, used as a metric attribute.
+	name    string
+	message string
+}
+
+// needsBody returns true if the assertions need the response body.
+func (e Expect) needsBody() bool {
+	return len(e.BodyContains) > 0 || len(e.BodyRegex) > 0 || len(e.JSONPath) > 0
+}
+
+// assert checks the response against all the assertions and returns the failed ones.
+// The assertions must be compiled, see compile.
+func (e Expect) assert(res *nethttp.Response, body []byte) []assertionFailure {
+	var failures []assertionFailure
+
+	if len(e.statusCodes) > 0 && !matchStatusCodes(e.statusCodes, res.StatusCode) {
+		failures = append(failures, assertionFailure{
+			name:    "status_code",
+			message: fmt.Sprintf("status code %d not in %v", res.StatusCode, e.StatusCodes),
+		})
+	}
+
+	for _, s := range e.BodyContains {
+		if !bytes.Contains(body, []byte(s)) {
+			failures = append(failures, assertionFailure{
+				name:    "body_contains",
+				message: fmt.Sprintf("body does not contain %q", s),
+			})
+		}
+	}
+
+	for _, re := range e.bodyRegex {
+		if !re.Match(body) {
+			failures = append(failures, assertionFailure{
+				name:    "body_regex",
+				message: fmt.Sprintf("body does not match %q", re.String()),
+			})
+		}
+	}
+
+	if len(e.JSONPath) > 0 {
+		failures = append(failures, assertJSONPath(e.JSONPath, body)...)
+	}
+
+	for k, v := range e.Headers {
+		name := "header:" + nethttp.CanonicalHeaderKey(k)
+		values, ok := res.Header[nethttp.CanonicalHeaderKey(k)]
+		switch {
+		case !ok:
+			failures = append(failures, assertionFailure{name: name, message: fmt.Sprintf("header %q is missing", k)})
+		case v != "" && !contains(values, v):
+			failures = append(failures, assertionFailure{
+				name:    name,
+				message: fmt.Sprintf("header %q is %q, expected %q", k, strings.Join(values, ", "), v),
+			})
+		}
+	}
+
+	return failures
+}
+
+// matchStatusCodes returns true if the status code is in one of the ranges.
+func matchStatusCodes(ranges []statusCodeRange, code int) bool {
+	for _, r := range ranges {
+		if code >= r.low && code <= r.high {
+			return true
+		}
+	}
+	return false
+}
+
+// parseStatusCode returns the range of status codes of the specification.
+// The specification can be a code (200), a class (2xx) or a range (200-299).
+func parseStatusCode(spec string) (statusCodeRange, error) {
+	spec = strings.TrimSpace(spec)
+	switch {
+	case len(spec) == 3 && strings.HasSuffix(strings.ToLower(spec), "xx"):
+		class, err := strconv.Atoi(spec[:1])
+		if err != nil {
+			return statusCodeRange{}, fmt.Errorf("invalid status code class %q", spec)
+		}
+		return statusCodeRange{low: class * 100, high: class*100 + 99}, nil
+	case strings.Contains(spec, "-"):
+		bounds := strings.SplitN(spec, "-", 2)
+		low, errLow := strconv.Atoi(strings.TrimSpace(bounds[0]))
+		high, errHigh := strconv.Atoi(strings.TrimSpace(bounds[1]))
+		if errLow != nil || errHigh != nil || low > high {
+			return statusCodeRange{}, fmt.Errorf("invalid status code range %q", spec)
+		}
+		return statusCodeRange{low: low, high: high}, nil
+	default:
+		code, err := strconv.Atoi(spec)
+		if err != nil {
+			return statusCodeRange{}, fmt.Errorf("invalid status code %q", spec)
+		}
+		return statusCodeRange{low: code, high: code}, nil
+	}
+}
+
+// assertJSONPath checks the JSON body against the expected values.
+func assertJSONPath(expected map[string]string, body []byte) []assertionFailure {
+	var failures []assertionFailure
+
+	var doc interface{}
+	decoder := json.NewDecoder(bytes.NewReader(body))
+	decoder.UseNumber()
+	if err := decoder.Decode(&doc); err != nil {
+		for path := range expected {
+			failures = append(failures, assertionFailure{
+				name:    "json_path:" + path,
+				message: fmt.Sprintf("decoding JSON body: %s", err),
+			})
+		}
+		return failures
+	}
+
+	for path, want := range expected {
+		got, err := evalJSONPath(doc, path)
+		if err != nil {
+			failures = append(failures, assertionFailure{name: "json_path:" + path, message: err.Error()})
+			continue
+		}
+		if !jsonEqual(got, want) {
+			failures = append(failures, assertionFailure{
+				name:    "json_path:" + path,
+				message: fmt.Sprintf("%s is %s, expected %s", path, jsonString(got), want),
+			})
+		}
+	}
+	return failures
+}
+
+// evalJSONPath returns the value at the given path in the document.
+// Only a subset of JSONPath is supported: $.field, $['field'] and $.array[0].
+func evalJSONPath(doc interface{}, path string) (interface{}, error) {
+	if !strings.HasPrefix(path, "$") {
+		return nil, fmt.Errorf("JSONPath %q must start with $", path)
+	}
+	current := doc
+	rest := path[1:]
+	for rest != "" {
+		switch rest[0] {
+		case '.':
+			rest = rest[1:]
+			end := strings.IndexAny(rest, ".[")
+			if end == -1 {
+				end = len(rest)
+			}
+			key := rest[:end]
+			rest = rest[end:]
+			if key == "" {
+				return nil, fmt.Errorf("JSONPath %q has an empty field", path)
+			}
+			obj, ok := current.(map[string]interface{})
+			if !ok {
+				return nil, fmt.Errorf("JSONPath %q: %q is not an object", path, key)
+			}
+			if current, ok = obj[key]; !ok {
+				return nil, fmt.Errorf("JSONPath %q: field %q not found", path, key)
+			}
+		case '[':
+			end := strings.Index(rest, "]")
+			if end == -1 {
+				return nil, fmt.Errorf("JSONPath %q has an unclosed bracket", path)
+			}
+			selector := rest[1:end]
+			rest = rest[end+1:]
+			if unquoted := strings.Trim(selector, `'"`); unquoted != selector {
+				obj, ok := current.(map[string]interface{})
+				if !ok {
+					return nil, fmt.Errorf("JSONPath %q: %q is not an object", path, unquoted)
+				}
+				if current, ok = obj[unquoted]; !ok {
+					return nil, fmt.Errorf("JSONPath %q: field %q not found", path, unquoted)
+				}
+				continue
+			}
+			index, err := strconv.Atoi(selector)
+			if err != nil {
+				return nil, fmt.Errorf("JSONPath %q: invalid index %q", path, selector)
+			}
+			arr, ok := current.([]interface{})
+			if !ok {
+				return nil, fmt.Errorf("JSONPath %q: [%d] is not an array", path, index)
+			}
+			if index < 0 || index >= len(arr) {
+				return nil, fmt.Errorf("JSONPath %q: index %d out of range", path, index)
+			}
+			current = arr[index]
+		default:
+			return nil, fmt.Errorf("JSONPath %q is invalid", path)
+		}
+	}
+	return current, nil
+}
+
+// jsonEqual returns true if the JSON value is equal to the expected string.
+// Numbers are compared numerically, so 1 and 1.0 are equal.
+func jsonEqual(got interface{}, want string) bool {
+	if n, ok := got.(json.Number); ok {
+		gotF, errGot := n.Float64()
+		wantF, errWant := strconv.ParseFloat(want, 64)
+		if errGot == nil && errWant == nil {
+			return gotF == wantF
+		}
+	}
+	return jsonString(got) == want
+}
+
+// jsonString returns the string representation of a JSON value.
+// Strings are returned without quotes.
+func jsonString(v interface{}) string {
+	switch t := v.(type) {
+	case string:
+		return t
+	case json.Number:
+		return t.String()
+	case nil:
+		return "null"
+	case bool:
+		return strconv.FormatBool(t)
+	default:
+		data, err := json.Marshal(t)
+		if err != nil {
+			return fmt.Sprint(t)
+		}
+		return string(data)
+	}
+}
+
+// contains returns true if the value is in the slice.
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
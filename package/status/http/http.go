@@ -21,19 +21,28 @@
 package http
 
 import (
+	"bytes"
 	"context"
+	"crypto/tls"
+	"crypto/x509"
 	"fmt"
+	"io"
 	nethttp "net/http"
+	"net/http/httptrace"
 	neturl "net/url"
+	"os"
 	"strconv"
+	"strings"
 	"time"
 
 	"github.com/rangzen/otel-status/package/status"
+	"go.opentelemetry.io/otel"
 	"go.opentelemetry.io/otel/attribute"
 	"go.opentelemetry.io/otel/codes"
 	"go.opentelemetry.io/otel/metric"
 	"go.opentelemetry.io/otel/metric/instrument"
 	"go.opentelemetry.io/otel/metric/unit"
+	"go.opentelemetry.io/otel/propagation"
 	"go.opentelemetry.io/otel/semconv/v1.17.0"
 	"go.opentelemetry.io/otel/trace"
 	"golang.org/x/exp/slog"
@@ -47,19 +56,98 @@ const (
 	otelStatusHTTPDuration = "otelstatus.http.duration"
 	otelStatusHTTPError    = "otelstatus.http.error"
 	otelStatusHTTPStatus   = "otelstatus.http.status"
+	// otelStatusHTTPAssertionFailure is the counter of failed assertions.
+	otelStatusHTTPAssertionFailure = "otelstatus.http.assertion.failure"
+	// otelStatusHTTPAssertion is the key for the name of the failed assertion.
+	otelStatusHTTPAssertion = "otelstatus.http.assertion"
+	// otelStatusHTTPPhaseDuration is the histogram of the duration of each phase of the request.
+	otelStatusHTTPPhaseDuration = "otelstatus.http.phase.duration"
+	// otelStatusHTTPPhase is the key for the name of the phase, see phaseTimer.
+	otelStatusHTTPPhase = "phase"
+	// otelStatusHTTPTLSExpiry is the gauge of the days before the expiration of the certificate.
+	otelStatusHTTPTLSExpiry = "otelstatus.http.tls.expiry"
 )
 
+// defaultAPIKeyHeader is the header used for API key authentication when none is configured.
+const defaultAPIKeyHeader = "X-API-Key"
+
 var httpStatusClass = [5]string{"1xx", "2xx", "3xx", "4xx", "5xx"}
 
+var validMethods = map[string]bool{
+	nethttp.MethodGet:     true,
+	nethttp.MethodHead:    true,
+	nethttp.MethodPost:    true,
+	nethttp.MethodPut:     true,
+	nethttp.MethodPatch:   true,
+	nethttp.MethodDelete:  true,
+	nethttp.MethodConnect: true,
+	nethttp.MethodOptions: true,
+	nethttp.MethodTrace:   true,
+}
+
 // Config is the configuration for an HTTP status.
 type Config struct {
-	Name        string `yaml:"name"`
-	Description string `yaml:"description"`
-	Cron        string `yaml:"cron" default:"@10m"`
-	Method      string `yaml:"method" default:"GET"`
-	URL         string `yaml:"url"`
+	status.Config `yaml:",inline"`
+	Method        string `yaml:"method" default:"GET"`
+	URL           string `yaml:"url"`
 	// Values is a map of key/value to add to the spans. See recordMetricStatus.
 	Values map[string]string `yaml:"values"`
+	// Headers is a map of headers to add to the request.
+	Headers map[string]string `yaml:"headers"`
+	// Body is the inline body of the request.
+	Body string `yaml:"body"`
+	// BodyFile is the path of a file to use as the body of the request.
+	// It takes precedence over Body.
+	BodyFile string `yaml:"body_file"`
+	// Auth is the authentication to use for the request.
+	Auth Auth `yaml:"auth"`
+	// Expect is the assertions on the response.
+	Expect Expect `yaml:"expect"`
+	// TLS is the TLS configuration for HTTPS URLs.
+	TLS status.TLSConfig `yaml:"tls"`
+	// Propagate injects the trace context of the check in the request headers.
+	Propagate bool `yaml:"propagate"`
+}
+
+// Auth is the authentication configuration of an HTTP status.
+// Only one of the authentication methods should be set.
+type Auth struct {
+	Basic  *BasicAuth  `yaml:"basic"`
+	Bearer *BearerAuth `yaml:"bearer"`
+	APIKey *APIKeyAuth `yaml:"api_key"`
+}
+
+// BasicAuth is the configuration for HTTP basic authentication.
+type BasicAuth struct {
+	Username string `yaml:"username"`
+	Password string `yaml:"password" secret:"true"`
+}
+
+// BearerAuth is the configuration for bearer token authentication.
+type BearerAuth struct {
+	Token string `yaml:"token" secret:"true"`
+}
+
+// APIKeyAuth is the configuration for API key authentication through a header.
+type APIKeyAuth struct {
+	// Header is the name of the header, X-API-Key if empty.
+	Header string `yaml:"header"`
+	Value  string `yaml:"value" secret:"true"`
+}
+
+// secrets returns the secrets of the authentication methods that are set.
+func (a Auth) secrets() []string {
+	var secrets []string
+	if a.Basic != nil {
+		secrets = append(secrets, a.Basic.Password)
+	}
+	if a.Bearer != nil {
+		secrets = append(secrets, a.Bearer.Token)
+	}
+	if a.APIKey != nil {
+		secrets = append(secrets, a.APIKey.Value)
+	}
+	return secrets
 }
 
 // HTTP is the main structure to use HTTP status.
@@ -68,8 +156,114 @@ type HTTP struct {
 	Method string
 	URL    *neturl.URL
 	Values map[string]string
-	// previousClass is the previous state of the HTTP status class metric.
-	previousClass [5]bool
+	// Headers is a map of headers to add to the request.
+	Headers map[string]string
+	// Body is the inline body of the request.
+	Body string
+	// BodyFile is the path of a file read at each request to use as the body.
+	BodyFile string
+	// Auth is the authentication to use for the request.
+	Auth Auth
+	// Expect is the assertions on the response.
+	Expect Expect
+	// TLS is the TLS configuration for HTTPS URLs.
+	TLS status.TLSConfig
+	// Propagate injects the trace context of the check in the request headers.
+	Propagate bool
+	// tlsExpiry reports the days before the expiration of the certificate.
+	tlsExpiry status.Gauge[int64]
+	// statusClass reports the status class of the latest response.
+	statusClass status.Gauge[int64]
+	// instruments are created once per meter.
+	instruments status.Instruments[instruments]
+}
+
+// instruments are the synchronous instruments of the HTTP status.
+type instruments struct {
+	duration         instrument.Int64Histogram
+	phaseDuration    instrument.Float64Histogram
+	assertionFailure instrument.Int64Counter
+	error            instrument.Int64Counter
+}
+
+// newInstruments creates the synchronous instruments of the HTTP status on the meter.
+func newInstruments(meter metric.Meter) (instruments, error) {
+	var i instruments
+	var err error
+	i.duration, err = meter.Int64Histogram(
+		otelStatusHTTPDuration,
+		instrument.WithUnit(unit.Milliseconds),
+		instrument.WithDescription("Duration of the HTTP request"),
+	)
+	if err != nil {
+		return i, fmt.Errorf("creating HTTP request duration metric: %w", err)
+	}
+	i.phaseDuration, err = meter.Float64Histogram(
+		otelStatusHTTPPhaseDuration,
+		instrument.WithUnit(unit.Milliseconds),
+		instrument.WithDescription("Duration of each phase of the HTTP request"),
+	)
+	if err != nil {
+		return i, fmt.Errorf("creating HTTP request phase duration metric: %w", err)
+	}
+	i.assertionFailure, err = meter.Int64Counter(
+		otelStatusHTTPAssertionFailure,
+		instrument.WithUnit(unit.Dimensionless),
+		instrument.WithDescription("Failed assertions on the HTTP response"),
+	)
+	if err != nil {
+		return i, fmt.Errorf("creating HTTP assertion failure metric: %w", err)
+	}
+	i.error, err = meter.Int64Counter(
+		otelStatusHTTPError,
+		instrument.WithUnit(unit.Dimensionless),
+		instrument.WithDescription("Error of the HTTP request"),
+	)
+	if err != nil {
+		return i, fmt.Errorf("creating HTTP request error metric: %w", err)
+	}
+	return i, nil
+}
+
+// New returns the HTTP status of the configuration.
+func New(c Config) (*HTTP, error) {
+	url, err := neturl.Parse(c.URL)
+	if err != nil {
+		return nil, &status.ConfigError{Field: "url", Err: err}
+	}
+	if url.Scheme != "http" && url.Scheme != "https" {
+		return nil, &status.ConfigError{Field: "url", Err: fmt.Errorf("scheme of %q must be http or https", c.URL)}
+	}
+	if url.Host == "" {
+		return nil, &status.ConfigError{Field: "url", Err: fmt.Errorf("no host in %q", c.URL)}
+	}
+	method := strings.ToUpper(c.Method)
+	if method == "" {
+		method = nethttp.MethodGet
+	}
+	if !validMethods[method] {
+		return nil, &status.ConfigError{Field: "method", Err: fmt.Errorf("unknown method %q", c.Method)}
+	}
+	expect, err := c.Expect.compile()
+	if err != nil {
+		return nil, &status.ConfigError{Field: "expect", Err: err}
+	}
+	for _, secret := range c.Auth.secrets() {
+		status.RegisterSecret(secret)
+	}
+	return &HTTP{
+		SC:        c.Config,
+		Method:    method,
+		URL:       url,
+		Values:    c.Values,
+		Headers:   c.Headers,
+		Body:      c.Body,
+		BodyFile:  c.BodyFile,
+		Auth:      c.Auth,
+		Expect:    expect,
+		TLS:       c.TLS,
+		Propagate: c.Propagate,
+	}, nil
 }
 
 // Config returns the status.Config of the HTTP status.
@@ -77,55 +271,117 @@ func (h *HTTP) Config() status.Config {
 	return h.SC
 }
 
+// Close stops reporting the gauges of the HTTP status.
+func (h *HTTP) Close() error {
+	err := h.statusClass.Unregister()
+	if tlsErr := h.tlsExpiry.Unregister(); tlsErr != nil && err == nil {
+		err = tlsErr
+	}
+	return err
+}
+
+// Plugin returns the name of the HTTP plugin.
+func (h *HTTP) Plugin() string {
+	return PluginName
+}
+
 // State do the traces about the HTTP status.
 // https://github.com/open-telemetry/opentelemetry-specification/blob/main/specification/trace/semantic_conventions/http.md
-func (h *HTTP) State(tracer trace.Tracer, meter metric.Meter) error {
-	ctx := context.Background()
+func (h *HTTP) State(ctx context.Context, tracer trace.Tracer, meter metric.Meter) (status.Result, error) {
 	start := time.Now()
+	// Metrics are dropped with a done context, e.g. after a timeout.
+	metricCtx := status.WithoutCancel(ctx)
 
-	span := h.newSpan(ctx, tracer)
+	ctx, span := h.newSpan(ctx, tracer)
 	// defer calls are used as a LIFO, so defer that ends the span
 	// should be the first defer of this function, then it will be called in last.
 	defer span.End()
 
 	// Create the HTTP request.
-	req, err := nethttp.NewRequest(h.Method, h.URL.String(), nethttp.NoBody)
+	reqBody, err := h.body()
 	if err != nil {
-		return h.errorHandling(ctx, span, meter, err, "creating HTTP request")
+		return status.Result{}, h.errorHandling(metricCtx, span, meter, err, "reading HTTP request body")
 	}
+	req, err := nethttp.NewRequestWithContext(ctx, h.Method, h.URL.String(), reqBody)
+	if err != nil {
+		return status.Result{}, h.errorHandling(metricCtx, span, meter, err, "creating HTTP request")
+	}
+	h.setHeaders(req)
+	h.Auth.apply(req)
+	if h.Propagate {
+		otel.GetTextMapPropagator().Inject(ctx, propagation.HeaderCarrier(req.Header))
+	}
+	timer := &phaseTimer{}
+	req = req.WithContext(httptrace.WithClientTrace(req.Context(), timer.clientTrace()))
 
 	// Do the HTTP request.
-	client := &nethttp.Client{}
+	client, err := h.client()
+	if err != nil {
+		return status.Result{}, h.errorHandling(metricCtx, span, meter, err, "creating HTTP client")
+	}
 	res, err := client.Do(req)
 	if err != nil {
-		return h.errorHandling(ctx, span, meter, err, "doing HTTP client")
+		recordSpanPhases(ctx, tracer, timer.phases())
+		// The expiry is still known when the verification of the certificate fails, e.g. once expired.
+		if leaf := status.FailedCertificate(err); leaf != nil {
+			if tlsErr := h.recordMetricTLSExpiry(meter, &tls.ConnectionState{PeerCertificates: []*x509.Certificate{leaf}}); tlsErr != nil {
+				slog.Error("creating HTTP TLS expiry metric", tlsErr, slog.String("plugin", PluginName))
+			}
+		}
+		return status.Result{}, h.errorHandling(metricCtx, span, meter, err, "doing HTTP client")
 	}
 	defer res.Body.Close()
 
 	elapsedTime := time.Since(start).Milliseconds()
 
+	resBody, err := h.readBody(res)
+	timer.markBodyDone()
+	recordSpanPhases(ctx, tracer, timer.phases())
+	if err != nil {
+		return status.Result{}, h.errorHandling(metricCtx, span, meter, err, "reading HTTP response body")
+	}
+
 	slog.Info("status",
 		slog.String("plugin", PluginName),
-		slog.String("url", h.URL.String()),
+		slog.String("url", h.redactedURL()),
 		slog.String("status", strconv.Itoa(res.StatusCode)),
 		slog.Int64("duration", elapsedTime),
 	)
 
 	recordSpanDuration(span, elapsedTime)
 
-	recordSpanStatus(span, res)
+	message := recordSpanStatus(span, res, h.Expect)
+
+	if res.TLS != nil {
+		span.SetAttributes(status.TLSAttributes(res.TLS)...)
+		if err = h.recordMetricTLSExpiry(meter, res.TLS); err != nil {
+			return status.Result{}, h.errorHandling(metricCtx, span, meter, err, "creating HTTP TLS expiry metric")
+		}
+	}
 
-	if err = h.recordMetricDuration(ctx, span, meter, elapsedTime); err != nil {
-		return err
+	if failures := h.recordAssertions(metricCtx, span, meter, h.Expect.assert(res, resBody)); failures != "" {
+		message = failures
 	}
 
-	return h.recordMetricStatus(ctx, span, meter, err, res)
+	if err = h.recordMetricDuration(metricCtx, span, meter, elapsedTime); err != nil {
+		return status.Result{}, err
+	}
+
+	if err = h.recordMetricPhases(metricCtx, span, meter, timer.phases()); err != nil {
+		return status.Result{}, err
+	}
+
+	if err = h.recordMetricStatus(metricCtx, span, meter, res); err != nil {
+		return status.Result{}, err
+	}
+	return status.Result{Up: message == "", Message: message}, nil
 }
 
 // newSpan creates a new span for the HTTP request data.
-func (h *HTTP) newSpan(ctx context.Context, tracer trace.Tracer) trace.Span {
+// The returned context contains the span.
+func (h *HTTP) newSpan(ctx context.Context, tracer trace.Tracer) (context.Context, trace.Span) {
 	// Create a span.
-	_, span := tracer.Start(ctx, fmt.Sprintf("%s %s", h.Method, h.URL),
+	ctx, span := tracer.Start(ctx, fmt.Sprintf("%s %s", h.Method, h.redactedURL()),
 		trace.WithSpanKind(trace.SpanKindClient),
 		trace.WithAttributes(
 			attribute.String(status.OtelStatusPluginName, PluginName),
@@ -136,15 +392,93 @@ func (h *HTTP) newSpan(ctx context.Context, tracer trace.Tracer) trace.Span {
 
 	span.SetAttributes(
 		semconv.HTTPSchemeKey.String(h.URL.Scheme),
-		semconv.HTTPURLKey.String(h.URL.String()),
+		semconv.HTTPURLKey.String(h.redactedURL()),
 		// As server
-		semconv.NetHostNameKey.String(h.URL.Hostname()),
-		semconv.NetHostPortKey.String(h.URL.Port()),
+		semconv.NetHostNameKey.String(status.Redact(h.URL.Hostname())),
+		semconv.NetHostPortKey.String(status.Redact(h.URL.Port())),
 		// As client
-		semconv.NetPeerNameKey.String(h.URL.Hostname()),
-		semconv.NetPeerPortKey.String(h.URL.Port()),
+		semconv.NetPeerNameKey.String(status.Redact(h.URL.Hostname())),
+		semconv.NetPeerPortKey.String(status.Redact(h.URL.Port())),
 	)
-	return span
+	return ctx, span
+}
+
+// client returns a new HTTP client for the check.
+// Connections are not kept alive to measure a complete request at each check.
+func (h *HTTP) client() (*nethttp.Client, error) {
+	tlsConfig, err := h.TLS.ClientConfig()
+	if err != nil {
+		return nil, err
+	}
+	transport := nethttp.DefaultTransport.(*nethttp.Transport).Clone()
+	transport.TLSClientConfig = tlsConfig
+	transport.DisableKeepAlives = true
+	return &nethttp.Client{Transport: transport}, nil
+}
+
+// body returns the body of the HTTP request.
+// The file is read at each call so that changes are taken into account without a restart.
+func (h *HTTP) body() (io.Reader, error) {
+	switch {
+	case h.BodyFile != "":
+		data, err := os.ReadFile(h.BodyFile)
+		if err != nil {
+			return nil, err
+		}
+		return bytes.NewReader(data), nil
+	case h.Body != "":
+		return strings.NewReader(h.Body), nil
+	default:
+		return nethttp.NoBody, nil
+	}
+}
+
+// readBody reads the whole body of the response to measure its transfer.
+// Only the beginning of the body is kept, and only if needed by the assertions.
+func (h *HTTP) readBody(res *nethttp.Response) ([]byte, error) {
+	var body []byte
+	if h.Expect.needsBody() {
+		var err error
+		body, err = io.ReadAll(io.LimitReader(res.Body, maxBodySize))
+		if err != nil {
+			return nil, err
+		}
+	}
+	_, err := io.Copy(io.Discard, res.Body)
+	return body, err
+}
+
+// setHeaders adds the configured headers to the HTTP request.
+// The Host header is special in Go and must be set on the request itself.
+func (h *HTTP) setHeaders(req *nethttp.Request) {
+	for k, v := range h.Headers {
+		if nethttp.CanonicalHeaderKey(k) == "Host" {
+			req.Host = v
+			continue
+		}
+		req.Header.Set(k, v)
+	}
+}
+
+// apply adds the authentication to the HTTP request.
+func (a Auth) apply(req *nethttp.Request) {
+	switch {
+	case a.Basic != nil:
+		req.SetBasicAuth(a.Basic.Username, a.Basic.Password)
+	case a.Bearer != nil:
+		req.Header.Set("Authorization", "Bearer "+a.Bearer.Token)
+	case a.APIKey != nil:
+		header := a.APIKey.Header
+		if header == "" {
+			header = defaultAPIKeyHeader
+		}
+		req.Header.Set(header, a.APIKey.Value)
+	}
+}
+
+// redactedURL returns the URL without the secrets of the configuration.
+func (h *HTTP) redactedURL() string {
+	return status.Redact(h.URL.String())
 }
 
 // configAttributes returns the attributes from the config.
@@ -152,7 +486,7 @@ func (h *HTTP) configAttributes() []attribute.KeyValue {
 	// Prepare additional attributes from config.
 	var valuesAttributes []attribute.KeyValue
 	for k, v := range h.Values {
-		valuesAttributes = append(valuesAttributes, attribute.String(k, v))
+		valuesAttributes = append(valuesAttributes, attribute.String(k, status.Redact(v)))
 	}
 	return valuesAttributes
 }
@@ -164,89 +498,180 @@ func recordSpanDuration(span trace.Span, elapsedTime int64) {
 	)
 }
 
+// recordSpanPhases adds a child span for each phase of the HTTP request.
+// ctx must contain the span of the check.
+func recordSpanPhases(ctx context.Context, tracer trace.Tracer, phases []phase) {
+	for _, p := range phases {
+		_, child := tracer.Start(ctx, p.name,
+			trace.WithTimestamp(p.start),
+			trace.WithAttributes(attribute.String(otelStatusHTTPPhase, p.name)),
+		)
+		if p.err != nil {
+			child.RecordError(p.err)
+			child.SetStatus(codes.Error, p.err.Error())
+		}
+		child.End(trace.WithTimestamp(p.end))
+	}
+}
+
 // recordSpanStatus completes the span with the HTTP response status.
-func recordSpanStatus(span trace.Span, res *nethttp.Response) {
+// Without expected status codes, any status code from 400 is an error.
+// It returns the status message of the error, empty if there is none.
+func recordSpanStatus(span trace.Span, res *nethttp.Response, expect Expect) string {
 	span.SetAttributes(
 		semconv.HTTPStatusCodeKey.Int(res.StatusCode),
 	)
-	if res.StatusCode >= 400 {
-		span.SetStatus(codes.Error, fmt.Sprintf("HTTP status code %d", res.StatusCode))
+	if len(expect.StatusCodes) == 0 && res.StatusCode >= 400 {
+		message := fmt.Sprintf("HTTP status code %d", res.StatusCode)
+		span.SetStatus(codes.Error, message)
+		return message
 	}
+	return ""
+}
+
+// recordAssertions completes the span with the failed assertions and records them in a metric.
+// It returns the status message of the failures, empty if there is none.
+func (h *HTTP) recordAssertions(ctx context.Context, span trace.Span, meter metric.Meter, failures []assertionFailure) string {
+	if len(failures) == 0 {
+		return ""
+	}
+
+	messages := make([]string, 0, len(failures))
+	for _, f := range failures {
+		messages = append(messages, f.message)
+		span.AddEvent("assertion failed", trace.WithAttributes(
+			attribute.String(otelStatusHTTPAssertion, f.name),
+			attribute.String("message", f.message),
+		))
+	}
+	message := strings.Join(messages, "; ")
+	span.SetStatus(codes.Error, message)
+
+	slog.Warn("assertions failed",
+		slog.String("plugin", PluginName),
+		slog.String("url", h.redactedURL()),
+		slog.String("failures", message),
+	)
+
+	inst, err := h.instruments.Get(meter, newInstruments)
+	if err != nil {
+		slog.Error("creating HTTP metrics", err, slog.String("plugin", PluginName))
+		return message
+	}
+	for _, f := range failures {
+		inst.assertionFailure.Add(ctx, 1,
+			attribute.String(otelStatusHTTPName, h.SC.Name),
+			semconv.HTTPURLKey.String(h.redactedURL()),
+			attribute.String(otelStatusHTTPAssertion, f.name),
+		)
+	}
+	return message
 }
 
 // recordMetricDuration records the duration of the HTTP request in a metric.
 func (h *HTTP) recordMetricDuration(ctx context.Context, span trace.Span, meter metric.Meter, elapsedTime int64) error {
-	durationMetric, err := meter.Int64Histogram(
-		otelStatusHTTPDuration,
-		instrument.WithUnit(unit.Milliseconds),
-		instrument.WithDescription("Duration of the HTTP request"),
-	)
+	inst, err := h.instruments.Get(meter, newInstruments)
 	if err != nil {
-		return h.errorHandling(ctx, span, meter, err, "creating HTTP request duration metric")
+		return h.errorHandling(ctx, span, meter, err, "creating HTTP metrics")
 	}
-	durationMetric.Record(ctx, elapsedTime,
+	inst.duration.Record(ctx, elapsedTime,
 		attribute.String(otelStatusHTTPName, h.SC.Name),
-		semconv.HTTPURLKey.String(h.URL.String()),
+		semconv.HTTPURLKey.String(h.redactedURL()),
 	)
 	return nil
 }
 
-// recordMetricStatus records the family status as a compromise between the number of metrics and the number of labels in the meter.
-// We need to keep an internal state to know if the status has changed,
-// and calculate the value to add to mimic the 0 or 1 values.
-// We cannot achieve the same behaviour as httpcheck with the current SDK,
-// there is no Int64Gauge.
-func (h *HTTP) recordMetricStatus(ctx context.Context, span trace.Span, meter metric.Meter, err error, res *nethttp.Response) error {
-	statusMetric, err := meter.Int64UpDownCounter(
-		otelStatusHTTPStatus,
-		instrument.WithUnit(unit.Dimensionless),
-		instrument.WithDescription("Status of the HTTP request"),
-	)
+// recordMetricPhases records the duration of each phase of the HTTP request in a metric.
+func (h *HTTP) recordMetricPhases(ctx context.Context, span trace.Span, meter metric.Meter, phases []phase) error {
+	inst, err := h.instruments.Get(meter, newInstruments)
 	if err != nil {
+		return h.errorHandling(ctx, span, meter, err, "creating HTTP metrics")
+	}
+	for _, p := range phases {
+		inst.phaseDuration.Record(ctx, float64(p.end.Sub(p.start))/float64(time.Millisecond),
+			attribute.String(otelStatusHTTPName, h.SC.Name),
+			semconv.HTTPURLKey.String(h.redactedURL()),
+			attribute.String(otelStatusHTTPPhase, p.name),
+		)
+	}
+	return nil
+}
+
+// recordMetricTLSExpiry records the days before the expiration of the leaf certificate in a gauge.
+func (h *HTTP) recordMetricTLSExpiry(meter metric.Meter, state *tls.ConnectionState) error {
+	days, ok := status.CertificateExpiryDays(state, time.Now())
+	if !ok {
+		return nil
+	}
+	return h.tlsExpiry.Set(meter, otelStatusHTTPTLSExpiry,
+		[]instrument.Option{
+			instrument.WithUnit("d"),
+			instrument.WithDescription("Days before the expiration of the HTTPS certificate"),
+		},
+		status.GaugePoint[int64]{
+			Value: days,
+			Attributes: []attribute.KeyValue{
+				attribute.String(otelStatusHTTPName, h.SC.Name),
+				semconv.HTTPURLKey.String(h.redactedURL()),
+			},
+		},
+	)
+}
+
+// recordMetricStatus records the family status as a compromise between the number of metrics and the number of labels in the meter.
+// The gauge reports 1 for the status class of the latest response and 0 for the others.
+func (h *HTTP) recordMetricStatus(ctx context.Context, span trace.Span, meter metric.Meter, res *nethttp.Response) error {
+	if err := h.setMetricStatusClass(meter, (res.StatusCode/100)-1); err != nil {
 		return h.errorHandling(ctx, span, meter, err, "creating HTTP request status metric")
 	}
-	statusClassIndex := (res.StatusCode / 100) - 1
-	for i := 0; i < len(httpStatusClass); i++ {
+	return nil
+}
+
+// setMetricStatusClass sets the gauge of the status classes to 1 for the class at index and 0 for the others,
+// all 0 if the index is out of the classes, e.g. -1 without response.
+func (h *HTTP) setMetricStatusClass(meter metric.Meter, statusClassIndex int) error {
+	points := make([]status.GaugePoint[int64], len(httpStatusClass))
+	for i := range httpStatusClass {
 		val := int64(0)
-		switch {
-		case h.previousClass[i] && i != statusClassIndex:
-			val = -1
-		case !h.previousClass[i] && i == statusClassIndex:
+		if i == statusClassIndex {
 			val = 1
 		}
-		statusMetric.Add(ctx, val,
-			attribute.String(otelStatusHTTPName, h.SC.Name),
-			semconv.HTTPURLKey.String(h.URL.String()),
-			semconv.HTTPStatusCodeKey.Int(res.StatusCode),
-			semconv.HTTPMethodKey.String(h.Method),
-			attribute.String("http.status_class", httpStatusClass[i]))
-
-		h.previousClass[i] = i == statusClassIndex
+		points[i] = status.GaugePoint[int64]{
+			Value: val,
+			Attributes: []attribute.KeyValue{
+				attribute.String(otelStatusHTTPName, h.SC.Name),
+				semconv.HTTPURLKey.String(h.redactedURL()),
+				semconv.HTTPMethodKey.String(h.Method),
+				attribute.String("http.status_class", httpStatusClass[i]),
+			},
+		}
 	}
-	return nil
+	return h.statusClass.Set(meter, otelStatusHTTPStatus,
+		[]instrument.Option{
+			instrument.WithUnit(unit.Dimensionless),
+			instrument.WithDescription("Status class of the latest HTTP response"),
+		},
+		points...,
+	)
 }
 
 // errorHandling is a helper function to handle errors.
-// It logs the error, records it in the span and returns it.
-// It also records the error metric.
+// It logs the error, records it in the span and in the error metric, and returns it.
+// It also reports no status class, there is no response.
 func (h *HTTP) errorHandling(ctx context.Context, span trace.Span, meter metric.Meter, err error, msg string) error {
-	e := fmt.Errorf("%s: %w", msg, err)
-	slog.Error(msg, e, slog.String("plugin", PluginName))
-	span.RecordError(e)
-	span.SetStatus(codes.Error, e.Error())
-
-	// Record the metric error.
-	errorMetric, err := meter.Int64Counter(
-		otelStatusHTTPError,
-		instrument.WithUnit(unit.Dimensionless),
-		instrument.WithDescription("Error of the HTTP request"),
-	)
-	if err == nil {
-		errorMetric.Add(ctx, 1,
+	// The configuration may contain secrets, e.g. in the URL.
+	e := status.RedactError(fmt.Errorf("%s: %w", msg, err))
+	attributes := status.RecordError(ctx, span, PluginName, msg, e, status.ErrorClass(e))
+	if inst, err := h.instruments.Get(meter, newInstruments); err == nil {
+		inst.error.Add(ctx, 1, append([]attribute.KeyValue{
 			attribute.String(otelStatusHTTPName, h.SC.Name),
-			semconv.HTTPURLKey.String(h.URL.String()),
-			attribute.String("error.message", e.Error()),
-		)
+			semconv.HTTPURLKey.String(h.redactedURL()),
+		}, attributes...)...)
+	}
+
+	// The status class of a previous response must not be reported anymore.
+	if err = h.setMetricStatusClass(meter, -1); err != nil {
+		slog.Error("creating HTTP request status metric", err, slog.String("plugin", PluginName))
 	}
 
 	return e
@@ -21,19 +21,29 @@ package http_test
 
 import (
 	"context"
+	"encoding/pem"
+	"io"
 	"net/http"
 	"net/http/httptest"
 	"net/url"
+	"os"
+	"path/filepath"
 	"testing"
+	"time"
 
 	"github.com/rangzen/otel-status/package/status"
 	otelhttp "github.com/rangzen/otel-status/package/status/http"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
 	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
 	"go.opentelemetry.io/otel/sdk/metric"
+	"go.opentelemetry.io/otel/sdk/metric/metricdata"
 	sdktrace "go.opentelemetry.io/otel/sdk/trace"
 	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
 )
 
 func TestHTTP_Status(t *testing.T) {
@@ -69,24 +79,24 @@ func TestHTTP_Status(t *testing.T) {
 			Values: nil,
 		}
 
-		err = stater.State(mockTracer, mockMeter)
+		res, err := stater.State(context.Background(), mockTracer, mockMeter)
 		require.NoError(t, err)
+		require.True(t, res.Up)
 
 		ctx := context.Background()
 		// Assert span
 		err = tp.ForceFlush(ctx)
 		require.NoError(t, err)
 
-		spans := exp.GetSpans()
-		require.Len(t, spans, 1)
-		require.Equal(t, codes.Unset, spans[0].Status.Code)
+		span := checkSpan(t, exp.GetSpans())
+		require.Equal(t, codes.Unset, span.Status.Code)
 
 		// Assert metric
 		m, err := rdr.Collect(ctx)
 		assert.NoError(t, err)
 
 		require.Len(t, m.ScopeMetrics, 1)
-		require.Len(t, m.ScopeMetrics[0].Metrics, 2)
+		require.Len(t, m.ScopeMetrics[0].Metrics, 3)
 	})
 
 	t.Run("a 401 error, should create a span with an error status", func(t *testing.T) {
@@ -121,24 +131,25 @@ func TestHTTP_Status(t *testing.T) {
 			Values: nil,
 		}
 
-		err = stater.State(mockTracer, mockMeter)
+		res, err := stater.State(context.Background(), mockTracer, mockMeter)
 		require.NoError(t, err)
+		require.False(t, res.Up)
+		require.Equal(t, "HTTP status code 401", res.Message)
 
 		// Assert span
 		ctx := context.Background()
 		err = tp.ForceFlush(ctx)
 		require.NoError(t, err)
 
-		spans := exp.GetSpans()
-		require.Len(t, spans, 1)
-		require.Equal(t, codes.Error, spans[0].Status.Code)
+		span := checkSpan(t, exp.GetSpans())
+		require.Equal(t, codes.Error, span.Status.Code)
 
 		// Assert metric
 		m, err := rdr.Collect(ctx)
 		assert.NoError(t, err)
 
 		require.Len(t, m.ScopeMetrics, 1)
-		require.Len(t, m.ScopeMetrics[0].Metrics, 2)
+		require.Len(t, m.ScopeMetrics[0].Metrics, 3)
 	})
 
 	t.Run("an HTTP error, should create a span with an error status", func(t *testing.T) {
@@ -166,7 +177,7 @@ func TestHTTP_Status(t *testing.T) {
 			Values: nil,
 		}
 
-		err = stater.State(mockTracer, mockMeter)
+		_, err = stater.State(context.Background(), mockTracer, mockMeter)
 		require.Error(t, err)
 
 		ctx := context.Background()
@@ -174,15 +185,900 @@ func TestHTTP_Status(t *testing.T) {
 		err = tp.ForceFlush(ctx)
 		require.NoError(t, err)
 
-		spans := exp.GetSpans()
-		require.Len(t, spans, 1)
-		require.Equal(t, codes.Error, spans[0].Status.Code)
+		span := checkSpan(t, exp.GetSpans())
+		require.Equal(t, codes.Error, span.Status.Code)
 
 		// Assert metric
 		m, err := rdr.Collect(ctx)
 		assert.NoError(t, err)
 
 		require.Len(t, m.ScopeMetrics, 1)
-		require.Len(t, m.ScopeMetrics[0].Metrics, 1)
+		require.Len(t, m.ScopeMetrics[0].Metrics, 2)
+	})
+
+	t.Run("an HTTP error of a retried attempt, should record the error without verdict", func(t *testing.T) {
+		mockServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+		mockServer.Close()
+
+		mockTracer := sdktrace.NewTracerProvider().Tracer("test-tracer")
+		rdr := metric.NewManualReader()
+		mp := metric.NewMeterProvider(metric.WithReader(rdr))
+		mockMeter := mp.Meter("test-meter")
+
+		stater, err := otelhttp.New(otelhttp.Config{
+			Config: status.Config{Name: "Test", Description: "Test retried attempt", Cron: "@99m"},
+			URL:    mockServer.URL,
+		})
+		require.NoError(t, err)
+
+		for _, attempt := range []status.Attempt{{Number: 1}, {Number: 2, Last: true}} {
+			_, err = stater.State(status.WithAttempt(context.Background(), attempt), mockTracer, mockMeter)
+			require.Error(t, err)
+		}
+
+		m, err := rdr.Collect(context.Background())
+		require.NoError(t, err)
+		require.Len(t, m.ScopeMetrics, 1)
+		require.Len(t, m.ScopeMetrics[0].Metrics, 2)
+		dps := m.ScopeMetrics[0].Metrics[0].Data.(metricdata.Sum[int64]).DataPoints
+		require.Len(t, dps, 2)
+		verdicts := map[bool]int64{}
+		for _, dp := range dps {
+			verdict, ok := dp.Attributes.Value(status.OtelStatusVerdict)
+			require.True(t, ok)
+			verdicts[verdict.AsBool()] = dp.Value
+		}
+		assert.Equal(t, map[bool]int64{false: 1, true: 1}, verdicts)
+	})
+
+	t.Run("a status change, should report only the latest status class", func(t *testing.T) {
+		code := http.StatusOK
+		mockServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(code)
+		}))
+		defer mockServer.Close()
+
+		urlParsed, err := url.Parse(mockServer.URL)
+		require.NoError(t, err)
+
+		tp := sdktrace.NewTracerProvider()
+		mockTracer := tp.Tracer("test-tracer")
+
+		rdr := metric.NewManualReader()
+		mp := metric.NewMeterProvider(metric.WithReader(rdr))
+		mockMeter := mp.Meter("test-meter")
+
+		stater := otelhttp.HTTP{
+			SC: status.Config{
+				Name: "Test",
+			},
+			Method: http.MethodGet,
+			URL:    urlParsed,
+		}
+
+		_, err = stater.State(context.Background(), mockTracer, mockMeter)
+		require.NoError(t, err)
+		code = http.StatusServiceUnavailable
+		_, err = stater.State(context.Background(), mockTracer, mockMeter)
+		require.NoError(t, err)
+
+		// Assert metric
+		m, err := rdr.Collect(context.Background())
+		assert.NoError(t, err)
+
+		require.Len(t, m.ScopeMetrics, 1)
+		classes := map[string]int64{}
+		for _, mm := range m.ScopeMetrics[0].Metrics {
+			if mm.Name != "otelstatus.http.status" {
+				continue
+			}
+			for _, dp := range mm.Data.(metricdata.Gauge[int64]).DataPoints {
+				class, _ := dp.Attributes.Value("http.status_class")
+				classes[class.AsString()] = dp.Value
+			}
+		}
+		assert.Equal(t, map[string]int64{"1xx": 0, "2xx": 0, "3xx": 0, "4xx": 0, "5xx": 1}, classes)
+	})
+
+	t.Run("an HTTP error after a response, should report no status class", func(t *testing.T) {
+		mockServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusOK)
+		}))
+		defer mockServer.Close()
+
+		urlParsed, err := url.Parse(mockServer.URL)
+		require.NoError(t, err)
+
+		tp := sdktrace.NewTracerProvider()
+		mockTracer := tp.Tracer("test-tracer")
+
+		rdr := metric.NewManualReader()
+		mp := metric.NewMeterProvider(metric.WithReader(rdr))
+		mockMeter := mp.Meter("test-meter")
+
+		stater := otelhttp.HTTP{
+			SC: status.Config{
+				Name: "Test",
+			},
+			Method: http.MethodGet,
+			URL:    urlParsed,
+		}
+
+		_, err = stater.State(context.Background(), mockTracer, mockMeter)
+		require.NoError(t, err)
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+		_, err = stater.State(ctx, mockTracer, mockMeter)
+		require.Error(t, err)
+
+		m, err := rdr.Collect(context.Background())
+		assert.NoError(t, err)
+
+		require.Len(t, m.ScopeMetrics, 1)
+		classes := map[string]int64{}
+		for _, mm := range m.ScopeMetrics[0].Metrics {
+			if mm.Name != "otelstatus.http.status" {
+				continue
+			}
+			for _, dp := range mm.Data.(metricdata.Gauge[int64]).DataPoints {
+				class, _ := dp.Attributes.Value("http.status_class")
+				classes[class.AsString()] = dp.Value
+			}
+		}
+		assert.Equal(t, map[string]int64{"1xx": 0, "2xx": 0, "3xx": 0, "4xx": 0, "5xx": 0}, classes)
+	})
+}
+
+func TestHTTP_New(t *testing.T) {
+	t.Run("a configuration without method, should use GET", func(t *testing.T) {
+		stater, err := otelhttp.New(otelhttp.Config{URL: "https://example.com"})
+		require.NoError(t, err)
+		assert.Equal(t, http.MethodGet, stater.Method)
+	})
+
+	t.Run("an URL without http scheme, should return an error", func(t *testing.T) {
+		_, err := otelhttp.New(otelhttp.Config{URL: "ftp://example.com"})
+		var configErr *status.ConfigError
+		require.ErrorAs(t, err, &configErr)
+		assert.Equal(t, "url", configErr.Field)
+	})
+
+	t.Run("an unknown method, should return an error", func(t *testing.T) {
+		_, err := otelhttp.New(otelhttp.Config{URL: "https://example.com", Method: "FETCH"})
+		var configErr *status.ConfigError
+		require.ErrorAs(t, err, &configErr)
+		assert.Equal(t, "method", configErr.Field)
+	})
+
+	t.Run("an invalid expected status code or body regex, should return an error", func(t *testing.T) {
+		for _, expect := range []otelhttp.Expect{
+			{StatusCodes: []string{"2xx", "20O"}},
+			{StatusCodes: []string{"299-200"}},
+			{BodyRegex: []string{`"status":\s*"(ok`}},
+		} {
+			_, err := otelhttp.New(otelhttp.Config{URL: "https://example.com", Expect: expect})
+			var configErr *status.ConfigError
+			require.ErrorAs(t, err, &configErr)
+			assert.Equal(t, "expect", configErr.Field)
+		}
+	})
+}
+
+func TestHTTP_Redact(t *testing.T) {
+	t.Run("a secret in the URL, should be redacted from the span", func(t *testing.T) {
+		mockServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.URL.Query().Get("token") != "url-s3cr3t" {
+				w.WriteHeader(http.StatusUnauthorized)
+			}
+		}))
+		defer mockServer.Close()
+
+		status.RegisterSecret("url-s3cr3t")
+		urlParsed, err := url.Parse(mockServer.URL + "/health?token=url-s3cr3t")
+		require.NoError(t, err)
+
+		exp := tracetest.NewInMemoryExporter()
+		tp := sdktrace.NewTracerProvider(sdktrace.WithSyncer(exp))
+		mockTracer := tp.Tracer("test-tracer")
+
+		rdr := metric.NewManualReader()
+		mp := metric.NewMeterProvider(metric.WithReader(rdr))
+		mockMeter := mp.Meter("test-meter")
+
+		stater := otelhttp.HTTP{
+			SC:     status.Config{Name: "Test"},
+			Method: http.MethodGet,
+			URL:    urlParsed,
+			Values: map[string]string{"token": "url-s3cr3t"},
+		}
+
+		res, err := stater.State(context.Background(), mockTracer, mockMeter)
+		require.NoError(t, err)
+		require.True(t, res.Up)
+
+		span := checkSpan(t, exp.GetSpans())
+		assert.NotContains(t, span.Name, "url-s3cr3t")
+		for _, attr := range span.Attributes {
+			assert.NotContains(t, attr.Value.Emit(), "url-s3cr3t", attr.Key)
+		}
+		assert.Contains(t, span.Attributes, attribute.String("http.url", mockServer.URL+"/health?token="+status.Redacted))
+	})
+}
+
+func TestHTTP_Timeout(t *testing.T) {
+	t.Run("a response slower than the timeout, should create a span with a timeout error", func(t *testing.T) {
+		done := make(chan struct{})
+		mockServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			select {
+			case <-done:
+			case <-time.After(5 * time.Second):
+			}
+			w.WriteHeader(http.StatusOK)
+		}))
+		defer mockServer.Close()
+		defer close(done)
+
+		urlParsed, err := url.Parse(mockServer.URL)
+		require.NoError(t, err)
+
+		exp := tracetest.NewInMemoryExporter()
+		tp := sdktrace.NewTracerProvider(
+			sdktrace.WithSyncer(exp),
+		)
+		mockTracer := tp.Tracer("test-tracer")
+
+		rdr := metric.NewManualReader()
+		mp := metric.NewMeterProvider(metric.WithReader(rdr))
+		mockMeter := mp.Meter("test-meter")
+
+		stater := otelhttp.HTTP{
+			SC: status.Config{
+				Name:        "Test",
+				Description: "Test timeout",
+				Cron:        "@99m",
+				Timeout:     50 * time.Millisecond,
+			},
+			Method: http.MethodGet,
+			URL:    urlParsed,
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), stater.Config().EffectiveTimeout())
+		defer cancel()
+		_, err = stater.State(ctx, mockTracer, mockMeter)
+		require.Error(t, err)
+		require.Equal(t, status.ErrorClassTimeout, status.ErrorClass(err))
+
+		span := checkSpan(t, exp.GetSpans())
+		require.Equal(t, codes.Error, span.Status.Code)
+		assert.Contains(t, span.Attributes, attribute.String(status.OtelStatusErrorClass, status.ErrorClassTimeout))
+
+		m, err := rdr.Collect(context.Background())
+		assert.NoError(t, err)
+
+		require.Len(t, m.ScopeMetrics, 1)
+		require.Len(t, m.ScopeMetrics[0].Metrics, 2)
+		errorMetric := m.ScopeMetrics[0].Metrics[0].Data.(metricdata.Sum[int64])
+		require.Len(t, errorMetric.DataPoints, 1)
+		class, ok := errorMetric.DataPoints[0].Attributes.Value(status.OtelStatusErrorClass)
+		require.True(t, ok)
+		assert.Equal(t, status.ErrorClassTimeout, class.AsString())
+	})
+}
+
+func TestHTTP_TLS(t *testing.T) {
+	t.Run("an HTTPS server with a trusted CA, should record the certificate", func(t *testing.T) {
+		mockServer := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusOK)
+		}))
+		defer mockServer.Close()
+
+		urlParsed, err := url.Parse(mockServer.URL)
+		require.NoError(t, err)
+
+		caFile := filepath.Join(t.TempDir(), "ca.pem")
+		caPEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: mockServer.Certificate().Raw})
+		require.NoError(t, os.WriteFile(caFile, caPEM, 0o600))
+
+		exp := tracetest.NewInMemoryExporter()
+		tp := sdktrace.NewTracerProvider(
+			sdktrace.WithSyncer(exp),
+		)
+		mockTracer := tp.Tracer("test-tracer")
+
+		rdr := metric.NewManualReader()
+		mp := metric.NewMeterProvider(metric.WithReader(rdr))
+		mockMeter := mp.Meter("test-meter")
+
+		stater := otelhttp.HTTP{
+			SC: status.Config{
+				Name:        "Test",
+				Description: "Test TLS",
+				Cron:        "@99m",
+			},
+			Method: http.MethodGet,
+			URL:    urlParsed,
+			TLS: status.TLSConfig{
+				CAFile:     caFile,
+				ServerName: "example.com",
+			},
+		}
+
+		_, err = stater.State(context.Background(), mockTracer, mockMeter)
+		require.NoError(t, err)
+
+		span := checkSpan(t, exp.GetSpans())
+		require.Equal(t, codes.Unset, span.Status.Code)
+		attrs := attribute.NewSet(span.Attributes...)
+		assert.True(t, attrs.HasValue(status.TLSVersion))
+		assert.True(t, attrs.HasValue(status.TLSCipher))
+		san, ok := attrs.Value(status.TLSServerSAN)
+		require.True(t, ok)
+		assert.Contains(t, san.AsStringSlice(), "example.com")
+
+		m, err := rdr.Collect(context.Background())
+		assert.NoError(t, err)
+
+		require.Len(t, m.ScopeMetrics, 1)
+		var expiry metricdata.Gauge[int64]
+		for _, mm := range m.ScopeMetrics[0].Metrics {
+			if mm.Name == "otelstatus.http.tls.expiry" {
+				expiry = mm.Data.(metricdata.Gauge[int64])
+			}
+		}
+		require.Len(t, expiry.DataPoints, 1)
+		wantDays := int64(time.Until(mockServer.Certificate().NotAfter) / (24 * time.Hour))
+		assert.Equal(t, wantDays, expiry.DataPoints[0].Value)
+	})
+
+	t.Run("an HTTPS server with an unknown CA, should create a span with an error status", func(t *testing.T) {
+		mockServer := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusOK)
+		}))
+		defer mockServer.Close()
+
+		urlParsed, err := url.Parse(mockServer.URL)
+		require.NoError(t, err)
+
+		exp := tracetest.NewInMemoryExporter()
+		tp := sdktrace.NewTracerProvider(
+			sdktrace.WithSyncer(exp),
+		)
+		mockTracer := tp.Tracer("test-tracer")
+
+		rdr := metric.NewManualReader()
+		mp := metric.NewMeterProvider(metric.WithReader(rdr))
+		mockMeter := mp.Meter("test-meter")
+
+		stater := otelhttp.HTTP{
+			SC: status.Config{
+				Name:        "Test",
+				Description: "Test TLS",
+				Cron:        "@99m",
+			},
+			Method: http.MethodGet,
+			URL:    urlParsed,
+		}
+
+		_, err = stater.State(context.Background(), mockTracer, mockMeter)
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), "x509")
+
+		span := checkSpan(t, exp.GetSpans())
+		require.Equal(t, codes.Error, span.Status.Code)
+
+		// The expiry is recorded even if the certificate is not trusted.
+		m, err := rdr.Collect(context.Background())
+		require.NoError(t, err)
+		require.Len(t, m.ScopeMetrics, 1)
+		var names []string
+		for _, mm := range m.ScopeMetrics[0].Metrics {
+			names = append(names, mm.Name)
+		}
+		assert.Contains(t, names, "otelstatus.http.tls.expiry")
+	})
+
+	t.Run("an HTTPS server with insecure_skip_verify, should create a span without an error status", func(t *testing.T) {
+		mockServer := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusOK)
+		}))
+		defer mockServer.Close()
+
+		urlParsed, err := url.Parse(mockServer.URL)
+		require.NoError(t, err)
+
+		exp := tracetest.NewInMemoryExporter()
+		tp := sdktrace.NewTracerProvider(
+			sdktrace.WithSyncer(exp),
+		)
+		mockTracer := tp.Tracer("test-tracer")
+
+		mp := metric.NewMeterProvider()
+		mockMeter := mp.Meter("test-meter")
+
+		stater := otelhttp.HTTP{
+			SC: status.Config{
+				Name:        "Test",
+				Description: "Test TLS",
+				Cron:        "@99m",
+			},
+			Method: http.MethodGet,
+			URL:    urlParsed,
+			TLS: status.TLSConfig{
+				InsecureSkipVerify: true,
+			},
+		}
+
+		_, err = stater.State(context.Background(), mockTracer, mockMeter)
+		require.NoError(t, err)
+
+		span := checkSpan(t, exp.GetSpans())
+		require.Equal(t, codes.Unset, span.Status.Code)
+	})
+}
+
+func TestHTTP_Request(t *testing.T) {
+	t.Run("headers, body and basic auth, should be sent with the request", func(t *testing.T) {
+		var gotReq *http.Request
+		var gotBody []byte
+		mockServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			gotReq = r
+			gotBody, _ = io.ReadAll(r.Body)
+			w.WriteHeader(http.StatusOK)
+		}))
+		defer mockServer.Close()
+
+		urlParsed, err := url.Parse(mockServer.URL)
+		require.NoError(t, err)
+
+		tp := sdktrace.NewTracerProvider()
+		mockTracer := tp.Tracer("test-tracer")
+		mp := metric.NewMeterProvider()
+		mockMeter := mp.Meter("test-meter")
+
+		stater := otelhttp.HTTP{
+			SC: status.Config{
+				Name:        "Test",
+				Description: "Test request",
+				Cron:        "@99m",
+			},
+			Method:  http.MethodPost,
+			URL:     urlParsed,
+			Headers: map[string]string{"Content-Type": "application/json", "Host": "example.com"},
+			Body:    `{"ping":true}`,
+			Auth: otelhttp.Auth{
+				Basic: &otelhttp.BasicAuth{Username: "user", Password: "pass"},
+			},
+		}
+
+		_, err = stater.State(context.Background(), mockTracer, mockMeter)
+		require.NoError(t, err)
+
+		require.NotNil(t, gotReq)
+		assert.Equal(t, http.MethodPost, gotReq.Method)
+		assert.Equal(t, "application/json", gotReq.Header.Get("Content-Type"))
+		assert.Equal(t, "example.com", gotReq.Host)
+		assert.Equal(t, `{"ping":true}`, string(gotBody))
+		username, password, ok := gotReq.BasicAuth()
+		require.True(t, ok)
+		assert.Equal(t, "user", username)
+		assert.Equal(t, "pass", password)
+	})
+
+	t.Run("a body file and a bearer token, should be sent with the request", func(t *testing.T) {
+		var gotReq *http.Request
+		var gotBody []byte
+		mockServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			gotReq = r
+			gotBody, _ = io.ReadAll(r.Body)
+			w.WriteHeader(http.StatusOK)
+		}))
+		defer mockServer.Close()
+
+		urlParsed, err := url.Parse(mockServer.URL)
+		require.NoError(t, err)
+
+		bodyFile := filepath.Join(t.TempDir(), "body.json")
+		require.NoError(t, os.WriteFile(bodyFile, []byte(`{"from":"file"}`), 0o600))
+
+		tp := sdktrace.NewTracerProvider()
+		mockTracer := tp.Tracer("test-tracer")
+		mp := metric.NewMeterProvider()
+		mockMeter := mp.Meter("test-meter")
+
+		stater := otelhttp.HTTP{
+			SC: status.Config{
+				Name:        "Test",
+				Description: "Test request",
+				Cron:        "@99m",
+			},
+			Method:   http.MethodPut,
+			URL:      urlParsed,
+			Body:     "ignored",
+			BodyFile: bodyFile,
+			Auth: otelhttp.Auth{
+				Bearer: &otelhttp.BearerAuth{Token: "s3cr3t"},
+			},
+		}
+
+		_, err = stater.State(context.Background(), mockTracer, mockMeter)
+		require.NoError(t, err)
+
+		require.NotNil(t, gotReq)
+		assert.Equal(t, `{"from":"file"}`, string(gotBody))
+		assert.Equal(t, "Bearer s3cr3t", gotReq.Header.Get("Authorization"))
+	})
+
+	t.Run("an API key without header name, should use the default header", func(t *testing.T) {
+		var gotReq *http.Request
+		mockServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			gotReq = r
+			w.WriteHeader(http.StatusOK)
+		}))
+		defer mockServer.Close()
+
+		urlParsed, err := url.Parse(mockServer.URL)
+		require.NoError(t, err)
+
+		tp := sdktrace.NewTracerProvider()
+		mockTracer := tp.Tracer("test-tracer")
+		mp := metric.NewMeterProvider()
+		mockMeter := mp.Meter("test-meter")
+
+		stater := otelhttp.HTTP{
+			SC: status.Config{
+				Name:        "Test",
+				Description: "Test request",
+				Cron:        "@99m",
+			},
+			Method: http.MethodGet,
+			URL:    urlParsed,
+			Auth: otelhttp.Auth{
+				APIKey: &otelhttp.APIKeyAuth{Value: "k3y"},
+			},
+		}
+
+		_, err = stater.State(context.Background(), mockTracer, mockMeter)
+		require.NoError(t, err)
+
+		require.NotNil(t, gotReq)
+		assert.Equal(t, "k3y", gotReq.Header.Get("X-API-Key"))
+	})
+
+	t.Run("a missing body file, should return an error", func(t *testing.T) {
+		urlParsed, err := url.Parse("http://localhost")
+		require.NoError(t, err)
+
+		tp := sdktrace.NewTracerProvider()
+		mockTracer := tp.Tracer("test-tracer")
+		mp := metric.NewMeterProvider()
+		mockMeter := mp.Meter("test-meter")
+
+		stater := otelhttp.HTTP{
+			SC: status.Config{
+				Name:        "Test",
+				Description: "Test request",
+				Cron:        "@99m",
+			},
+			Method:   http.MethodPost,
+			URL:      urlParsed,
+			BodyFile: filepath.Join(t.TempDir(), "missing.json"),
+		}
+
+		_, err = stater.State(context.Background(), mockTracer, mockMeter)
+		require.Error(t, err)
+	})
+}
+
+func TestHTTP_Expect(t *testing.T) {
+	t.Run("a 200 with all the assertions passing, should create a span without an error status", func(t *testing.T) {
+		mockServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusOK)
+			_, _ = w.Write([]byte(`{"status":"ok","checks":[{"name":"db","healthy":true,"latency":1.0}]}`))
+		}))
+		defer mockServer.Close()
+
+		urlParsed, err := url.Parse(mockServer.URL)
+		require.NoError(t, err)
+
+		exp := tracetest.NewInMemoryExporter()
+		tp := sdktrace.NewTracerProvider(
+			sdktrace.WithSyncer(exp),
+		)
+		mockTracer := tp.Tracer("test-tracer")
+
+		rdr := metric.NewManualReader()
+		mp := metric.NewMeterProvider(metric.WithReader(rdr))
+		mockMeter := mp.Meter("test-meter")
+
+		stater := otelhttp.HTTP{
+			SC: status.Config{
+				Name:        "Test",
+				Description: "Test assertions",
+				Cron:        "@99m",
+			},
+			Method: http.MethodGet,
+			URL:    urlParsed,
+			Expect: otelhttp.Expect{
+				StatusCodes:  []string{"201", "2xx"},
+				BodyContains: []string{`"status":"ok"`},
+				BodyRegex:    []string{`"name":\s*"db"`},
+				JSONPath: map[string]string{
+					"$.status":               "ok",
+					"$.checks[0].healthy":    "true",
+					"$['checks'][0].latency": "1",
+				},
+				Headers: map[string]string{"Content-Type": "application/json"},
+			},
+		}
+
+		_, err = stater.State(context.Background(), mockTracer, mockMeter)
+		require.NoError(t, err)
+
+		span := checkSpan(t, exp.GetSpans())
+		require.Equal(t, codes.Unset, span.Status.Code)
+
+		m, err := rdr.Collect(context.Background())
+		assert.NoError(t, err)
+
+		require.Len(t, m.ScopeMetrics, 1)
+		require.Len(t, m.ScopeMetrics[0].Metrics, 3)
+	})
+
+	t.Run("a 200 with failing assertions, should create a span with an error status and count the failures", func(t *testing.T) {
+		mockServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusOK)
+			_, _ = w.Write([]byte(`{"status":"maintenance"}`))
+		}))
+		defer mockServer.Close()
+
+		urlParsed, err := url.Parse(mockServer.URL)
+		require.NoError(t, err)
+
+		exp := tracetest.NewInMemoryExporter()
+		tp := sdktrace.NewTracerProvider(
+			sdktrace.WithSyncer(exp),
+		)
+		mockTracer := tp.Tracer("test-tracer")
+
+		rdr := metric.NewManualReader()
+		mp := metric.NewMeterProvider(metric.WithReader(rdr))
+		mockMeter := mp.Meter("test-meter")
+
+		stater := otelhttp.HTTP{
+			SC: status.Config{
+				Name:        "Test",
+				Description: "Test assertions",
+				Cron:        "@99m",
+			},
+			Method: http.MethodGet,
+			URL:    urlParsed,
+			Expect: otelhttp.Expect{
+				StatusCodes:  []string{"200-204"},
+				BodyContains: []string{"healthy"},
+				JSONPath:     map[string]string{"$.status": "ok"},
+				Headers:      map[string]string{"X-Version": ""},
+			},
+		}
+
+		_, err = stater.State(context.Background(), mockTracer, mockMeter)
+		require.NoError(t, err)
+
+		span := checkSpan(t, exp.GetSpans())
+		require.Equal(t, codes.Error, span.Status.Code)
+		require.Len(t, span.Events, 3)
+
+		m, err := rdr.Collect(context.Background())
+		assert.NoError(t, err)
+
+		require.Len(t, m.ScopeMetrics, 1)
+		require.Len(t, m.ScopeMetrics[0].Metrics, 4)
+		var failures metricdata.Sum[int64]
+		for _, mm := range m.ScopeMetrics[0].Metrics {
+			if mm.Name == "otelstatus.http.assertion.failure" {
+				failures = mm.Data.(metricdata.Sum[int64])
+			}
+		}
+		require.Len(t, failures.DataPoints, 3)
+	})
+
+	t.Run("a 401 with an expected 401, should create a span without an error status", func(t *testing.T) {
+		mockServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusUnauthorized)
+		}))
+		defer mockServer.Close()
+
+		urlParsed, err := url.Parse(mockServer.URL)
+		require.NoError(t, err)
+
+		exp := tracetest.NewInMemoryExporter()
+		tp := sdktrace.NewTracerProvider(
+			sdktrace.WithSyncer(exp),
+		)
+		mockTracer := tp.Tracer("test-tracer")
+
+		mp := metric.NewMeterProvider()
+		mockMeter := mp.Meter("test-meter")
+
+		stater := otelhttp.HTTP{
+			SC: status.Config{
+				Name:        "Test",
+				Description: "Test assertions",
+				Cron:        "@99m",
+			},
+			Method: http.MethodGet,
+			URL:    urlParsed,
+			Expect: otelhttp.Expect{
+				StatusCodes: []string{"401"},
+			},
+		}
+
+		_, err = stater.State(context.Background(), mockTracer, mockMeter)
+		require.NoError(t, err)
+
+		span := checkSpan(t, exp.GetSpans())
+		require.Equal(t, codes.Unset, span.Status.Code)
+	})
+}
+
+func TestHTTP_Phases(t *testing.T) {
+	t.Run("a 200 status, should create a child span and a metric for each phase", func(t *testing.T) {
+		mockServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusOK)
+			_, _ = w.Write([]byte("hello"))
+		}))
+		defer mockServer.Close()
+
+		urlParsed, err := url.Parse(mockServer.URL)
+		require.NoError(t, err)
+
+		exp := tracetest.NewInMemoryExporter()
+		tp := sdktrace.NewTracerProvider(
+			sdktrace.WithSyncer(exp),
+		)
+		mockTracer := tp.Tracer("test-tracer")
+
+		rdr := metric.NewManualReader()
+		mp := metric.NewMeterProvider(metric.WithReader(rdr))
+		mockMeter := mp.Meter("test-meter")
+
+		stater := otelhttp.HTTP{
+			SC: status.Config{
+				Name:        "Test",
+				Description: "Test phases",
+				Cron:        "@99m",
+			},
+			Method: http.MethodGet,
+			URL:    urlParsed,
+		}
+
+		_, err = stater.State(context.Background(), mockTracer, mockMeter)
+		require.NoError(t, err)
+
+		spans := exp.GetSpans()
+		parent := checkSpan(t, spans)
+		var children []string
+		for _, s := range spans {
+			if s.Parent.SpanID() == parent.SpanContext.SpanID() {
+				children = append(children, s.Name)
+			}
+		}
+		assert.Equal(t, []string{"connect", "ttfb", "transfer"}, children)
+
+		m, err := rdr.Collect(context.Background())
+		assert.NoError(t, err)
+
+		require.Len(t, m.ScopeMetrics, 1)
+		var phases metricdata.Histogram
+		for _, mm := range m.ScopeMetrics[0].Metrics {
+			if mm.Name == "otelstatus.http.phase.duration" {
+				phases = mm.Data.(metricdata.Histogram)
+			}
+		}
+		var names []string
+		for _, dp := range phases.DataPoints {
+			name, ok := dp.Attributes.Value("phase")
+			require.True(t, ok)
+			names = append(names, name.AsString())
+		}
+		assert.ElementsMatch(t, []string{"connect", "ttfb", "transfer"}, names)
 	})
 }
+
+func TestHTTP_Propagate(t *testing.T) {
+	previous := otel.GetTextMapPropagator()
+	otel.SetTextMapPropagator(propagation.TraceContext{})
+	defer otel.SetTextMapPropagator(previous)
+
+	for _, propagate := range []bool{true, false} {
+		name := "propagation enabled, should send the traceparent of the check span"
+		if !propagate {
+			name = "propagation disabled, should not send a traceparent"
+		}
+		t.Run(name, func(t *testing.T) {
+			var gotReq *http.Request
+			mockServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				gotReq = r
+				w.WriteHeader(http.StatusOK)
+			}))
+			defer mockServer.Close()
+
+			exp := tracetest.NewInMemoryExporter()
+			tp := sdktrace.NewTracerProvider(
+				sdktrace.WithSyncer(exp),
+			)
+			mockTracer := tp.Tracer("test-tracer")
+			mp := metric.NewMeterProvider()
+			mockMeter := mp.Meter("test-meter")
+
+			stater, err := otelhttp.New(otelhttp.Config{
+				Config: status.Config{
+					Name:        "Test",
+					Description: "Test propagation",
+					Cron:        "@99m",
+				},
+				URL:       mockServer.URL,
+				Propagate: propagate,
+			})
+			require.NoError(t, err)
+
+			_, err = stater.State(context.Background(), mockTracer, mockMeter)
+			require.NoError(t, err)
+
+			require.NotNil(t, gotReq)
+			if !propagate {
+				assert.Empty(t, gotReq.Header.Get("traceparent"))
+				return
+			}
+			parent := checkSpan(t, exp.GetSpans())
+			sc := trace.SpanContextFromContext(
+				propagation.TraceContext{}.Extract(context.Background(), propagation.HeaderCarrier(gotReq.Header)))
+			assert.Equal(t, parent.SpanContext.TraceID(), sc.TraceID())
+			assert.Equal(t, parent.SpanContext.SpanID(), sc.SpanID())
+		})
+	}
+}
+
+// checkSpan returns the span of the check, the only one without a parent.
+func checkSpan(t *testing.T, spans tracetest.SpanStubs) tracetest.SpanStub {
+	t.Helper()
+	var roots tracetest.SpanStubs
+	for _, s := range spans {
+		if !s.Parent.IsValid() {
+			roots = append(roots, s)
+		}
+	}
+	require.Len(t, roots, 1)
+	return roots[0]
+}
+
+func BenchmarkHTTP_State(b *testing.B) {
+	mockServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer mockServer.Close()
+
+	mockTracer := sdktrace.NewTracerProvider().Tracer("test-tracer")
+	rdr := metric.NewManualReader()
+	mp := metric.NewMeterProvider(metric.WithReader(rdr))
+	mockMeter := mp.Meter("test-meter")
+
+	stater, err := otelhttp.New(otelhttp.Config{
+		Config: status.Config{
+			Name:        "Test",
+			Description: "Benchmark",
+			Cron:        "@99m",
+		},
+		URL: mockServer.URL,
+	})
+	require.NoError(b, err)
+
+	ctx := context.Background()
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := stater.State(ctx, mockTracer, mockMeter); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
@@ -0,0 +1,130 @@
+/*******************************************************************************
+ * Copyright (c) 2023 Cedric L'homme.
+ *
+ * This file is part of otel-status.
+ *
+ * otel-status is free software: you can redistribute it and/or modify it
+ * under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License,
+ * or (at your option) any later version.
+ *
+ *  otel-status is distributed in the hope that it will be useful, but
+ *  WITHOUT ANY WARRANTY; without even the implied warranty of
+ *  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.
+ *  See the GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with otel-status. If not, see <https://www.gnu.org/licenses/>.
+ ******************************************************************************/
+
+package http
+
+import (
+	"crypto/tls"
+	"net/http/httptrace"
+	"sync"
+	"time"
+)
+
+// Names of the phases of an HTTP request.
+const (
+	phaseDNS      = "dns"
+	phaseConnect  = "connect"
+	phaseTLS      = "tls"
+	phaseTTFB     = "ttfb"
+	phaseTransfer = "transfer"
+)
+
+// phaseTimer collects the timestamps of the phases of an HTTP request through httptrace.
+// The callbacks can be called concurrently, e.g. when dialing several addresses.
+type phaseTimer struct {
+	mu                        sync.Mutex
+	dnsStart, dnsDone         time.Time
+	dnsErr                    error
+	connectStart, connectDone time.Time
+	connectErr                error
+	tlsStart, tlsDone         time.Time
+	tlsErr                    error
+	wroteRequest, firstByte   time.Time
+	bodyDone                  time.Time
+}
+
+// phase is a completed phase of an HTTP request.
+type phase struct {
+	name       string
+	start, end time.Time
+	err        error
+}
+
+// clientTrace returns the httptrace hooks filling the timer.
+func (p *phaseTimer) clientTrace() *httptrace.ClientTrace {
+	return &httptrace.ClientTrace{
+		DNSStart: func(httptrace.DNSStartInfo) {
+			p.set(&p.dnsStart, time.Now())
+		},
+		DNSDone: func(info httptrace.DNSDoneInfo) {
+			p.mu.Lock()
+			defer p.mu.Unlock()
+			p.dnsDone, p.dnsErr = time.Now(), info.Err
+		},
+		ConnectStart: func(string, string) {
+			p.set(&p.connectStart, time.Now())
+		},
+		ConnectDone: func(_, _ string, err error) {
+			p.mu.Lock()
+			defer p.mu.Unlock()
+			// Keep the first successful connection.
+			if p.connectDone.IsZero() || p.connectErr != nil {
+				p.connectDone, p.connectErr = time.Now(), err
+			}
+		},
+		TLSHandshakeStart: func() {
+			p.set(&p.tlsStart, time.Now())
+		},
+		TLSHandshakeDone: func(_ tls.ConnectionState, err error) {
+			p.mu.Lock()
+			defer p.mu.Unlock()
+			p.tlsDone, p.tlsErr = time.Now(), err
+		},
+		WroteRequest: func(httptrace.WroteRequestInfo) {
+			p.set(&p.wroteRequest, time.Now())
+		},
+		GotFirstResponseByte: func() {
+			p.set(&p.firstByte, time.Now())
+		},
+	}
+}
+
+// set sets the timestamp if it is not already set.
+func (p *phaseTimer) set(ts *time.Time, now time.Time) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if ts.IsZero() {
+		*ts = now
+	}
+}
+
+// markBodyDone marks the end of the transfer of the body.
+func (p *phaseTimer) markBodyDone() {
+	p.set(&p.bodyDone, time.Now())
+}
+
+// phases returns the completed phases in chronological order.
+// The time to first byte is measured from the end of the writing of the request.
+func (p *phaseTimer) phases() []phase {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	var phases []phase
+	add := func(name string, start, end time.Time, err error) {
+		if !start.IsZero() && !end.IsZero() {
+			phases = append(phases, phase{name: name, start: start, end: end, err: err})
+		}
+	}
+	add(phaseDNS, p.dnsStart, p.dnsDone, p.dnsErr)
+	add(phaseConnect, p.connectStart, p.connectDone, p.connectErr)
+	add(phaseTLS, p.tlsStart, p.tlsDone, p.tlsErr)
+	add(phaseTTFB, p.wroteRequest, p.firstByte, nil)
+	add(phaseTransfer, p.firstByte, p.bodyDone, nil)
+	return phases
+}
@@ -0,0 +1,559 @@
+/*******************************************************************************
+ * Copyright (c) 2023 Cedric L'homme.
+ *
+ * This file is part of otel-status.
+ *
+ * otel-status is free software: you can redistribute it and/or modify it
+ * under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License,
+ * or (at your option) any later version.
+ *
+ *  otel-status is distributed in the hope that it will be useful, but
+ *  WITHOUT ANY WARRANTY; without even the implied warranty of
+ *  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.
+ *  See the GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with otel-status. If not, see <https://www.gnu.org/licenses/>.
+ ******************************************************************************/
+
+// Package icmp is the package to get status through ICMP echo requests.
+package icmp
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"net"
+	"os"
+	"sync/atomic"
+	"time"
+
+	"github.com/rangzen/otel-status/package/status"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/metric"
+	"go.opentelemetry.io/otel/metric/instrument"
+	"go.opentelemetry.io/otel/metric/unit"
+	"go.opentelemetry.io/otel/semconv/v1.17.0"
+	"go.opentelemetry.io/otel/trace"
+	"golang.org/x/exp/slog"
+	"golang.org/x/net/icmp"
+	"golang.org/x/net/ipv4"
+	"golang.org/x/net/ipv6"
+)
+
+// PluginName is the name of the plugin.
+const PluginName = "icmp"
+
+const (
+	otelStatusICMPName    = "otelstatus.icmp.name"
+	otelStatusICMPAddress = "otelstatus.icmp.address"
+	otelStatusICMPRTT     = "otelstatus.icmp.rtt"
+	otelStatusICMPJitter  = "otelstatus.icmp.jitter"
+	otelStatusICMPLoss    = "otelstatus.icmp.loss"
+	otelStatusICMPError   = "otelstatus.icmp.error"
+	// icmpRTTStat is the key for the statistic of the round-trip times: min, avg or max.
+	icmpRTTStat = "icmp.rtt.stat"
+	// icmpSeq is the key for the sequence number of an echo request.
+	icmpSeq = "icmp.seq"
+)
+
+const (
+	defaultCount    = 3
+	defaultInterval = time.Second
+	// maxReplySize is the size of the buffer for the replies.
+	maxReplySize = 1500
+)
+
+// payload is the data of the echo requests.
+var payload = []byte("otel-status ICMP echo request...")
+
+// lastID is the last identifier of a burst of echo requests, see nextID.
+var lastID = uint32(os.Getpid())
+
+// Config is the configuration for an ICMP status.
+type Config struct {
+	status.Config `yaml:",inline"`
+	// Address is the host name or the IP address to ping.
+	Address string `yaml:"address"`
+	// Count is the number of echo requests of a check.
+	Count int `yaml:"count" default:"3"`
+	// Interval is the wait between two echo requests,
+	// a reply received after the next request is lost.
+	Interval time.Duration `yaml:"interval" default:"1s"`
+	// MaxLoss is the maximum percentage of lost packets of an up check.
+	MaxLoss int `yaml:"max_loss"`
+	// Values is a map of key/value to add to the spans.
+	Values map[string]string `yaml:"values"`
+}
+
+// ICMP is the main structure to use ICMP status.
+type ICMP struct {
+	SC       status.Config
+	Address  string
+	Count    int
+	Interval time.Duration
+	MaxLoss  int
+	Values   map[string]string
+	// rtt reports the minimum, average and maximum round-trip times of the latest burst.
+	rtt status.Gauge[float64]
+	// jitter reports the jitter of the latest burst.
+	jitter status.Gauge[float64]
+	// loss reports the packet loss of the latest burst.
+	loss        status.Gauge[int64]
+	instruments status.Instruments[instruments]
+}
+
+// instruments are the synchronous instruments of the ICMP status.
+type instruments struct {
+	error instrument.Int64Counter
+}
+
+// newInstruments creates the synchronous instruments of the ICMP status on the meter.
+func newInstruments(meter metric.Meter) (instruments, error) {
+	var i instruments
+	var err error
+	i.error, err = meter.Int64Counter(
+		otelStatusICMPError,
+		instrument.WithUnit(unit.Dimensionless),
+		instrument.WithDescription("Error of the ICMP echo requests"),
+	)
+	if err != nil {
+		return i, fmt.Errorf("creating ICMP error metric: %w", err)
+	}
+	return i, nil
+}
+
+// New returns the ICMP status of the configuration.
+func New(c Config) (*ICMP, error) {
+	p := &ICMP{
+		SC:       c.Config,
+		Address:  c.Address,
+		Count:    c.Count,
+		Interval: c.Interval,
+		MaxLoss:  c.MaxLoss,
+		Values:   c.Values,
+	}
+	if p.Count == 0 {
+		p.Count = defaultCount
+	}
+	if p.Interval == 0 {
+		p.Interval = defaultInterval
+	}
+	if p.Address == "" {
+		return nil, &status.ConfigError{Field: "address", Err: errors.New("no address")}
+	}
+	if p.Count < 0 {
+		return nil, &status.ConfigError{Field: "count", Err: fmt.Errorf("count %d must be positive", c.Count)}
+	}
+	if p.Interval < 0 {
+		return nil, &status.ConfigError{Field: "interval", Err: fmt.Errorf("interval %s must be positive", c.Interval)}
+	}
+	// The burst lasts Count intervals, the last reply is awaited for an interval too.
+	if timeout := p.SC.EffectiveTimeout(); time.Duration(p.Count) > (timeout-1)/p.Interval {
+		return nil, &status.ConfigError{Field: "count",
+			Err: fmt.Errorf("count %d every %s does not end before the timeout %s", p.Count, p.Interval, timeout)}
+	}
+	if p.MaxLoss < 0 || p.MaxLoss > 100 {
+		return nil, &status.ConfigError{Field: "max_loss", Err: fmt.Errorf("max loss %d must be between 0 and 100", c.MaxLoss)}
+	}
+	return p, nil
+}
+
+// Config returns the status.Config of the ICMP status.
+func (p *ICMP) Config() status.Config {
+	return p.SC
+}
+
+// Close stops reporting the gauges of the ICMP status.
+func (p *ICMP) Close() error {
+	var err error
+	for _, unregister := range []func() error{p.rtt.Unregister, p.jitter.Unregister, p.loss.Unregister} {
+		if gaugeErr := unregister(); gaugeErr != nil && err == nil {
+			err = gaugeErr
+		}
+	}
+	return err
+}
+
+// Plugin returns the name of the ICMP plugin.
+func (p *ICMP) Plugin() string {
+	return PluginName
+}
+
+// State do the traces about the ICMP status.
+// It sends a burst of Count echo requests, every Interval.
+func (p *ICMP) State(ctx context.Context, tracer trace.Tracer, meter metric.Meter) (status.Result, error) {
+	metricCtx := status.WithoutCancel(ctx)
+
+	span := p.newSpan(ctx, tracer)
+	defer span.End()
+
+	ip, err := p.resolve(ctx)
+	if err != nil {
+		return status.Result{}, p.errorHandling(metricCtx, span, meter, err, "resolving address")
+	}
+	span.SetAttributes(semconv.NetSockPeerAddrKey.String(ip.String()))
+
+	e, err := listen(ip)
+	if err != nil {
+		return status.Result{}, p.errorHandling(metricCtx, span, meter, err, "opening ICMP socket")
+	}
+	defer e.Close()
+	span.SetAttributes(attribute.Bool("icmp.privileged", e.privileged))
+
+	b, err := p.burst(ctx, span, e, ip)
+	if err != nil {
+		return status.Result{}, p.errorHandling(metricCtx, span, meter, err, "sending echo requests")
+	}
+
+	s := b.stats()
+	span.SetAttributes(
+		attribute.Int("icmp.sent", b.sent),
+		attribute.Int("icmp.received", len(b.rtts)),
+		attribute.Float64("icmp.loss", s.loss),
+	)
+	if len(b.rtts) > 0 {
+		span.SetAttributes(
+			attribute.Float64("icmp.rtt.min", milliseconds(s.min)),
+			attribute.Float64("icmp.rtt.avg", milliseconds(s.avg)),
+			attribute.Float64("icmp.rtt.max", milliseconds(s.max)),
+			attribute.Float64("icmp.jitter", milliseconds(s.jitter)),
+		)
+	}
+
+	slog.Info("status",
+		slog.String("plugin", PluginName),
+		slog.String("address", p.Address),
+		slog.Int("sent", b.sent),
+		slog.Int("received", len(b.rtts)),
+		slog.Float64("loss", s.loss),
+		slog.Duration("avg", s.avg),
+	)
+
+	if err = p.recordMetricStats(meter, len(b.rtts) > 0, s); err != nil {
+		return status.Result{}, p.errorHandling(metricCtx, span, meter, err, "creating ICMP metrics")
+	}
+
+	up := len(b.rtts) > 0 && s.loss <= float64(p.MaxLoss)
+	if !up {
+		message := fmt.Sprintf("packet loss %.0f%%, %d/%d lost", s.loss, b.sent-len(b.rtts), b.sent)
+		span.SetStatus(codes.Error, message)
+		return status.Result{Up: false, Message: message}, nil
+	}
+	return status.Result{Up: true}, nil
+}
+
+// resolve returns the IP address to ping, an IPv4 one if any.
+func (p *ICMP) resolve(ctx context.Context) (net.IP, error) {
+	if ip := net.ParseIP(p.Address); ip != nil {
+		return ip, nil
+	}
+	addrs, err := net.DefaultResolver.LookupIPAddr(ctx, p.Address)
+	if err != nil {
+		return nil, err
+	}
+	if len(addrs) == 0 {
+		return nil, fmt.Errorf("no address for %q", p.Address)
+	}
+	for _, addr := range addrs {
+		if addr.IP.To4() != nil {
+			return addr.IP, nil
+		}
+	}
+	return addrs[0].IP, nil
+}
+
+// endpoint is an ICMP socket.
+type endpoint struct {
+	*icmp.PacketConn
+	// privileged is true for a raw socket, false for a datagram one.
+	privileged bool
+	ipv6       bool
+}
+
+// listen opens an unprivileged datagram ICMP socket for the IP version of ip,
+// or a raw socket if datagram ones are not allowed.
+func listen(ip net.IP) (*endpoint, error) {
+	network, rawNetwork, address := "udp4", "ip4:icmp", "0.0.0.0"
+	ipv6 := ip.To4() == nil
+	if ipv6 {
+		network, rawNetwork, address = "udp6", "ip6:ipv6-icmp", "::"
+	}
+	conn, err := icmp.ListenPacket(network, address)
+	if err == nil {
+		return &endpoint{PacketConn: conn, ipv6: ipv6}, nil
+	}
+	conn, rawErr := icmp.ListenPacket(rawNetwork, address)
+	if rawErr != nil {
+		return nil, fmt.Errorf("datagram socket: %v, raw socket: %w", err, rawErr)
+	}
+	return &endpoint{PacketConn: conn, privileged: true, ipv6: ipv6}, nil
+}
+
+// burst is the result of a burst of echo requests.
+type burst struct {
+	sent int
+	// rtts are the round-trip times of the replies.
+	rtts []time.Duration
+}
+
+// burst sends Count echo requests to ip, every Interval, and waits for their replies.
+// Each reply is an event of the span.
+func (p *ICMP) burst(ctx context.Context, span trace.Span, e *endpoint, ip net.IP) (burst, error) {
+	var b burst
+	// Datagram sockets get their identifier from the kernel.
+	id := nextID()
+	var dst net.Addr = &net.UDPAddr{IP: ip}
+	if e.privileged {
+		dst = &net.IPAddr{IP: ip}
+	}
+	var echoType icmp.Type = ipv4.ICMPTypeEcho
+	if e.ipv6 {
+		echoType = ipv6.ICMPTypeEchoRequest
+	}
+
+	start := time.Now()
+	for seq := 0; seq < p.Count; seq++ {
+		if seq > 0 {
+			if err := sleepUntil(ctx, start.Add(time.Duration(seq)*p.Interval)); err != nil {
+				return b, err
+			}
+		}
+		msg := icmp.Message{Type: echoType, Body: &icmp.Echo{ID: id, Seq: seq, Data: payload}}
+		request, err := msg.Marshal(nil)
+		if err != nil {
+			return b, err
+		}
+		sent := time.Now()
+		if _, err = e.WriteTo(request, dst); err != nil {
+			return b, err
+		}
+		b.sent++
+
+		deadline := sent.Add(p.Interval)
+		if ctxDeadline, ok := ctx.Deadline(); ok && ctxDeadline.Before(deadline) {
+			deadline = ctxDeadline
+		}
+		rtt, ok, err := e.waitReply(id, seq, ip, sent, deadline)
+		if err != nil {
+			return b, err
+		}
+		if ok {
+			b.rtts = append(b.rtts, rtt)
+			span.AddEvent("echo reply", trace.WithAttributes(
+				attribute.Int(icmpSeq, seq),
+				attribute.Float64("icmp.rtt", milliseconds(rtt)),
+			))
+		}
+		if err = ctx.Err(); err != nil {
+			return b, err
+		}
+	}
+	return b, nil
+}
+
+// waitReply waits until deadline for the reply to the echo request seq sent to ip.
+// It returns false if there is no reply.
+func (e *endpoint) waitReply(id, seq int, ip net.IP, sent, deadline time.Time) (time.Duration, bool, error) {
+	if err := e.SetReadDeadline(deadline); err != nil {
+		return 0, false, err
+	}
+	protocol, echoReply := ipv4.ICMPTypeEchoReply.Protocol(), icmp.Type(ipv4.ICMPTypeEchoReply)
+	if e.ipv6 {
+		protocol, echoReply = ipv6.ICMPTypeEchoReply.Protocol(), ipv6.ICMPTypeEchoReply
+	}
+	buf := make([]byte, maxReplySize)
+	for {
+		n, peer, err := e.ReadFrom(buf)
+		if err != nil {
+			var netErr net.Error
+			if errors.As(err, &netErr) && netErr.Timeout() {
+				return 0, false, nil
+			}
+			return 0, false, err
+		}
+		rtt := time.Since(sent)
+		msg, err := icmp.ParseMessage(protocol, buf[:n])
+		if err != nil || msg.Type != echoReply {
+			continue
+		}
+		echo, ok := msg.Body.(*icmp.Echo)
+		if !ok || echo.Seq != seq {
+			continue
+		}
+		// A raw socket receives all the ICMP messages of the host.
+		if e.privileged && (echo.ID != id || !peerIP(peer).Equal(ip)) {
+			continue
+		}
+		return rtt, true, nil
+	}
+}
+
+// peerIP returns the IP address of the peer of a reply.
+func peerIP(addr net.Addr) net.IP {
+	switch a := addr.(type) {
+	case *net.IPAddr:
+		return a.IP
+	case *net.UDPAddr:
+		return a.IP
+	default:
+		return nil
+	}
+}
+
+// nextID returns the identifier of a burst of echo requests,
+// different for the checks running at the same time.
+func nextID() int {
+	return int(atomic.AddUint32(&lastID, 1) & 0xffff)
+}
+
+// sleepUntil waits until t, or returns the error of ctx if it is done before.
+func sleepUntil(ctx context.Context, t time.Time) error {
+	timer := time.NewTimer(time.Until(t))
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
+
+// stats are the statistics of a burst.
+type stats struct {
+	min, avg, max time.Duration
+	// jitter is the mean difference between consecutive round-trip times.
+	jitter time.Duration
+	// loss is the percentage of lost packets.
+	loss float64
+}
+
+// stats returns the statistics of the burst, only the loss if there is no reply.
+func (b burst) stats() stats {
+	var s stats
+	if b.sent > 0 {
+		s.loss = float64(b.sent-len(b.rtts)) * 100 / float64(b.sent)
+	}
+	if len(b.rtts) == 0 {
+		return s
+	}
+	var sum, diffs time.Duration
+	s.min, s.max = b.rtts[0], b.rtts[0]
+	for i, rtt := range b.rtts {
+		sum += rtt
+		if rtt < s.min {
+			s.min = rtt
+		}
+		if rtt > s.max {
+			s.max = rtt
+		}
+		if i > 0 {
+			diff := rtt - b.rtts[i-1]
+			if diff < 0 {
+				diff = -diff
+			}
+			diffs += diff
+		}
+	}
+	s.avg = sum / time.Duration(len(b.rtts))
+	if len(b.rtts) > 1 {
+		s.jitter = diffs / time.Duration(len(b.rtts)-1)
+	}
+	return s
+}
+
+// milliseconds returns d in milliseconds.
+func milliseconds(d time.Duration) float64 {
+	return float64(d) / float64(time.Millisecond)
+}
+
+// newSpan creates a new span for the ICMP echo requests data.
+func (p *ICMP) newSpan(ctx context.Context, tracer trace.Tracer) trace.Span {
+	_, span := tracer.Start(ctx, fmt.Sprintf("ICMP %s", p.Address),
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(
+			attribute.String(status.OtelStatusPluginName, PluginName),
+			semconv.NetPeerNameKey.String(p.Address),
+			attribute.Int("icmp.count", p.Count),
+		),
+		trace.WithAttributes(p.configAttributes()...),
+	)
+	return span
+}
+
+// configAttributes returns the attributes from the config.
+func (p *ICMP) configAttributes() []attribute.KeyValue {
+	var valuesAttributes []attribute.KeyValue
+	for k, v := range p.Values {
+		valuesAttributes = append(valuesAttributes, attribute.String(k, status.Redact(v)))
+	}
+	return valuesAttributes
+}
+
+// metricAttributes returns the attributes of the metrics.
+func (p *ICMP) metricAttributes() []attribute.KeyValue {
+	return []attribute.KeyValue{
+		attribute.String(otelStatusICMPName, p.SC.Name),
+		attribute.String(otelStatusICMPAddress, p.Address),
+	}
+}
+
+// recordMetricStats records the round-trip times and the jitter, in milliseconds, and the packet loss in gauges.
+// The round-trip times and the jitter are not reported without reply.
+func (p *ICMP) recordMetricStats(meter metric.Meter, replied bool, s stats) error {
+	var rttPoints, jitterPoints []status.GaugePoint[float64]
+	if replied {
+		for _, stat := range []struct {
+			name  string
+			value time.Duration
+		}{{"min", s.min}, {"avg", s.avg}, {"max", s.max}} {
+			rttPoints = append(rttPoints, status.GaugePoint[float64]{
+				Value:      milliseconds(stat.value),
+				Attributes: append(p.metricAttributes(), attribute.String(icmpRTTStat, stat.name)),
+			})
+		}
+		jitterPoints = []status.GaugePoint[float64]{{Value: milliseconds(s.jitter), Attributes: p.metricAttributes()}}
+	}
+
+	err := p.rtt.Set(meter, otelStatusICMPRTT,
+		[]instrument.Option{
+			instrument.WithUnit(unit.Milliseconds),
+			instrument.WithDescription("Round-trip times of the latest ICMP echo requests"),
+		},
+		rttPoints...,
+	)
+	if err != nil {
+		return err
+	}
+	err = p.jitter.Set(meter, otelStatusICMPJitter,
+		[]instrument.Option{
+			instrument.WithUnit(unit.Milliseconds),
+			instrument.WithDescription("Jitter of the latest ICMP echo requests"),
+		},
+		jitterPoints...,
+	)
+	if err != nil {
+		return err
+	}
+	return p.loss.Set(meter, otelStatusICMPLoss,
+		[]instrument.Option{
+			instrument.WithUnit("%"),
+			instrument.WithDescription("Packet loss of the latest ICMP echo requests"),
+		},
+		status.GaugePoint[int64]{Value: int64(math.Round(s.loss)), Attributes: p.metricAttributes()},
+	)
+}
+
+// errorHandling is a helper function to handle errors.
+// It logs the error, records it in the span and in the error metric, and returns it.
+func (p *ICMP) errorHandling(ctx context.Context, span trace.Span, meter metric.Meter, err error, msg string) error {
+	e := status.RedactError(fmt.Errorf("%s: %w", msg, err))
+	attributes := status.RecordError(ctx, span, PluginName, msg, e, status.ErrorClass(e))
+	if inst, err := p.instruments.Get(meter, newInstruments); err == nil {
+		inst.error.Add(ctx, 1, append(p.metricAttributes(), attributes...)...)
+	}
+	return e
+}
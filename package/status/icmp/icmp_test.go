@@ -0,0 +1,173 @@
+/*******************************************************************************
+ * Copyright (c) 2023 Cedric L'homme.
+ *
+ * This file is part of otel-status.
+ *
+ * otel-status is free software: you can redistribute it and/or modify it
+ * under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License,
+ * or (at your option) any later version.
+ *
+ *  otel-status is distributed in the hope that it will be useful, but
+ *  WITHOUT ANY WARRANTY; without even the implied warranty of
+ *  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.
+ *  See the GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with otel-status. If not, see <https://www.gnu.org/licenses/>.
+ ******************************************************************************/
+
+package icmp_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/rangzen/otel-status/package/status"
+	"github.com/rangzen/otel-status/package/status/icmp"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/metric/unit"
+	"go.opentelemetry.io/otel/sdk/metric"
+	"go.opentelemetry.io/otel/sdk/metric/metricdata"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	neticmp "golang.org/x/net/icmp"
+)
+
+// skipWithoutICMP skips the test if neither datagram nor raw ICMP sockets are allowed.
+func skipWithoutICMP(t *testing.T) {
+	t.Helper()
+	conn, err := neticmp.ListenPacket("udp4", "127.0.0.1")
+	if err != nil {
+		conn, err = neticmp.ListenPacket("ip4:icmp", "127.0.0.1")
+	}
+	if err != nil {
+		t.Skipf("ICMP sockets not allowed: %v", err)
+	}
+	conn.Close()
+}
+
+func TestICMP_State(t *testing.T) {
+	t.Run("the loopback, should create a span without an error status and record the statistics", func(t *testing.T) {
+		skipWithoutICMP(t)
+
+		exp := tracetest.NewInMemoryExporter()
+		tp := sdktrace.NewTracerProvider(
+			sdktrace.WithSyncer(exp),
+		)
+		mockTracer := tp.Tracer("test-tracer")
+
+		rdr := metric.NewManualReader()
+		mp := metric.NewMeterProvider(metric.WithReader(rdr))
+		mockMeter := mp.Meter("test-meter")
+
+		stater, err := icmp.New(icmp.Config{
+			Config: status.Config{
+				Name:        "Test",
+				Description: "Test loopback",
+				Cron:        "@99m",
+			},
+			Address:  "127.0.0.1",
+			Count:    3,
+			Interval: 100 * time.Millisecond,
+		})
+		require.NoError(t, err)
+
+		res, err := stater.State(context.Background(), mockTracer, mockMeter)
+		require.NoError(t, err)
+		assert.True(t, res.Up)
+
+		spans := exp.GetSpans()
+		require.Len(t, spans, 1)
+		assert.Equal(t, codes.Unset, spans[0].Status.Code)
+		assert.Len(t, spans[0].Events, 3)
+		assert.Contains(t, spans[0].Attributes, attribute.Int("icmp.received", 3))
+
+		m, err := rdr.Collect(context.Background())
+		require.NoError(t, err)
+		require.Len(t, m.ScopeMetrics, 1)
+		got := map[string]int{}
+		for _, mm := range m.ScopeMetrics[0].Metrics {
+			switch data := mm.Data.(type) {
+			case metricdata.Gauge[int64]:
+				got[mm.Name] = len(data.DataPoints)
+				if mm.Name == "otelstatus.icmp.loss" {
+					assert.Equal(t, int64(0), data.DataPoints[0].Value)
+				}
+			case metricdata.Gauge[float64]:
+				// The round-trip times and the jitter are in milliseconds.
+				assert.Equal(t, unit.Milliseconds, mm.Unit, mm.Name)
+				got[mm.Name] = len(data.DataPoints)
+			}
+		}
+		assert.Equal(t, map[string]int{
+			"otelstatus.icmp.rtt":    3,
+			"otelstatus.icmp.jitter": 1,
+			"otelstatus.icmp.loss":   1,
+		}, got)
+	})
+
+	t.Run("an unknown host, should create a span with an error status", func(t *testing.T) {
+		exp := tracetest.NewInMemoryExporter()
+		tp := sdktrace.NewTracerProvider(
+			sdktrace.WithSyncer(exp),
+		)
+		mockTracer := tp.Tracer("test-tracer")
+		mp := metric.NewMeterProvider()
+		mockMeter := mp.Meter("test-meter")
+
+		stater, err := icmp.New(icmp.Config{
+			Config:  status.Config{Name: "Test", Description: "Test unknown host", Cron: "@99m"},
+			Address: "unknown.invalid",
+		})
+		require.NoError(t, err)
+
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		_, err = stater.State(ctx, mockTracer, mockMeter)
+		require.Error(t, err)
+
+		spans := exp.GetSpans()
+		require.Len(t, spans, 1)
+		assert.Equal(t, codes.Error, spans[0].Status.Code)
+	})
+}
+
+func TestICMP_New(t *testing.T) {
+	t.Run("a configuration without count and interval, should use the defaults", func(t *testing.T) {
+		stater, err := icmp.New(icmp.Config{Address: "192.0.2.1"})
+		require.NoError(t, err)
+		assert.Equal(t, 3, stater.Count)
+		assert.Equal(t, time.Second, stater.Interval)
+	})
+
+	t.Run("a configuration without address, should return an error", func(t *testing.T) {
+		_, err := icmp.New(icmp.Config{})
+		var configErr *status.ConfigError
+		require.ErrorAs(t, err, &configErr)
+		assert.Equal(t, "address", configErr.Field)
+	})
+
+	t.Run("a burst longer than the timeout, should return an error", func(t *testing.T) {
+		_, err := icmp.New(icmp.Config{
+			Config:   status.Config{Timeout: 5 * time.Second},
+			Address:  "192.0.2.1",
+			Count:    5,
+			Interval: time.Second,
+		})
+		var configErr *status.ConfigError
+		require.ErrorAs(t, err, &configErr)
+		assert.Equal(t, "count", configErr.Field)
+	})
+
+	t.Run("a max loss above 100, should return an error", func(t *testing.T) {
+		_, err := icmp.New(icmp.Config{Address: "192.0.2.1", MaxLoss: 101})
+		var configErr *status.ConfigError
+		require.ErrorAs(t, err, &configErr)
+		assert.Equal(t, "max_loss", configErr.Field)
+	})
+}
@@ -0,0 +1,51 @@
+/*******************************************************************************
+ * Copyright (c) 2023 Cedric L'homme.
+ *
+ * This file is part of otel-status.
+ *
+ * otel-status is free software: you can redistribute it and/or modify it
+ * under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License,
+ * or (at your option) any later version.
+ *
+ *  otel-status is distributed in the hope that it will be useful, but
+ *  WITHOUT ANY WARRANTY; without even the implied warranty of
+ *  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.
+ *  See the GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with otel-status. If not, see <https://www.gnu.org/licenses/>.
+ ******************************************************************************/
+
+package status
+
+import (
+	"sync"
+
+	"go.opentelemetry.io/otel/metric"
+)
+
+// Instruments caches the synchronous instruments of a stater, T, for the meter they are created with.
+// The zero value is ready to use.
+type Instruments[T any] struct {
+	mu          sync.Mutex
+	meter       metric.Meter
+	instruments T
+}
+
+// Get returns the instruments of the meter.
+// They are created with create on the first call, and again when the meter changes or after an error.
+func (i *Instruments[T]) Get(meter metric.Meter, create func(meter metric.Meter) (T, error)) (T, error) {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	if i.meter != nil && i.meter == meter {
+		return i.instruments, nil
+	}
+	instruments, err := create(meter)
+	if err != nil {
+		var zero T
+		return zero, err
+	}
+	i.meter, i.instruments = meter, instruments
+	return instruments, nil
+}
@@ -21,28 +21,130 @@
 package status
 
 import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
 	"strings"
+	"time"
 
+	"github.com/robfig/cron/v3"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
 	"go.opentelemetry.io/otel/metric"
 	"go.opentelemetry.io/otel/trace"
+	"golang.org/x/exp/slog"
 )
 
 const (
 	// OtelStatusPluginName is the key for the plugin name.
 	OtelStatusPluginName = "otelstatus.plugin.name"
+	// OtelStatusName is the key for the name of a check.
+	OtelStatusName = "otelstatus.name"
+	// OtelStatusUp is the name of the gauge of the up (1) or down (0) status of the checks, see Check.
+	OtelStatusUp = "otelstatus.up"
+	// OtelStatusErrorClass is the key for the class of an error, see ErrorClass.
+	OtelStatusErrorClass = "error.class"
 )
 
+const (
+	// ErrorClassTimeout is the class of the errors due to a timeout.
+	ErrorClassTimeout = "timeout"
+	// ErrorClassCanceled is the class of the errors due to a cancellation.
+	ErrorClassCanceled = "canceled"
+	// ErrorClassError is the class of all the other errors.
+	ErrorClassError = "error"
+)
+
+// DefaultTimeout is the timeout of a status if none is configured.
+const DefaultTimeout = 30 * time.Second
+
 // Stater is the interface that wraps the Config methods.
 type Stater interface {
 	Config() Config
-	State(tracer trace.Tracer, meter metric.Meter) error
+	// Plugin returns the name of the plugin of the stater.
+	Plugin() string
+	// State checks the status. It must return as soon as possible when ctx is done.
+	// A check that fails without an error, e.g. an unexpected HTTP status code, returns a Result that is not up.
+	State(ctx context.Context, tracer trace.Tracer, meter metric.Meter) (Result, error)
+}
+
+// Result is the outcome of a check.
+type Result struct {
+	// Up is true if the checked service is healthy.
+	Up bool
+	// Message describes why the service is not healthy, empty when it is up.
+	Message string
 }
 
 // Config is the main structure to use status.
+// It is shared by the configuration of all the plugins, inlined in their YAML configuration.
 type Config struct {
-	Name        string
-	Description string
-	Cron        string
+	Name        string `yaml:"name"`
+	Description string `yaml:"description"`
+	Cron        string `yaml:"cron" default:"@10m"`
+	// Jitter is the maximum random delay before each scheduled run of the check.
+	Jitter time.Duration `yaml:"jitter"`
+	// Timeout is the maximum duration of an attempt of a check, DefaultTimeout if zero.
+	Timeout time.Duration `yaml:"timeout"`
+	// Retries is the number of retries of a failed attempt before the check fails.
+	Retries int `yaml:"retries"`
+	// RetryInterval is the wait before a retry, see Backoff.
+	RetryInterval time.Duration `yaml:"retry_interval" default:"1s"`
+	// Backoff is BackoffConstant (default) or BackoffExponential.
+	Backoff string `yaml:"backoff"`
+	// FailureThreshold is the number of consecutive failed runs to report an up check down, 1 if zero.
+	FailureThreshold int `yaml:"failure_threshold"`
+	// SuccessThreshold is the number of consecutive successful runs to report a down check up, 1 if zero.
+	SuccessThreshold int `yaml:"success_threshold"`
+}
+
+// EffectiveTimeout returns the timeout of the check, DefaultTimeout if none is configured.
+func (s Config) EffectiveTimeout() time.Duration {
+	if s.Timeout <= 0 {
+		return DefaultTimeout
+	}
+	return s.Timeout
+}
+
+// Validate returns a *ConfigError if the cron, the timeout, the retries or the thresholds are invalid.
+// The cron is either a duration prefixed by @, or a standard cron expression.
+func (s Config) Validate() error {
+	if s.IsDuration() {
+		d, err := time.ParseDuration(s.CronDuration())
+		if err != nil {
+			return &ConfigError{Field: "cron", Err: err}
+		}
+		if d <= 0 {
+			return &ConfigError{Field: "cron", Err: fmt.Errorf("duration %s must be positive", d)}
+		}
+	} else if _, err := cron.ParseStandard(s.Cron); err != nil {
+		return &ConfigError{Field: "cron", Err: err}
+	}
+	if s.Jitter < 0 {
+		return &ConfigError{Field: "jitter", Err: fmt.Errorf("jitter %s must not be negative", s.Jitter)}
+	}
+	if s.Timeout < 0 {
+		return &ConfigError{Field: "timeout", Err: fmt.Errorf("timeout %s must not be negative", s.Timeout)}
+	}
+	return s.validateRetries()
+}
+
+// ConfigError is an error in a field of the configuration of a check.
+type ConfigError struct {
+	// Field is the YAML key of the field.
+	Field string
+	Err   error
+}
+
+// Error implements the error interface.
+func (e *ConfigError) Error() string {
+	return e.Field + ": " + e.Err.Error()
+}
+
+// Unwrap returns the underlying error.
+func (e *ConfigError) Unwrap() error {
+	return e.Err
 }
 
 // CronExp returns the cron expression.
@@ -60,3 +162,58 @@ func (s Config) IsDuration() bool {
 func (s Config) CronDuration() string {
 	return s.Cron[1:]
 }
+
+// ErrorClass returns the class of the error: ErrorClassTimeout, ErrorClassCanceled or ErrorClassError.
+func ErrorClass(err error) string {
+	var netErr net.Error
+	switch {
+	case errors.Is(err, context.DeadlineExceeded):
+		return ErrorClassTimeout
+	case errors.As(err, &netErr) && netErr.Timeout():
+		return ErrorClassTimeout
+	case errors.Is(err, context.Canceled):
+		return ErrorClassCanceled
+	default:
+		return ErrorClassError
+	}
+}
+
+// RecordError logs the error of an attempt of the plugin, and records it in the span with its class, e.g. ErrorClass(err).
+// The error must be redacted, see RedactError.
+// It returns the attributes of the error counter of the plugin:
+// the message, the class and the verdict of the attempt of ctx, see VerdictAttribute.
+func RecordError(ctx context.Context, span trace.Span, plugin, msg string, err error, class string) []attribute.KeyValue {
+	slog.Error(msg, err, slog.String("plugin", plugin), slog.String("class", class))
+	span.RecordError(err)
+	span.SetStatus(codes.Error, err.Error())
+	span.SetAttributes(attribute.String(OtelStatusErrorClass, class))
+	return []attribute.KeyValue{
+		attribute.String("error.message", err.Error()),
+		attribute.String(OtelStatusErrorClass, class),
+		VerdictAttribute(ctx),
+	}
+}
+
+// WithoutCancel returns a copy of ctx that is never done.
+// Measurements are dropped by the SDK when the context is done,
+// so a check that times out must record its metrics with such a context.
+func WithoutCancel(ctx context.Context) context.Context {
+	return detachedContext{parent: ctx}
+}
+
+// detachedContext keeps the values of its parent without its deadline and cancellation.
+type detachedContext struct {
+	parent context.Context
+}
+
+// Deadline implements context.Context, a detachedContext has no deadline.
+func (detachedContext) Deadline() (time.Time, bool) { return time.Time{}, false }
+
+// Done implements context.Context, a detachedContext is never done.
+func (detachedContext) Done() <-chan struct{} { return nil }
+
+// Err implements context.Context, a detachedContext is never canceled.
+func (detachedContext) Err() error { return nil }
+
+// Value implements context.Context with the values of the parent.
+func (d detachedContext) Value(key interface{}) interface{} { return d.parent.Value(key) }
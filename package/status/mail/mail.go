@@ -0,0 +1,441 @@
+/*******************************************************************************
+ * Copyright (c) 2023 Cedric L'homme.
+ *
+ * This file is part of otel-status.
+ *
+ * otel-status is free software: you can redistribute it and/or modify it
+ * under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License,
+ * or (at your option) any later version.
+ *
+ *  otel-status is distributed in the hope that it will be useful, but
+ *  WITHOUT ANY WARRANTY; without even the implied warranty of
+ *  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.
+ *  See the GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with otel-status. If not, see <https://www.gnu.org/licenses/>.
+ ******************************************************************************/
+
+// Package mail is the package to get status of SMTP, IMAP and POP3 servers.
+package mail
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"net"
+	"net/textproto"
+	"strings"
+	"time"
+
+	"github.com/rangzen/otel-status/package/status"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/metric"
+	"go.opentelemetry.io/otel/metric/instrument"
+	"go.opentelemetry.io/otel/metric/unit"
+	"go.opentelemetry.io/otel/semconv/v1.17.0"
+	"go.opentelemetry.io/otel/trace"
+	"golang.org/x/exp/slog"
+)
+
+const (
+	// PluginSMTP is the name of the SMTP plugin.
+	PluginSMTP = "smtp"
+	// PluginIMAP is the name of the IMAP plugin.
+	PluginIMAP = "imap"
+	// PluginPOP3 is the name of the POP3 plugin.
+	PluginPOP3 = "pop3"
+)
+
+const (
+	otelStatusMailName           = "otelstatus.mail.name"
+	otelStatusMailAddress        = "otelstatus.mail.address"
+	otelStatusMailProtocol       = "otelstatus.mail.protocol"
+	otelStatusMailBanner         = "otelstatus.mail.banner"
+	otelStatusMailBannerDuration = "otelstatus.mail.banner.duration"
+	otelStatusMailDuration       = "otelstatus.mail.duration"
+	otelStatusMailError          = "otelstatus.mail.error"
+	otelStatusMailTLSExpiry      = "otelstatus.mail.tls.expiry"
+)
+
+// Config is the configuration for a mail server status.
+type Config struct {
+	status.Config `yaml:",inline"`
+	// Address is the host:port of the server.
+	Address string `yaml:"address"`
+	// TLS enables TLS if set, from the connection or after STARTTLS.
+	TLS *status.TLSConfig `yaml:"tls"`
+	// StartTLS upgrades the plain connection to TLS with STARTTLS, or STLS for POP3.
+	StartTLS bool `yaml:"starttls"`
+	// Hostname is the name sent with EHLO, SMTP only.
+	Hostname string `yaml:"hostname" default:"localhost"`
+	// Username and Password authenticate the session if the username is set.
+	Username string `yaml:"username"`
+	Password string `yaml:"password" secret:"true"`
+	// AllowPlaintextAuth allows to authenticate without TLS, the credentials are sent in clear on the network.
+	AllowPlaintextAuth bool `yaml:"allow_plaintext_auth"`
+	// Values is a map of key/value to add to the spans.
+	Values map[string]string `yaml:"values"`
+}
+
+// Mail is the main structure to use mail server status.
+type Mail struct {
+	SC       status.Config
+	Protocol string
+	Address  string
+	TLS      *status.TLSConfig
+	StartTLS bool
+	Hostname string
+	Username string
+	Password string
+	Values   map[string]string
+	// newDialect returns the commands of the protocol for a new session.
+	newDialect func() dialect
+	// tlsExpiry reports the days before the expiration of the certificate.
+	tlsExpiry   status.Gauge[int64]
+	instruments status.Instruments[instruments]
+}
+
+// dialect is the commands of a mail protocol.
+// A response with an unexpected code returns a *ResponseError.
+type dialect interface {
+	// greeting reads the banner of the server.
+	greeting(c *textproto.Conn) (string, error)
+	// hello introduces the client, after the greeting and after STARTTLS.
+	hello(c *textproto.Conn, hostname string) error
+	startTLS(c *textproto.Conn) error
+	login(c *textproto.Conn, username, password string) error
+	quit(c *textproto.Conn) error
+}
+
+// ResponseError is an unexpected response of the server.
+type ResponseError struct {
+	Command  string
+	Response string
+}
+
+func (e *ResponseError) Error() string {
+	return fmt.Sprintf("unexpected response to %s: %s", e.Command, e.Response)
+}
+
+// instruments are the synchronous instruments of the mail server status.
+type instruments struct {
+	bannerDuration instrument.Int64Histogram
+	duration       instrument.Int64Histogram
+	error          instrument.Int64Counter
+}
+
+// newInstruments creates the synchronous instruments of the mail server status on the meter.
+func newInstruments(meter metric.Meter) (instruments, error) {
+	var i instruments
+	var err error
+	i.bannerDuration, err = meter.Int64Histogram(
+		otelStatusMailBannerDuration,
+		instrument.WithUnit(unit.Milliseconds),
+		instrument.WithDescription("Duration from the connection to the greeting banner of the mail server"),
+	)
+	if err != nil {
+		return i, fmt.Errorf("creating mail banner duration metric: %w", err)
+	}
+	i.duration, err = meter.Int64Histogram(
+		otelStatusMailDuration,
+		instrument.WithUnit(unit.Milliseconds),
+		instrument.WithDescription("Duration of the mail server check"),
+	)
+	if err != nil {
+		return i, fmt.Errorf("creating mail duration metric: %w", err)
+	}
+	i.error, err = meter.Int64Counter(
+		otelStatusMailError,
+		instrument.WithUnit(unit.Dimensionless),
+		instrument.WithDescription("Error of the mail server check"),
+	)
+	if err != nil {
+		return i, fmt.Errorf("creating mail error metric: %w", err)
+	}
+	return i, nil
+}
+
+// NewSMTP returns the SMTP status of the configuration.
+func NewSMTP(c Config) (*Mail, error) {
+	return newMail(PluginSMTP, c, func() dialect { return smtp{} })
+}
+
+// NewIMAP returns the IMAP status of the configuration.
+func NewIMAP(c Config) (*Mail, error) {
+	return newMail(PluginIMAP, c, func() dialect { return &imap{} })
+}
+
+// NewPOP3 returns the POP3 status of the configuration.
+func NewPOP3(c Config) (*Mail, error) {
+	return newMail(PluginPOP3, c, func() dialect { return pop3{} })
+}
+
+// newMail returns the mail server status of the protocol.
+// The password is registered as a secret.
+func newMail(protocol string, c Config, newDialect func() dialect) (*Mail, error) {
+	if _, _, err := net.SplitHostPort(c.Address); err != nil {
+		return nil, &status.ConfigError{Field: "address", Err: err}
+	}
+	if c.Password != "" && c.Username == "" {
+		return nil, &status.ConfigError{Field: "username", Err: errors.New("a username is needed with a password")}
+	}
+	if c.Username != "" && c.TLS == nil && !c.StartTLS && !c.AllowPlaintextAuth {
+		return nil, &status.ConfigError{
+			Field: "username",
+			Err:   errors.New("authentication needs tls or starttls, or allow_plaintext_auth to send the credentials in clear"),
+		}
+	}
+	if c.Hostname == "" {
+		c.Hostname = "localhost"
+	}
+	status.RegisterSecret(c.Password)
+	return &Mail{
+		SC:         c.Config,
+		Protocol:   protocol,
+		Address:    c.Address,
+		TLS:        c.TLS,
+		StartTLS:   c.StartTLS,
+		Hostname:   c.Hostname,
+		Username:   c.Username,
+		Password:   c.Password,
+		Values:     c.Values,
+		newDialect: newDialect,
+	}, nil
+}
+
+// Config returns the status.Config of the mail server status.
+func (m *Mail) Config() status.Config {
+	return m.SC
+}
+
+// Close stops reporting the gauges of the mail server status.
+func (m *Mail) Close() error {
+	return m.tlsExpiry.Unregister()
+}
+
+// Plugin returns the name of the plugin, the protocol.
+func (m *Mail) Plugin() string {
+	return m.Protocol
+}
+
+// State do the traces about the mail server status.
+// It reads the greeting, negotiates TLS and authenticates if configured.
+// An unexpected response of the server sets the status down.
+func (m *Mail) State(ctx context.Context, tracer trace.Tracer, meter metric.Meter) (status.Result, error) {
+	start := time.Now()
+	metricCtx := status.WithoutCancel(ctx)
+
+	span := m.newSpan(ctx, tracer)
+	defer span.End()
+
+	conn, err := m.dial(ctx)
+	if err != nil {
+		m.recordMetricFailedTLSExpiry(meter, err)
+		return status.Result{}, m.errorHandling(metricCtx, span, meter, err, "connecting")
+	}
+	defer conn.Close()
+	connected := time.Now()
+
+	if deadline, ok := ctx.Deadline(); ok {
+		if err = conn.SetDeadline(deadline); err != nil {
+			return status.Result{}, m.errorHandling(metricCtx, span, meter, err, "setting deadline")
+		}
+	}
+
+	d := m.newDialect()
+	c := textproto.NewConn(conn)
+	banner, err := d.greeting(c)
+	if err != nil {
+		return m.sessionFailure(metricCtx, span, meter, err, "reading greeting")
+	}
+	bannerTime := time.Since(connected).Milliseconds()
+	span.SetAttributes(
+		attribute.String(otelStatusMailBanner, banner),
+		attribute.Int64(otelStatusMailBannerDuration, bannerTime),
+	)
+
+	if err = d.hello(c, m.Hostname); err != nil {
+		return m.sessionFailure(metricCtx, span, meter, err, "introducing the client")
+	}
+
+	if m.StartTLS {
+		if err = d.startTLS(c); err != nil {
+			return m.sessionFailure(metricCtx, span, meter, err, "starting TLS")
+		}
+		if conn, err = m.handshake(ctx, conn); err != nil {
+			m.recordMetricFailedTLSExpiry(meter, err)
+			return status.Result{}, m.errorHandling(metricCtx, span, meter, err, "starting TLS")
+		}
+		defer conn.Close()
+		c = textproto.NewConn(conn)
+		if err = d.hello(c, m.Hostname); err != nil {
+			return m.sessionFailure(metricCtx, span, meter, err, "introducing the client")
+		}
+	}
+
+	if tlsConn, ok := conn.(*tls.Conn); ok {
+		state := tlsConn.ConnectionState()
+		span.SetAttributes(status.TLSAttributes(&state)...)
+		if err = m.recordMetricTLSExpiry(meter, &state); err != nil {
+			return status.Result{}, m.errorHandling(metricCtx, span, meter, err, "creating mail TLS expiry metric")
+		}
+	}
+
+	if m.Username != "" {
+		if err = d.login(c, m.Username, m.Password); err != nil {
+			return m.sessionFailure(metricCtx, span, meter, err, "authenticating")
+		}
+		span.AddEvent("authenticated")
+	}
+
+	if err = d.quit(c); err != nil {
+		return m.sessionFailure(metricCtx, span, meter, err, "quitting")
+	}
+
+	elapsedTime := time.Since(start).Milliseconds()
+	span.SetAttributes(attribute.Int64("duration", elapsedTime))
+	slog.Info("status",
+		slog.String("plugin", m.Protocol),
+		slog.String("address", m.Address),
+		slog.Int64("banner", bannerTime),
+		slog.Int64("duration", elapsedTime),
+	)
+
+	inst, err := m.instruments.Get(meter, newInstruments)
+	if err != nil {
+		return status.Result{}, m.errorHandling(metricCtx, span, meter, err, "creating mail metrics")
+	}
+	inst.bannerDuration.Record(metricCtx, bannerTime, m.metricAttributes()...)
+	inst.duration.Record(metricCtx, elapsedTime, m.metricAttributes()...)
+	return status.Result{Up: true}, nil
+}
+
+// sessionFailure handles an error of the session.
+// An unexpected response sets the span status to error and the status down, other errors are handled by errorHandling.
+func (m *Mail) sessionFailure(ctx context.Context, span trace.Span, meter metric.Meter, err error, msg string) (status.Result, error) {
+	var responseErr *ResponseError
+	if !errors.As(err, &responseErr) {
+		return status.Result{}, m.errorHandling(ctx, span, meter, err, msg)
+	}
+
+	message := status.Redact(fmt.Sprintf("%s: %s", msg, responseErr.Error()))
+	span.SetStatus(codes.Error, message)
+	slog.Warn("unexpected response",
+		slog.String("plugin", m.Protocol),
+		slog.String("address", m.Address),
+		slog.String("response", message),
+	)
+	return status.Result{Up: false, Message: message}, nil
+}
+
+// dial opens the connection, with TLS if configured without STARTTLS.
+func (m *Mail) dial(ctx context.Context) (net.Conn, error) {
+	dialer := &net.Dialer{}
+	conn, err := dialer.DialContext(ctx, "tcp", m.Address)
+	if err != nil || m.StartTLS || m.TLS == nil {
+		return conn, err
+	}
+	return m.handshake(ctx, conn)
+}
+
+// handshake returns the connection upgraded to TLS.
+// The connection is closed on error.
+func (m *Mail) handshake(ctx context.Context, conn net.Conn) (net.Conn, error) {
+	var tlsConfig *tls.Config
+	if m.TLS != nil {
+		var err error
+		if tlsConfig, err = m.TLS.ClientConfig(); err != nil {
+			conn.Close()
+			return nil, err
+		}
+	} else {
+		tlsConfig = &tls.Config{MinVersion: tls.VersionTLS10}
+	}
+	if tlsConfig.ServerName == "" {
+		tlsConfig.ServerName, _, _ = net.SplitHostPort(m.Address)
+	}
+	tlsConn := tls.Client(conn, tlsConfig)
+	if err := tlsConn.HandshakeContext(ctx); err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("TLS handshake: %w", err)
+	}
+	return tlsConn, nil
+}
+
+// newSpan creates a new span for the mail server check data.
+func (m *Mail) newSpan(ctx context.Context, tracer trace.Tracer) trace.Span {
+	host, port, _ := net.SplitHostPort(m.Address)
+	_, span := tracer.Start(ctx, fmt.Sprintf("%s %s", strings.ToUpper(m.Protocol), m.Address),
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(
+			attribute.String(status.OtelStatusPluginName, m.Protocol),
+			attribute.String(otelStatusMailProtocol, m.Protocol),
+			semconv.NetTransportTCP,
+			semconv.NetPeerNameKey.String(host),
+			semconv.NetPeerPortKey.String(port),
+		),
+		trace.WithAttributes(m.configAttributes()...),
+	)
+	return span
+}
+
+// configAttributes returns the attributes from the config.
+func (m *Mail) configAttributes() []attribute.KeyValue {
+	var valuesAttributes []attribute.KeyValue
+	for k, v := range m.Values {
+		valuesAttributes = append(valuesAttributes, attribute.String(k, status.Redact(v)))
+	}
+	return valuesAttributes
+}
+
+// metricAttributes returns the attributes of the metrics.
+func (m *Mail) metricAttributes() []attribute.KeyValue {
+	return []attribute.KeyValue{
+		attribute.String(otelStatusMailName, m.SC.Name),
+		attribute.String(otelStatusMailAddress, m.Address),
+		attribute.String(otelStatusMailProtocol, m.Protocol),
+	}
+}
+
+// recordMetricTLSExpiry records the days before the expiration of the leaf certificate in a gauge.
+func (m *Mail) recordMetricTLSExpiry(meter metric.Meter, state *tls.ConnectionState) error {
+	days, ok := status.CertificateExpiryDays(state, time.Now())
+	if !ok {
+		return nil
+	}
+	return m.tlsExpiry.Set(meter, otelStatusMailTLSExpiry,
+		[]instrument.Option{
+			instrument.WithUnit("d"),
+			instrument.WithDescription("Days before the expiration of the TLS certificate"),
+		},
+		status.GaugePoint[int64]{Value: days, Attributes: m.metricAttributes()},
+	)
+}
+
+// recordMetricFailedTLSExpiry records the expiry of the certificate whose verification failed in err, if any.
+// The expiry is still known when the verification of the certificate fails, e.g. once expired.
+func (m *Mail) recordMetricFailedTLSExpiry(meter metric.Meter, err error) {
+	leaf := status.FailedCertificate(err)
+	if leaf == nil {
+		return
+	}
+	if tlsErr := m.recordMetricTLSExpiry(meter, &tls.ConnectionState{PeerCertificates: []*x509.Certificate{leaf}}); tlsErr != nil {
+		slog.Error("creating mail TLS expiry metric", tlsErr, slog.String("plugin", m.Protocol))
+	}
+}
+
+// errorHandling is a helper function to handle errors.
+// It logs the error, records it in the span and in the error metric, and returns it.
+func (m *Mail) errorHandling(ctx context.Context, span trace.Span, meter metric.Meter, err error, msg string) error {
+	e := status.RedactError(fmt.Errorf("%s: %w", msg, err))
+	attributes := status.RecordError(ctx, span, m.Protocol, msg, e, status.ErrorClass(e))
+	if inst, err := m.instruments.Get(meter, newInstruments); err == nil {
+		inst.error.Add(ctx, 1, append(m.metricAttributes(), attributes...)...)
+	}
+	return e
+}
@@ -0,0 +1,408 @@
+/*******************************************************************************
+ * Copyright (c) 2023 Cedric L'homme.
+ *
+ * This file is part of otel-status.
+ *
+ * otel-status is free software: you can redistribute it and/or modify it
+ * under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License,
+ * or (at your option) any later version.
+ *
+ *  otel-status is distributed in the hope that it will be useful, but
+ *  WITHOUT ANY WARRANTY; without even the implied warranty of
+ *  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.
+ *  See the GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with otel-status. If not, see <https://www.gnu.org/licenses/>.
+ ******************************************************************************/
+
+package mail_test
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"fmt"
+	"math/big"
+	"net"
+	"net/http/httptest"
+	"net/textproto"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/rangzen/otel-status/package/status"
+	"github.com/rangzen/otel-status/package/status/mail"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/sdk/metric"
+	"go.opentelemetry.io/otel/sdk/metric/metricdata"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+// certificate returns the self-signed certificate of httptest.
+func certificate(t *testing.T) tls.Certificate {
+	s := httptest.NewTLSServer(nil)
+	defer s.Close()
+	return s.TLS.Certificates[0]
+}
+
+// expiredCertificate returns a self-signed certificate for 127.0.0.1 that expired an hour ago.
+func expiredCertificate(t *testing.T) tls.Certificate {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "expired"},
+		IPAddresses:  []net.IP{net.IPv4(127, 0, 0, 1)},
+		NotBefore:    time.Now().Add(-48 * time.Hour),
+		NotAfter:     time.Now().Add(-time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	require.NoError(t, err)
+	return tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key}
+}
+
+// serve runs the session on each connection accepted by the listener, and returns its address.
+func serve(t *testing.T, l net.Listener, session func(c *textproto.Conn, conn net.Conn)) string {
+	t.Cleanup(func() { l.Close() })
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				session(textproto.NewConn(conn), conn)
+			}()
+		}
+	}()
+	return l.Addr().String()
+}
+
+// listen returns a local listener.
+func listen(t *testing.T) net.Listener {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	return l
+}
+
+// smtpSession is a fake SMTP server with STARTTLS and AUTH PLAIN.
+func smtpSession(cert tls.Certificate, credentials string) func(c *textproto.Conn, conn net.Conn) {
+	return func(c *textproto.Conn, conn net.Conn) {
+		_ = c.PrintfLine("220-mail.test ESMTP")
+		_ = c.PrintfLine("220 ready")
+		for {
+			line, err := c.ReadLine()
+			if err != nil {
+				return
+			}
+			switch command, arg, _ := strings.Cut(line, " "); command {
+			case "EHLO":
+				_ = c.PrintfLine("250-mail.test")
+				_ = c.PrintfLine("250-STARTTLS")
+				_ = c.PrintfLine("250 AUTH PLAIN")
+			case "STARTTLS":
+				_ = c.PrintfLine("220 go ahead")
+				tlsConn := tls.Server(conn, &tls.Config{Certificates: []tls.Certificate{cert}})
+				if tlsConn.Handshake() != nil {
+					return
+				}
+				conn, c = tlsConn, textproto.NewConn(tlsConn)
+			case "AUTH":
+				if arg != "PLAIN "+credentials {
+					_ = c.PrintfLine("535 5.7.8 authentication failed")
+					continue
+				}
+				_ = c.PrintfLine("235 2.7.0 authenticated")
+			case "QUIT":
+				_ = c.PrintfLine("221 bye")
+				return
+			default:
+				_ = c.PrintfLine("502 unknown command")
+			}
+		}
+	}
+}
+
+// imapSession is a fake IMAP server with LOGIN.
+func imapSession(c *textproto.Conn, _ net.Conn) {
+	_ = c.PrintfLine("* OK IMAP4rev1 ready")
+	for {
+		line, err := c.ReadLine()
+		if err != nil {
+			return
+		}
+		fields := strings.Fields(line)
+		switch fields[1] {
+		case "LOGIN":
+			if fields[3] != `"s3cr3t"` {
+				_ = c.PrintfLine("%s NO [AUTHENTICATIONFAILED] invalid credentials", fields[0])
+				continue
+			}
+			_ = c.PrintfLine("%s OK LOGIN completed", fields[0])
+		case "LOGOUT":
+			_ = c.PrintfLine("* BYE logging out")
+			_ = c.PrintfLine("%s OK LOGOUT completed", fields[0])
+			return
+		default:
+			_ = c.PrintfLine("%s BAD unknown command", fields[0])
+		}
+	}
+}
+
+// pop3Session is a fake POP3 server with USER and PASS.
+func pop3Session(c *textproto.Conn, _ net.Conn) {
+	_ = c.PrintfLine("+OK POP3 ready")
+	for {
+		line, err := c.ReadLine()
+		if err != nil {
+			return
+		}
+		switch command, arg, _ := strings.Cut(line, " "); command {
+		case "USER":
+			_ = c.PrintfLine("+OK")
+		case "PASS":
+			if arg != "s3cr3t" {
+				_ = c.PrintfLine("-ERR [AUTH] invalid password")
+				continue
+			}
+			_ = c.PrintfLine("+OK logged in")
+		case "QUIT":
+			_ = c.PrintfLine("+OK bye")
+			return
+		default:
+			_ = c.PrintfLine("-ERR unknown command")
+		}
+	}
+}
+
+func TestMail_State(t *testing.T) {
+	cert := certificate(t)
+	// The credentials of AUTH PLAIN for user and s3cr3t.
+	smtpCredentials := "AHVzZXIAczNjcjN0"
+
+	tests := []struct {
+		name     string
+		newMail  func(mail.Config) (*mail.Mail, error)
+		listener func(t *testing.T) net.Listener
+		session  func(c *textproto.Conn, conn net.Conn)
+		config   mail.Config
+		up       bool
+		message  string
+		tls      bool
+	}{
+		{
+			name:     "an SMTP server with STARTTLS and AUTH, should create a span without an error status",
+			newMail:  mail.NewSMTP,
+			listener: listen,
+			session:  smtpSession(cert, smtpCredentials),
+			config: mail.Config{
+				TLS:      &status.TLSConfig{InsecureSkipVerify: true},
+				StartTLS: true,
+				Username: "user",
+				Password: "s3cr3t",
+			},
+			up:  true,
+			tls: true,
+		},
+		{
+			name:     "an SMTP server refusing the credentials, should create a span with an error status",
+			newMail:  mail.NewSMTP,
+			listener: listen,
+			session:  smtpSession(cert, smtpCredentials),
+			config:   mail.Config{Username: "user", Password: "wrong-pa55", AllowPlaintextAuth: true},
+			message:  "authenticating: unexpected response to AUTH: 535 5.7.8 authentication failed",
+		},
+		{
+			name:    "an IMAP server with implicit TLS and LOGIN, should create a span without an error status",
+			newMail: mail.NewIMAP,
+			listener: func(t *testing.T) net.Listener {
+				return tls.NewListener(listen(t), &tls.Config{Certificates: []tls.Certificate{cert}})
+			},
+			session: imapSession,
+			config: mail.Config{
+				TLS:      &status.TLSConfig{InsecureSkipVerify: true},
+				Username: "user",
+				Password: "s3cr3t",
+			},
+			up:  true,
+			tls: true,
+		},
+		{
+			name:     "a POP3 server with USER and PASS, should create a span without an error status",
+			newMail:  mail.NewPOP3,
+			listener: listen,
+			session:  pop3Session,
+			config:   mail.Config{Username: "user", Password: "s3cr3t", AllowPlaintextAuth: true},
+			up:       true,
+		},
+		{
+			name:     "a POP3 server refusing the password, should create a span with an error status",
+			newMail:  mail.NewPOP3,
+			listener: listen,
+			session:  pop3Session,
+			config:   mail.Config{Username: "user", Password: "wrong-pa55", AllowPlaintextAuth: true},
+			message:  "authenticating: unexpected response to PASS: -ERR [AUTH] invalid password",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			exp := tracetest.NewInMemoryExporter()
+			tp := sdktrace.NewTracerProvider(
+				sdktrace.WithSyncer(exp),
+			)
+			mockTracer := tp.Tracer("test-tracer")
+
+			rdr := metric.NewManualReader()
+			mp := metric.NewMeterProvider(metric.WithReader(rdr))
+			mockMeter := mp.Meter("test-meter")
+
+			c := tt.config
+			c.Config = status.Config{Name: "Test", Description: "Test mail", Cron: "@99m"}
+			c.Address = serve(t, tt.listener(t), tt.session)
+			stater, err := tt.newMail(c)
+			require.NoError(t, err)
+			defer stater.Close()
+
+			ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+			defer cancel()
+			res, err := stater.State(ctx, mockTracer, mockMeter)
+			require.NoError(t, err)
+			assert.Equal(t, status.Result{Up: tt.up, Message: tt.message}, res)
+
+			spans := exp.GetSpans()
+			require.Len(t, spans, 1)
+			wantCode := codes.Unset
+			if !tt.up {
+				wantCode = codes.Error
+			}
+			assert.Equal(t, wantCode, spans[0].Status.Code)
+			assert.Contains(t, spans[0].Attributes, attribute.String(status.OtelStatusPluginName, stater.Plugin()))
+			var hasTLS bool
+			for _, a := range spans[0].Attributes {
+				hasTLS = hasTLS || a.Key == status.TLSVersion
+			}
+			assert.Equal(t, tt.tls, hasTLS)
+
+			m, err := rdr.Collect(context.Background())
+			require.NoError(t, err)
+			var metrics []string
+			for _, sm := range m.ScopeMetrics {
+				for _, mm := range sm.Metrics {
+					metrics = append(metrics, mm.Name)
+				}
+			}
+			var want []string
+			if tt.up {
+				want = append(want, "otelstatus.mail.banner.duration", "otelstatus.mail.duration")
+			}
+			if tt.tls {
+				want = append(want, "otelstatus.mail.tls.expiry")
+			}
+			assert.ElementsMatch(t, want, metrics)
+		})
+	}
+
+	t.Run("an unexpected greeting, should create a span with an error status", func(t *testing.T) {
+		address := serve(t, listen(t), func(c *textproto.Conn, _ net.Conn) {
+			_ = c.PrintfLine("554 no service")
+		})
+		exp := tracetest.NewInMemoryExporter()
+		tp := sdktrace.NewTracerProvider(
+			sdktrace.WithSyncer(exp),
+		)
+		stater, err := mail.NewSMTP(mail.Config{
+			Config:  status.Config{Name: "Test", Description: "Test greeting", Cron: "@99m"},
+			Address: address,
+		})
+		require.NoError(t, err)
+
+		res, err := stater.State(context.Background(), tp.Tracer("test-tracer"), metric.NewMeterProvider().Meter("test-meter"))
+		require.NoError(t, err)
+		assert.Equal(t, status.Result{Message: "reading greeting: unexpected response to greeting: 554 no service"}, res)
+	})
+
+	for _, startTLS := range []bool{false, true} {
+		t.Run(fmt.Sprintf("an expired certificate with STARTTLS %t, should create a span with an error status and record its expiry", startTLS), func(t *testing.T) {
+			cert := expiredCertificate(t)
+			l := listen(t)
+			if !startTLS {
+				l = tls.NewListener(l, &tls.Config{Certificates: []tls.Certificate{cert}})
+			}
+			address := serve(t, l, smtpSession(cert, smtpCredentials))
+			exp := tracetest.NewInMemoryExporter()
+			tp := sdktrace.NewTracerProvider(
+				sdktrace.WithSyncer(exp),
+			)
+			rdr := metric.NewManualReader()
+			mp := metric.NewMeterProvider(metric.WithReader(rdr))
+			stater, err := mail.NewSMTP(mail.Config{
+				Config:   status.Config{Name: "Test", Description: "Test expired certificate", Cron: "@99m"},
+				Address:  address,
+				TLS:      &status.TLSConfig{},
+				StartTLS: startTLS,
+			})
+			require.NoError(t, err)
+
+			_, err = stater.State(context.Background(), tp.Tracer("test-tracer"), mp.Meter("test-meter"))
+			require.Error(t, err)
+
+			spans := exp.GetSpans()
+			require.Len(t, spans, 1)
+			assert.Equal(t, codes.Error, spans[0].Status.Code)
+
+			m, err := rdr.Collect(context.Background())
+			require.NoError(t, err)
+			require.Len(t, m.ScopeMetrics, 1)
+			var days []int64
+			for _, mm := range m.ScopeMetrics[0].Metrics {
+				if mm.Name == "otelstatus.mail.tls.expiry" {
+					for _, dp := range mm.Data.(metricdata.Gauge[int64]).DataPoints {
+						days = append(days, dp.Value)
+					}
+				}
+			}
+			assert.Equal(t, []int64{-1}, days)
+		})
+	}
+}
+
+func TestMail_New(t *testing.T) {
+	t.Run("an address without port, should return an error", func(t *testing.T) {
+		_, err := mail.NewIMAP(mail.Config{Address: "localhost"})
+		var configErr *status.ConfigError
+		require.ErrorAs(t, err, &configErr)
+		assert.Equal(t, "address", configErr.Field)
+	})
+
+	t.Run("a password without username, should return an error", func(t *testing.T) {
+		_, err := mail.NewPOP3(mail.Config{Address: "localhost:110", Password: "pa55"})
+		var configErr *status.ConfigError
+		require.ErrorAs(t, err, &configErr)
+		assert.Equal(t, "username", configErr.Field)
+	})
+
+	t.Run("credentials without TLS, should return an error", func(t *testing.T) {
+		_, err := mail.NewSMTP(mail.Config{Address: "localhost:25", Username: "user", Password: "pa55"})
+		var configErr *status.ConfigError
+		require.ErrorAs(t, err, &configErr)
+		assert.Equal(t, "username", configErr.Field)
+	})
+
+	t.Run("credentials with STARTTLS or allowed in clear, should not return an error", func(t *testing.T) {
+		_, err := mail.NewSMTP(mail.Config{Address: "localhost:587", Username: "user", Password: "pa55", StartTLS: true})
+		require.NoError(t, err)
+		_, err = mail.NewPOP3(mail.Config{Address: "localhost:110", Username: "user", Password: "pa55", AllowPlaintextAuth: true})
+		require.NoError(t, err)
+	})
+}
@@ -0,0 +1,183 @@
+/*******************************************************************************
+ * Copyright (c) 2023 Cedric L'homme.
+ *
+ * This file is part of otel-status.
+ *
+ * otel-status is free software: you can redistribute it and/or modify it
+ * under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License,
+ * or (at your option) any later version.
+ *
+ *  otel-status is distributed in the hope that it will be useful, but
+ *  WITHOUT ANY WARRANTY; without even the implied warranty of
+ *  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.
+ *  See the GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with otel-status. If not, see <https://www.gnu.org/licenses/>.
+ ******************************************************************************/
+
+package mail
+
+import (
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net/textproto"
+	"strings"
+)
+
+// smtp is the dialect of SMTP, see RFC 5321.
+type smtp struct{}
+
+func (smtp) greeting(c *textproto.Conn) (string, error) {
+	code, message, err := readSMTP(c, "greeting", 220)
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("%d %s", code, message), nil
+}
+
+func (smtp) hello(c *textproto.Conn, hostname string) error {
+	return cmdSMTP(c, "EHLO", 250, "EHLO %s", hostname)
+}
+
+func (smtp) startTLS(c *textproto.Conn) error {
+	return cmdSMTP(c, "STARTTLS", 220, "STARTTLS")
+}
+
+// login authenticates with the PLAIN mechanism, see RFC 4616.
+func (smtp) login(c *textproto.Conn, username, password string) error {
+	credentials := base64.StdEncoding.EncodeToString([]byte("\x00" + username + "\x00" + password))
+	return cmdSMTP(c, "AUTH", 235, "AUTH PLAIN %s", credentials)
+}
+
+func (smtp) quit(c *textproto.Conn) error {
+	return cmdSMTP(c, "QUIT", 221, "QUIT")
+}
+
+// cmdSMTP sends the command and reads its response, which must have the expected code.
+func cmdSMTP(c *textproto.Conn, name string, expectCode int, format string, args ...interface{}) error {
+	if _, err := c.Cmd(format, args...); err != nil {
+		return err
+	}
+	_, _, err := readSMTP(c, name, expectCode)
+	return err
+}
+
+// readSMTP reads a response, which can be on several lines, with the expected code.
+func readSMTP(c *textproto.Conn, name string, expectCode int) (int, string, error) {
+	code, message, err := c.ReadResponse(expectCode)
+	var protoErr *textproto.Error
+	if errors.As(err, &protoErr) {
+		return code, message, &ResponseError{Command: name, Response: fmt.Sprintf("%d %s", protoErr.Code, protoErr.Msg)}
+	}
+	return code, message, err
+}
+
+// imap is the dialect of IMAP4rev1, see RFC 3501.
+type imap struct {
+	// tag is the number of the latest tagged command.
+	tag int
+}
+
+func (*imap) greeting(c *textproto.Conn) (string, error) {
+	line, err := c.ReadLine()
+	if err != nil {
+		return "", err
+	}
+	if !strings.HasPrefix(line, "* OK") && !strings.HasPrefix(line, "* PREAUTH") {
+		return line, &ResponseError{Command: "greeting", Response: line}
+	}
+	return line, nil
+}
+
+func (*imap) hello(*textproto.Conn, string) error {
+	return nil
+}
+
+func (i *imap) startTLS(c *textproto.Conn) error {
+	return i.cmd(c, "STARTTLS", "STARTTLS")
+}
+
+func (i *imap) login(c *textproto.Conn, username, password string) error {
+	return i.cmd(c, "LOGIN", "LOGIN %s %s", quoteIMAP(username), quoteIMAP(password))
+}
+
+func (i *imap) quit(c *textproto.Conn) error {
+	return i.cmd(c, "LOGOUT", "LOGOUT")
+}
+
+// cmd sends the tagged command and reads the untagged lines until its tagged response, which must be OK.
+func (i *imap) cmd(c *textproto.Conn, name string, format string, args ...interface{}) error {
+	i.tag++
+	tag := fmt.Sprintf("a%d", i.tag)
+	if err := c.PrintfLine(tag+" "+format, args...); err != nil {
+		return err
+	}
+	for {
+		line, err := c.ReadLine()
+		if err != nil {
+			return err
+		}
+		if !strings.HasPrefix(line, tag+" ") {
+			continue
+		}
+		if !strings.HasPrefix(line, tag+" OK") {
+			return &ResponseError{Command: name, Response: strings.TrimPrefix(line, tag+" ")}
+		}
+		return nil
+	}
+}
+
+// quoteIMAP returns the string as an IMAP quoted string.
+func quoteIMAP(s string) string {
+	return `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(s) + `"`
+}
+
+// pop3 is the dialect of POP3, see RFC 1939 and RFC 2595 for STLS.
+type pop3 struct{}
+
+func (pop3) greeting(c *textproto.Conn) (string, error) {
+	return readPOP3(c, "greeting")
+}
+
+func (pop3) hello(*textproto.Conn, string) error {
+	return nil
+}
+
+func (pop3) startTLS(c *textproto.Conn) error {
+	return cmdPOP3(c, "STLS", "STLS")
+}
+
+func (pop3) login(c *textproto.Conn, username, password string) error {
+	if err := cmdPOP3(c, "USER", "USER %s", username); err != nil {
+		return err
+	}
+	return cmdPOP3(c, "PASS", "PASS %s", password)
+}
+
+func (pop3) quit(c *textproto.Conn) error {
+	return cmdPOP3(c, "QUIT", "QUIT")
+}
+
+// cmdPOP3 sends the command and reads its response, which must be +OK.
+func cmdPOP3(c *textproto.Conn, name string, format string, args ...interface{}) error {
+	if err := c.PrintfLine(format, args...); err != nil {
+		return err
+	}
+	_, err := readPOP3(c, name)
+	return err
+}
+
+// readPOP3 reads a single line response, which must be +OK.
+func readPOP3(c *textproto.Conn, name string) (string, error) {
+	line, err := c.ReadLine()
+	if err != nil {
+		return "", err
+	}
+	if !strings.HasPrefix(line, "+OK") {
+		return line, &ResponseError{Command: name, Response: line}
+	}
+	return line, nil
+}
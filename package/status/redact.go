@@ -0,0 +1,125 @@
+/*******************************************************************************
+ * Copyright (c) 2023 Cedric L'homme.
+ *
+ * This file is part of otel-status.
+ *
+ * otel-status is free software: you can redistribute it and/or modify it
+ * under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License,
+ * or (at your option) any later version.
+ *
+ *  otel-status is distributed in the hope that it will be useful, but
+ *  WITHOUT ANY WARRANTY; without even the implied warranty of
+ *  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.
+ *  See the GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with otel-status. If not, see <https://www.gnu.org/licenses/>.
+ ******************************************************************************/
+
+package status
+
+import (
+	"sort"
+	"strings"
+	"sync"
+)
+
+// Redacted replaces the secrets in the redacted strings.
+const Redacted = "[REDACTED]"
+
+// MinSecretLength is the length under which a secret is not redacted,
+// a shorter value would redact unrelated parts of the strings, e.g. a digit of every number.
+const MinSecretLength = 4
+
+// secrets is the registry of the values to redact.
+var secrets = struct {
+	mu     sync.RWMutex
+	values map[string]bool
+	// replacer replaces the values, longest first.
+	replacer *strings.Replacer
+}{values: map[string]bool{}}
+
+// RegisterSecret adds a value to redact from everything logged or emitted by the staters,
+// e.g. a token read from a secret file of the configuration.
+// A value shorter than MinSecretLength is ignored.
+func RegisterSecret(value string) {
+	if len(value) < MinSecretLength {
+		return
+	}
+	secrets.mu.Lock()
+	defer secrets.mu.Unlock()
+	if secrets.values[value] {
+		return
+	}
+	secrets.values[value] = true
+	updateReplacer()
+}
+
+// SetSecrets replaces the registered secrets by the values, e.g. by the secrets of a reloaded configuration.
+// The values shorter than MinSecretLength are ignored.
+func SetSecrets(values []string) {
+	secrets.mu.Lock()
+	defer secrets.mu.Unlock()
+	secrets.values = map[string]bool{}
+	for _, v := range values {
+		if len(v) >= MinSecretLength {
+			secrets.values[v] = true
+		}
+	}
+	updateReplacer()
+}
+
+// updateReplacer rebuilds the replacer of the registered secrets, secrets.mu must be locked.
+func updateReplacer() {
+	if len(secrets.values) == 0 {
+		secrets.replacer = nil
+		return
+	}
+	values := make([]string, 0, len(secrets.values))
+	for v := range secrets.values {
+		values = append(values, v)
+	}
+	// A secret containing another one must be replaced first.
+	sort.Slice(values, func(i, j int) bool { return len(values[i]) > len(values[j]) })
+	pairs := make([]string, 0, 2*len(values))
+	for _, v := range values {
+		pairs = append(pairs, v, Redacted)
+	}
+	secrets.replacer = strings.NewReplacer(pairs...)
+}
+
+// Redact returns s with the registered secrets replaced by Redacted.
+func Redact(s string) string {
+	secrets.mu.RLock()
+	replacer := secrets.replacer
+	secrets.mu.RUnlock()
+	if replacer == nil {
+		return s
+	}
+	return replacer.Replace(s)
+}
+
+// RedactError returns err with the registered secrets redacted from its message.
+// The returned error wraps err, errors.Is and errors.As are unchanged.
+func RedactError(err error) error {
+	if err == nil {
+		return nil
+	}
+	return &redactedError{err: err}
+}
+
+// redactedError is an error with a redacted message.
+type redactedError struct {
+	err error
+}
+
+// Error implements the error interface with the redacted message.
+func (e *redactedError) Error() string {
+	return Redact(e.err.Error())
+}
+
+// Unwrap returns the original error.
+func (e *redactedError) Unwrap() error {
+	return e.err
+}
@@ -0,0 +1,61 @@
+/*******************************************************************************
+ * Copyright (c) 2023 Cedric L'homme.
+ *
+ * This file is part of otel-status.
+ *
+ * otel-status is free software: you can redistribute it and/or modify it
+ * under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License,
+ * or (at your option) any later version.
+ *
+ *  otel-status is distributed in the hope that it will be useful, but
+ *  WITHOUT ANY WARRANTY; without even the implied warranty of
+ *  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.
+ *  See the GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with otel-status. If not, see <https://www.gnu.org/licenses/>.
+ ******************************************************************************/
+
+package status_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/rangzen/otel-status/package/status"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRedact(t *testing.T) {
+	status.RegisterSecret("p4ss")
+	status.RegisterSecret("p4ssw0rd")
+
+	assert.Equal(t, "user:[REDACTED]@host", status.Redact("user:p4ssw0rd@host"))
+	assert.Equal(t, "no secret", status.Redact("no secret"))
+
+	err := status.RedactError(fmt.Errorf("connecting to p4ss: %w", context.DeadlineExceeded))
+	assert.Equal(t, "connecting to [REDACTED]: context deadline exceeded", err.Error())
+	assert.True(t, errors.Is(err, context.DeadlineExceeded))
+	assert.Nil(t, status.RedactError(nil))
+}
+
+func TestRegisterSecret(t *testing.T) {
+	t.Run("a short value, should not be redacted", func(t *testing.T) {
+		status.RegisterSecret("abc")
+		assert.Equal(t, "abcd", status.Redact("abcd"))
+	})
+}
+
+func TestSetSecrets(t *testing.T) {
+	t.Run("new secrets, should replace the registered ones", func(t *testing.T) {
+		status.RegisterSecret("0ld-s3cr3t")
+		status.SetSecrets([]string{"n3w-s3cr3t", "xyz"})
+
+		assert.Equal(t, "0ld-s3cr3t", status.Redact("0ld-s3cr3t"))
+		assert.Equal(t, status.Redacted, status.Redact("n3w-s3cr3t"))
+		assert.Equal(t, "xyz", status.Redact("xyz"))
+	})
+}
@@ -0,0 +1,459 @@
+/*******************************************************************************
+ * Copyright (c) 2023 Cedric L'homme.
+ *
+ * This file is part of otel-status.
+ *
+ * otel-status is free software: you can redistribute it and/or modify it
+ * under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License,
+ * or (at your option) any later version.
+ *
+ *  otel-status is distributed in the hope that it will be useful, but
+ *  WITHOUT ANY WARRANTY; without even the implied warranty of
+ *  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.
+ *  See the GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with otel-status. If not, see <https://www.gnu.org/licenses/>.
+ ******************************************************************************/
+
+// Package redis is the package to get status of Redis servers through RESP over TCP.
+package redis
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/rangzen/otel-status/package/status"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/metric"
+	"go.opentelemetry.io/otel/metric/instrument"
+	"go.opentelemetry.io/otel/metric/unit"
+	"go.opentelemetry.io/otel/semconv/v1.17.0"
+	"go.opentelemetry.io/otel/trace"
+	"golang.org/x/exp/slog"
+)
+
+// PluginName is the name of the plugin.
+const PluginName = "redis"
+
+const (
+	otelStatusRedisName              = "otelstatus.redis.name"
+	otelStatusRedisAddress           = "otelstatus.redis.address"
+	otelStatusRedisDuration          = "otelstatus.redis.duration"
+	otelStatusRedisError             = "otelstatus.redis.error"
+	otelStatusRedisConnectedReplicas = "otelstatus.redis.connected_replicas"
+	otelStatusRedisUsedMemory        = "otelstatus.redis.memory.used"
+	otelStatusRedisAssertionFailure  = "otelstatus.redis.assertion.failure"
+	// redisRole is the key for the replication role of the server, master or slave.
+	redisRole = "redis.role"
+	// redisKey is the key for the key of an assertion.
+	redisKey = "redis.key"
+)
+
+// Config is the configuration for a Redis status.
+type Config struct {
+	status.Config `yaml:",inline"`
+	// Address is the host:port of the server.
+	Address string `yaml:"address"`
+	// Username is the ACL user of the AUTH command, the default user if empty.
+	Username string `yaml:"username"`
+	// Password is the password of the AUTH command, no AUTH if empty.
+	Password string `yaml:"password" secret:"true"`
+	// DB is the database selected for the key assertions.
+	DB int `yaml:"db"`
+	// TLS enables TLS on the connection if set.
+	TLS *status.TLSConfig `yaml:"tls"`
+	// Info reads INFO replication and INFO memory.
+	Info bool `yaml:"info"`
+	// Keys is the assertions on keys.
+	Keys []KeyAssertion `yaml:"keys"`
+	// Values is a map of key/value to add to the spans.
+	Values map[string]string `yaml:"values"`
+}
+
+// KeyAssertion is an assertion on a key.
+type KeyAssertion struct {
+	Key string `yaml:"key"`
+	// Value is the expected value of a string key, the key must only exist if nil.
+	Value *string `yaml:"value"`
+}
+
+// Redis is the main structure to use Redis status.
+type Redis struct {
+	SC       status.Config
+	Address  string
+	Username string
+	Password string
+	DB       int
+	TLS      *status.TLSConfig
+	Info     bool
+	Keys     []KeyAssertion
+	Values   map[string]string
+	// connectedReplicas reports the number of replicas of the latest INFO replication.
+	connectedReplicas status.Gauge[int64]
+	// usedMemory reports the used memory of the latest INFO memory.
+	usedMemory  status.Gauge[int64]
+	instruments status.Instruments[instruments]
+}
+
+// instruments are the synchronous instruments of the Redis status.
+type instruments struct {
+	duration         instrument.Int64Histogram
+	assertionFailure instrument.Int64Counter
+	error            instrument.Int64Counter
+}
+
+// newInstruments creates the synchronous instruments of the Redis status on the meter.
+func newInstruments(meter metric.Meter) (instruments, error) {
+	var i instruments
+	var err error
+	i.duration, err = meter.Int64Histogram(
+		otelStatusRedisDuration,
+		instrument.WithUnit(unit.Milliseconds),
+		instrument.WithDescription("Duration of the Redis check"),
+	)
+	if err != nil {
+		return i, fmt.Errorf("creating Redis duration metric: %w", err)
+	}
+	i.assertionFailure, err = meter.Int64Counter(
+		otelStatusRedisAssertionFailure,
+		instrument.WithUnit(unit.Dimensionless),
+		instrument.WithDescription("Failed assertions on the Redis keys"),
+	)
+	if err != nil {
+		return i, fmt.Errorf("creating Redis assertion failure metric: %w", err)
+	}
+	i.error, err = meter.Int64Counter(
+		otelStatusRedisError,
+		instrument.WithUnit(unit.Dimensionless),
+		instrument.WithDescription("Error of the Redis check"),
+	)
+	if err != nil {
+		return i, fmt.Errorf("creating Redis error metric: %w", err)
+	}
+	return i, nil
+}
+
+// New returns the Redis status of the configuration.
+// The password is registered as a secret.
+func New(c Config) (*Redis, error) {
+	if _, _, err := net.SplitHostPort(c.Address); err != nil {
+		return nil, &status.ConfigError{Field: "address", Err: err}
+	}
+	if c.DB < 0 {
+		return nil, &status.ConfigError{Field: "db", Err: fmt.Errorf("database %d must not be negative", c.DB)}
+	}
+	for _, k := range c.Keys {
+		if k.Key == "" {
+			return nil, &status.ConfigError{Field: "keys", Err: fmt.Errorf("empty key")}
+		}
+	}
+	status.RegisterSecret(c.Password)
+	return &Redis{
+		SC:       c.Config,
+		Address:  c.Address,
+		Username: c.Username,
+		Password: c.Password,
+		DB:       c.DB,
+		TLS:      c.TLS,
+		Info:     c.Info,
+		Keys:     c.Keys,
+		Values:   c.Values,
+	}, nil
+}
+
+// Config returns the status.Config of the Redis status.
+func (r *Redis) Config() status.Config {
+	return r.SC
+}
+
+// Close stops reporting the gauges of the Redis status.
+func (r *Redis) Close() error {
+	var err error
+	for _, g := range []*status.Gauge[int64]{&r.connectedReplicas, &r.usedMemory} {
+		if gaugeErr := g.Unregister(); gaugeErr != nil && err == nil {
+			err = gaugeErr
+		}
+	}
+	return err
+}
+
+// Plugin returns the name of the Redis plugin.
+func (r *Redis) Plugin() string {
+	return PluginName
+}
+
+// State do the traces about the Redis status.
+// It sends AUTH if configured, SELECT, PING, INFO if configured, and checks the keys.
+func (r *Redis) State(ctx context.Context, tracer trace.Tracer, meter metric.Meter) (status.Result, error) {
+	start := time.Now()
+	metricCtx := status.WithoutCancel(ctx)
+
+	span := r.newSpan(ctx, tracer)
+	defer span.End()
+
+	c, err := r.dial(ctx)
+	if err != nil {
+		return status.Result{}, r.errorHandling(metricCtx, span, meter, err, "connecting")
+	}
+	defer c.Close()
+	if deadline, ok := ctx.Deadline(); ok {
+		if err = c.SetDeadline(deadline); err != nil {
+			return status.Result{}, r.errorHandling(metricCtx, span, meter, err, "setting deadline")
+		}
+	}
+
+	if r.Password != "" {
+		args := []string{"AUTH", r.Password}
+		if r.Username != "" {
+			args = []string{"AUTH", r.Username, r.Password}
+		}
+		if err = expectReply(c, "OK", args...); err != nil {
+			return status.Result{}, r.errorHandling(metricCtx, span, meter, err, "authenticating")
+		}
+	}
+	if r.DB != 0 {
+		if err = expectReply(c, "OK", "SELECT", strconv.Itoa(r.DB)); err != nil {
+			return status.Result{}, r.errorHandling(metricCtx, span, meter, err, "selecting database")
+		}
+	}
+	if err = expectReply(c, "PONG", "PING"); err != nil {
+		return status.Result{}, r.errorHandling(metricCtx, span, meter, err, "pinging")
+	}
+
+	if r.Info {
+		info, err := readInfo(c)
+		if err != nil {
+			return status.Result{}, r.errorHandling(metricCtx, span, meter, err, "reading INFO")
+		}
+		if err = r.recordInfo(span, meter, info); err != nil {
+			return status.Result{}, r.errorHandling(metricCtx, span, meter, err, "creating Redis INFO metrics")
+		}
+	}
+
+	failures, err := r.checkKeys(c)
+	if err != nil {
+		return status.Result{}, r.errorHandling(metricCtx, span, meter, err, "checking keys")
+	}
+
+	elapsedTime := time.Since(start).Milliseconds()
+	span.SetAttributes(attribute.Int64("duration", elapsedTime))
+	slog.Info("status",
+		slog.String("plugin", PluginName),
+		slog.String("address", r.Address),
+		slog.Int64("duration", elapsedTime),
+	)
+
+	inst, err := r.instruments.Get(meter, newInstruments)
+	if err != nil {
+		return status.Result{}, r.errorHandling(metricCtx, span, meter, err, "creating Redis metrics")
+	}
+	inst.duration.Record(metricCtx, elapsedTime, r.metricAttributes()...)
+
+	message := r.recordAssertions(metricCtx, span, inst, failures)
+	return status.Result{Up: message == "", Message: message}, nil
+}
+
+// dial opens the connection, with TLS if configured.
+func (r *Redis) dial(ctx context.Context) (*conn, error) {
+	dialer := &net.Dialer{}
+	c, err := dialer.DialContext(ctx, "tcp", r.Address)
+	if err != nil {
+		return nil, err
+	}
+	if r.TLS == nil {
+		return newConn(c), nil
+	}
+
+	tlsConfig, err := r.TLS.ClientConfig()
+	if err != nil {
+		c.Close()
+		return nil, err
+	}
+	if tlsConfig.ServerName == "" {
+		tlsConfig.ServerName, _, _ = net.SplitHostPort(r.Address)
+	}
+	tlsConn := tls.Client(c, tlsConfig)
+	if err = tlsConn.HandshakeContext(ctx); err != nil {
+		c.Close()
+		return nil, fmt.Errorf("TLS handshake: %w", err)
+	}
+	return newConn(tlsConn), nil
+}
+
+// expectReply sends the command and checks that its reply is the expected string.
+func expectReply(c *conn, expected string, args ...string) error {
+	reply, err := c.doString(args...)
+	if err != nil {
+		return err
+	}
+	if reply != expected {
+		return fmt.Errorf("unexpected reply %q to %s", reply, args[0])
+	}
+	return nil
+}
+
+// readInfo returns the fields of INFO replication and INFO memory.
+func readInfo(c *conn) (map[string]string, error) {
+	fields := map[string]string{}
+	for _, section := range []string{"replication", "memory"} {
+		info, err := c.doString("INFO", section)
+		if err != nil {
+			return nil, err
+		}
+		for k, v := range parseInfo(info) {
+			fields[k] = v
+		}
+	}
+	return fields, nil
+}
+
+// keyFailure is a failed assertion on a key.
+type keyFailure struct {
+	key     string
+	message string
+}
+
+// checkKeys returns the failed assertions on the keys.
+func (r *Redis) checkKeys(c *conn) ([]keyFailure, error) {
+	var failures []keyFailure
+	for _, k := range r.Keys {
+		if k.Value == nil {
+			reply, err := c.do("EXISTS", k.Key)
+			if err != nil {
+				return nil, err
+			}
+			if n, ok := reply.(int64); !ok || n == 0 {
+				failures = append(failures, keyFailure{k.Key, fmt.Sprintf("key %q does not exist", k.Key)})
+			}
+			continue
+		}
+		reply, err := c.do("GET", k.Key)
+		if err != nil {
+			return nil, err
+		}
+		value, ok := reply.(string)
+		switch {
+		case !ok:
+			failures = append(failures, keyFailure{k.Key, fmt.Sprintf("key %q does not exist", k.Key)})
+		case value != *k.Value:
+			failures = append(failures, keyFailure{k.Key, fmt.Sprintf("key %q is %q, not %q", k.Key, value, *k.Value)})
+		}
+	}
+	return failures, nil
+}
+
+// recordInfo adds the role, the connected replicas and the used memory to the span, and records them in gauges.
+func (r *Redis) recordInfo(span trace.Span, meter metric.Meter, info map[string]string) error {
+	role := info["role"]
+	span.SetAttributes(attribute.String(redisRole, role))
+	attributes := append(r.metricAttributes(), attribute.String(redisRole, role))
+
+	// connected_slaves is the name of the field in all the versions of Redis.
+	if replicas, err := strconv.ParseInt(info["connected_slaves"], 10, 64); err == nil {
+		span.SetAttributes(attribute.Int64("redis.connected_replicas", replicas))
+		err = r.connectedReplicas.Set(meter, otelStatusRedisConnectedReplicas,
+			[]instrument.Option{
+				instrument.WithUnit(unit.Dimensionless),
+				instrument.WithDescription("Connected replicas of the Redis server"),
+			},
+			status.GaugePoint[int64]{Value: replicas, Attributes: attributes},
+		)
+		if err != nil {
+			return err
+		}
+	}
+	if memory, err := strconv.ParseInt(info["used_memory"], 10, 64); err == nil {
+		span.SetAttributes(attribute.Int64("redis.memory.used", memory))
+		err = r.usedMemory.Set(meter, otelStatusRedisUsedMemory,
+			[]instrument.Option{
+				instrument.WithUnit(unit.Bytes),
+				instrument.WithDescription("Memory used by the Redis server"),
+			},
+			status.GaugePoint[int64]{Value: memory, Attributes: attributes},
+		)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// recordAssertions completes the span with the failed assertions and records them in a metric.
+// It returns the status message of the failures, empty if there is none.
+func (r *Redis) recordAssertions(ctx context.Context, span trace.Span, inst instruments, failures []keyFailure) string {
+	if len(failures) == 0 {
+		return ""
+	}
+
+	messages := make([]string, 0, len(failures))
+	for _, f := range failures {
+		messages = append(messages, f.message)
+		span.AddEvent("assertion failed", trace.WithAttributes(
+			attribute.String(redisKey, f.key),
+			attribute.String("message", f.message),
+		))
+		inst.assertionFailure.Add(ctx, 1, append(r.metricAttributes(), attribute.String(redisKey, f.key))...)
+	}
+	message := strings.Join(messages, "; ")
+	span.SetStatus(codes.Error, message)
+
+	slog.Warn("assertions failed",
+		slog.String("plugin", PluginName),
+		slog.String("address", r.Address),
+		slog.String("failures", message),
+	)
+	return message
+}
+
+// newSpan creates a new span for the Redis check data.
+func (r *Redis) newSpan(ctx context.Context, tracer trace.Tracer) trace.Span {
+	host, port, _ := net.SplitHostPort(r.Address)
+	_, span := tracer.Start(ctx, fmt.Sprintf("Redis %s", r.Address),
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(
+			attribute.String(status.OtelStatusPluginName, PluginName),
+			semconv.DBSystemRedis,
+			semconv.DBRedisDBIndexKey.Int(r.DB),
+			semconv.NetPeerNameKey.String(host),
+			semconv.NetPeerPortKey.String(port),
+		),
+		trace.WithAttributes(r.configAttributes()...),
+	)
+	return span
+}
+
+// configAttributes returns the attributes from the config.
+func (r *Redis) configAttributes() []attribute.KeyValue {
+	var valuesAttributes []attribute.KeyValue
+	for k, v := range r.Values {
+		valuesAttributes = append(valuesAttributes, attribute.String(k, status.Redact(v)))
+	}
+	return valuesAttributes
+}
+
+// metricAttributes returns the attributes of the metrics.
+func (r *Redis) metricAttributes() []attribute.KeyValue {
+	return []attribute.KeyValue{
+		attribute.String(otelStatusRedisName, r.SC.Name),
+		attribute.String(otelStatusRedisAddress, r.Address),
+	}
+}
+
+// errorHandling is a helper function to handle errors.
+// It logs the error, records it in the span and in the error metric, and returns it.
+func (r *Redis) errorHandling(ctx context.Context, span trace.Span, meter metric.Meter, err error, msg string) error {
+	e := status.RedactError(fmt.Errorf("%s: %w", msg, err))
+	attributes := status.RecordError(ctx, span, PluginName, msg, e, status.ErrorClass(e))
+	if inst, err := r.instruments.Get(meter, newInstruments); err == nil {
+		inst.error.Add(ctx, 1, append(r.metricAttributes(), attributes...)...)
+	}
+	return e
+}
@@ -0,0 +1,313 @@
+/*******************************************************************************
+ * Copyright (c) 2023 Cedric L'homme.
+ *
+ * This file is part of otel-status.
+ *
+ * otel-status is free software: you can redistribute it and/or modify it
+ * under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License,
+ * or (at your option) any later version.
+ *
+ *  otel-status is distributed in the hope that it will be useful, but
+ *  WITHOUT ANY WARRANTY; without even the implied warranty of
+ *  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.
+ *  See the GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with otel-status. If not, see <https://www.gnu.org/licenses/>.
+ ******************************************************************************/
+
+package redis_test
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/rangzen/otel-status/package/status"
+	"github.com/rangzen/otel-status/package/status/redis"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/sdk/metric"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+// fakeServer is an in-process Redis server answering AUTH, SELECT, PING, INFO, EXISTS and GET.
+type fakeServer struct {
+	listener net.Listener
+	password string
+	keys     map[string]string
+}
+
+// newFakeServer starts a fake server with the password, if not empty, and the keys.
+func newFakeServer(t *testing.T, password string, keys map[string]string) *fakeServer {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	s := &fakeServer{listener: l, password: password, keys: keys}
+	t.Cleanup(func() { l.Close() })
+	go func() {
+		for {
+			c, err := l.Accept()
+			if err != nil {
+				return
+			}
+			go s.serve(c)
+		}
+	}()
+	return s
+}
+
+func (s *fakeServer) address() string {
+	return s.listener.Addr().String()
+}
+
+func (s *fakeServer) serve(c net.Conn) {
+	defer c.Close()
+	r := bufio.NewReader(c)
+	authenticated := s.password == ""
+	for {
+		args, err := readCommand(r)
+		if err != nil {
+			return
+		}
+		command := strings.ToUpper(args[0])
+		if !authenticated && command != "AUTH" {
+			fmt.Fprint(c, "-NOAUTH Authentication required.\r\n")
+			continue
+		}
+		switch command {
+		case "AUTH":
+			if args[len(args)-1] != s.password {
+				fmt.Fprint(c, "-WRONGPASS invalid username-password pair or user is disabled.\r\n")
+				continue
+			}
+			authenticated = true
+			fmt.Fprint(c, "+OK\r\n")
+		case "SELECT":
+			fmt.Fprint(c, "+OK\r\n")
+		case "PING":
+			fmt.Fprint(c, "+PONG\r\n")
+		case "INFO":
+			info := "# Replication\r\nrole:master\r\nconnected_slaves:2\r\n"
+			if args[1] == "memory" {
+				info = "# Memory\r\nused_memory:1048576\r\nused_memory_human:1.00M\r\n"
+			}
+			fmt.Fprintf(c, "$%d\r\n%s\r\n", len(info), info)
+		case "EXISTS":
+			if _, ok := s.keys[args[1]]; ok {
+				fmt.Fprint(c, ":1\r\n")
+			} else {
+				fmt.Fprint(c, ":0\r\n")
+			}
+		case "GET":
+			if v, ok := s.keys[args[1]]; ok {
+				fmt.Fprintf(c, "$%d\r\n%s\r\n", len(v), v)
+			} else {
+				fmt.Fprint(c, "$-1\r\n")
+			}
+		default:
+			fmt.Fprintf(c, "-ERR unknown command '%s'\r\n", args[0])
+		}
+	}
+}
+
+// readCommand reads a command sent as an array of bulk strings.
+func readCommand(r *bufio.Reader) ([]string, error) {
+	line, err := r.ReadString('\n')
+	if err != nil {
+		return nil, err
+	}
+	n, err := strconv.Atoi(strings.TrimSpace(strings.TrimPrefix(line, "*")))
+	if err != nil || n < 1 {
+		return nil, fmt.Errorf("invalid command %q", line)
+	}
+	args := make([]string, n)
+	for i := range args {
+		if _, err = r.ReadString('\n'); err != nil {
+			return nil, err
+		}
+		arg, err := r.ReadString('\n')
+		if err != nil {
+			return nil, err
+		}
+		args[i] = strings.TrimSuffix(arg, "\r\n")
+	}
+	return args, nil
+}
+
+func TestRedis_State(t *testing.T) {
+	leader := "leader"
+	other := "other"
+	tests := []struct {
+		name    string
+		keys    []redis.KeyAssertion
+		up      bool
+		message string
+	}{
+		{
+			name: "existing keys with the expected values, should create a span without an error status",
+			keys: []redis.KeyAssertion{{Key: "lock"}, {Key: "role", Value: &leader}},
+			up:   true,
+		},
+		{
+			name:    "a missing key, should create a span with an error status",
+			keys:    []redis.KeyAssertion{{Key: "missing"}},
+			message: `key "missing" does not exist`,
+		},
+		{
+			name:    "an unexpected value, should create a span with an error status",
+			keys:    []redis.KeyAssertion{{Key: "role", Value: &other}},
+			message: `key "role" is "leader", not "other"`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := newFakeServer(t, "s3cr3t", map[string]string{"lock": "1", "role": "leader"})
+
+			exp := tracetest.NewInMemoryExporter()
+			tp := sdktrace.NewTracerProvider(
+				sdktrace.WithSyncer(exp),
+			)
+			mockTracer := tp.Tracer("test-tracer")
+
+			rdr := metric.NewManualReader()
+			mp := metric.NewMeterProvider(metric.WithReader(rdr))
+			mockMeter := mp.Meter("test-meter")
+
+			stater, err := redis.New(redis.Config{
+				Config: status.Config{
+					Name:        "Test",
+					Description: "Test Redis",
+					Cron:        "@99m",
+				},
+				Address:  server.address(),
+				Password: "s3cr3t",
+				DB:       1,
+				Info:     true,
+				Keys:     tt.keys,
+			})
+			require.NoError(t, err)
+			defer stater.Close()
+
+			res, err := stater.State(context.Background(), mockTracer, mockMeter)
+			require.NoError(t, err)
+			assert.Equal(t, status.Result{Up: tt.up, Message: tt.message}, res)
+
+			spans := exp.GetSpans()
+			require.Len(t, spans, 1)
+			wantCode := codes.Unset
+			if !tt.up {
+				wantCode = codes.Error
+			}
+			assert.Equal(t, wantCode, spans[0].Status.Code)
+			assert.Contains(t, spans[0].Attributes, attribute.String("redis.role", "master"))
+			assert.Contains(t, spans[0].Attributes, attribute.Int64("redis.connected_replicas", 2))
+			assert.Contains(t, spans[0].Attributes, attribute.Int64("redis.memory.used", 1048576))
+
+			m, err := rdr.Collect(context.Background())
+			require.NoError(t, err)
+			require.Len(t, m.ScopeMetrics, 1)
+			var metrics []string
+			for _, mm := range m.ScopeMetrics[0].Metrics {
+				metrics = append(metrics, mm.Name)
+			}
+			want := []string{
+				"otelstatus.redis.duration",
+				"otelstatus.redis.connected_replicas",
+				"otelstatus.redis.memory.used",
+			}
+			if !tt.up {
+				want = append(want, "otelstatus.redis.assertion.failure")
+			}
+			assert.ElementsMatch(t, want, metrics)
+		})
+	}
+
+	invalidReplies := []struct {
+		name  string
+		reply string
+	}{
+		{name: "an invalid length *9999999999, should return an error", reply: "*9999999999"},
+		{name: "an invalid length *-2, should return an error", reply: "*-2"},
+		{name: "an invalid length $-5, should return an error", reply: "$-5"},
+		{name: "an array nested deeper than 8 arrays, should return an error", reply: strings.Repeat("*1\r\n", 9) + ":1"},
+	}
+	for _, tt := range invalidReplies {
+		t.Run(tt.name, func(t *testing.T) {
+			l, err := net.Listen("tcp", "127.0.0.1:0")
+			require.NoError(t, err)
+			defer l.Close()
+			go func() {
+				c, err := l.Accept()
+				if err != nil {
+					return
+				}
+				defer c.Close()
+				_, _ = readCommand(bufio.NewReader(c))
+				fmt.Fprintf(c, "%s\r\n", tt.reply)
+			}()
+
+			stater, err := redis.New(redis.Config{
+				Config:  status.Config{Name: "Test", Description: "Test invalid reply", Cron: "@99m"},
+				Address: l.Addr().String(),
+			})
+			require.NoError(t, err)
+
+			_, err = stater.State(context.Background(), sdktrace.NewTracerProvider().Tracer("test-tracer"),
+				metric.NewMeterProvider().Meter("test-meter"))
+			require.Error(t, err)
+			assert.Contains(t, err.Error(), "invalid")
+		})
+	}
+
+	t.Run("a wrong password, should create a span with an error status", func(t *testing.T) {
+		server := newFakeServer(t, "s3cr3t", nil)
+
+		exp := tracetest.NewInMemoryExporter()
+		tp := sdktrace.NewTracerProvider(
+			sdktrace.WithSyncer(exp),
+		)
+		mockTracer := tp.Tracer("test-tracer")
+		mp := metric.NewMeterProvider()
+		mockMeter := mp.Meter("test-meter")
+
+		stater, err := redis.New(redis.Config{
+			Config:   status.Config{Name: "Test", Description: "Test wrong password", Cron: "@99m"},
+			Address:  server.address(),
+			Password: "wrong-pa55",
+		})
+		require.NoError(t, err)
+
+		_, err = stater.State(context.Background(), mockTracer, mockMeter)
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), "WRONGPASS")
+		assert.NotContains(t, err.Error(), "wrong-pa55")
+
+		spans := exp.GetSpans()
+		require.Len(t, spans, 1)
+		assert.Equal(t, codes.Error, spans[0].Status.Code)
+	})
+}
+
+func TestRedis_New(t *testing.T) {
+	t.Run("an address without port, should return an error", func(t *testing.T) {
+		_, err := redis.New(redis.Config{Address: "localhost"})
+		var configErr *status.ConfigError
+		require.ErrorAs(t, err, &configErr)
+		assert.Equal(t, "address", configErr.Field)
+	})
+
+	t.Run("an empty key, should return an error", func(t *testing.T) {
+		_, err := redis.New(redis.Config{Address: "localhost:6379", Keys: []redis.KeyAssertion{{}}})
+		var configErr *status.ConfigError
+		require.ErrorAs(t, err, &configErr)
+		assert.Equal(t, "keys", configErr.Field)
+	})
+}
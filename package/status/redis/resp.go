@@ -0,0 +1,169 @@
+/*******************************************************************************
+ * Copyright (c) 2023 Cedric L'homme.
+ *
+ * This file is part of otel-status.
+ *
+ * otel-status is free software: you can redistribute it and/or modify it
+ * under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License,
+ * or (at your option) any later version.
+ *
+ *  otel-status is distributed in the hope that it will be useful, but
+ *  WITHOUT ANY WARRANTY; without even the implied warranty of
+ *  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.
+ *  See the GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with otel-status. If not, see <https://www.gnu.org/licenses/>.
+ ******************************************************************************/
+
+package redis
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+)
+
+// maxBulkSize is the maximum size of a bulk string reply, larger ones are a protocol error.
+const maxBulkSize = 16 << 20
+
+// maxArrayLength is the maximum number of elements of an array reply, larger ones are a protocol error.
+const maxArrayLength = 1 << 16
+
+// maxArrayDepth is the maximum nesting of the arrays of a reply, deeper ones are a protocol error.
+const maxArrayDepth = 8
+
+// ReplyError is an error reply of the server, e.g. WRONGPASS or NOAUTH.
+type ReplyError string
+
+// Error implements the error interface.
+func (e ReplyError) Error() string {
+	return string(e)
+}
+
+// conn is a connection speaking RESP, the Redis serialization protocol.
+type conn struct {
+	net.Conn
+	r *bufio.Reader
+}
+
+// newConn returns a RESP connection over c.
+func newConn(c net.Conn) *conn {
+	return &conn{Conn: c, r: bufio.NewReader(c)}
+}
+
+// do sends the command and returns its reply:
+// a string for simple and bulk strings, an int64 for integers, a []interface{} for arrays
+// and nil for null replies. An error reply is returned as a ReplyError.
+func (c *conn) do(args ...string) (interface{}, error) {
+	var b strings.Builder
+	fmt.Fprintf(&b, "*%d\r\n", len(args))
+	for _, arg := range args {
+		fmt.Fprintf(&b, "$%d\r\n%s\r\n", len(arg), arg)
+	}
+	if _, err := io.WriteString(c.Conn, b.String()); err != nil {
+		return nil, err
+	}
+	return c.readReply()
+}
+
+// doString sends the command and returns its reply, which must be a string.
+func (c *conn) doString(args ...string) (string, error) {
+	reply, err := c.do(args...)
+	if err != nil {
+		return "", err
+	}
+	s, ok := reply.(string)
+	if !ok {
+		return "", fmt.Errorf("unexpected reply %v to %s", reply, args[0])
+	}
+	return s, nil
+}
+
+// readReply reads a reply of the server.
+func (c *conn) readReply() (interface{}, error) {
+	return c.readValue(0)
+}
+
+// readValue reads a value of a reply, nested in depth arrays.
+func (c *conn) readValue(depth int) (interface{}, error) {
+	line, err := c.r.ReadString('\n')
+	if err != nil {
+		return nil, err
+	}
+	line = strings.TrimSuffix(strings.TrimSuffix(line, "\n"), "\r")
+	if line == "" {
+		return nil, errors.New("empty reply")
+	}
+
+	switch line[0] {
+	case '+':
+		return line[1:], nil
+	case '-':
+		return nil, ReplyError(line[1:])
+	case ':':
+		return strconv.ParseInt(line[1:], 10, 64)
+	case '$':
+		n, err := strconv.Atoi(line[1:])
+		if err != nil {
+			return nil, fmt.Errorf("invalid bulk string length %q", line[1:])
+		}
+		if n == -1 {
+			return nil, nil
+		}
+		if n < 0 || n > maxBulkSize {
+			return nil, fmt.Errorf("invalid bulk string length %d", n)
+		}
+		buf := make([]byte, n+2)
+		if _, err = io.ReadFull(c.r, buf); err != nil {
+			return nil, err
+		}
+		return string(buf[:n]), nil
+	case '*':
+		n, err := strconv.Atoi(line[1:])
+		if err != nil {
+			return nil, fmt.Errorf("invalid array length %q", line[1:])
+		}
+		if n == -1 {
+			return nil, nil
+		}
+		if n < 0 || n > maxArrayLength {
+			return nil, fmt.Errorf("invalid array length %d", n)
+		}
+		if depth == maxArrayDepth {
+			return nil, fmt.Errorf("invalid array nested deeper than %d arrays", maxArrayDepth)
+		}
+		values := make([]interface{}, 0, n)
+		for i := 0; i < n; i++ {
+			v, err := c.readValue(depth + 1)
+			var replyErr ReplyError
+			if err != nil && !errors.As(err, &replyErr) {
+				return nil, err
+			}
+			values = append(values, v)
+		}
+		return values, nil
+	default:
+		return nil, fmt.Errorf("unknown reply type %q", line[0])
+	}
+}
+
+// parseInfo returns the fields of an INFO reply, without the sections.
+func parseInfo(info string) map[string]string {
+	fields := map[string]string{}
+	for _, line := range strings.Split(info, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		if key, value, ok := strings.Cut(line, ":"); ok {
+			fields[key] = value
+		}
+	}
+	return fields
+}
@@ -0,0 +1,127 @@
+/*******************************************************************************
+ * Copyright (c) 2023 Cedric L'homme.
+ *
+ * This file is part of otel-status.
+ *
+ * otel-status is free software: you can redistribute it and/or modify it
+ * under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License,
+ * or (at your option) any later version.
+ *
+ *  otel-status is distributed in the hope that it will be useful, but
+ *  WITHOUT ANY WARRANTY; without even the implied warranty of
+ *  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.
+ *  See the GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with otel-status. If not, see <https://www.gnu.org/licenses/>.
+ ******************************************************************************/
+
+package status
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+)
+
+const (
+	// OtelStatusAttempts is the key for the number of attempts of a check run.
+	OtelStatusAttempts = "otelstatus.attempts"
+	// OtelStatusVerdict is the key that tells if an error is the final one of a check run (true),
+	// or the error of an attempt that is retried (false).
+	OtelStatusVerdict = "otelstatus.verdict"
+	// OtelStatusFailure is the name of the counter of the failed attempts of the checks, see Check.
+	OtelStatusFailure = "otelstatus.failure"
+)
+
+const (
+	// BackoffConstant waits RetryInterval between the attempts.
+	BackoffConstant = "constant"
+	// BackoffExponential doubles the wait after each retry, starting from RetryInterval.
+	BackoffExponential = "exponential"
+	// MaxRetryDelay is the maximum wait of the exponential backoff,
+	// unless the RetryInterval itself is longer.
+	MaxRetryDelay = 5 * time.Minute
+)
+
+// Attempt is an attempt of a check run.
+type Attempt struct {
+	// Number is the number of the attempt, starting from 1.
+	Number int
+	// Last is true if the attempt is not retried on failure.
+	Last bool
+}
+
+type attemptKey struct{}
+
+// WithAttempt returns a copy of ctx with the attempt.
+func WithAttempt(ctx context.Context, attempt Attempt) context.Context {
+	return context.WithValue(ctx, attemptKey{}, attempt)
+}
+
+// AttemptFromContext returns the attempt of ctx, the first and last one if ctx has none.
+func AttemptFromContext(ctx context.Context) Attempt {
+	if attempt, ok := ctx.Value(attemptKey{}).(Attempt); ok {
+		return attempt
+	}
+	return Attempt{Number: 1, Last: true}
+}
+
+// VerdictAttribute returns the OtelStatusVerdict attribute of an error of the attempt of ctx.
+func VerdictAttribute(ctx context.Context) attribute.KeyValue {
+	return attribute.Bool(OtelStatusVerdict, AttemptFromContext(ctx).Last)
+}
+
+// RetryDelay returns the wait before the retry, starting from 1.
+// The exponential backoff is capped by MaxRetryDelay.
+func (s Config) RetryDelay(retry int) time.Duration {
+	if s.Backoff != BackoffExponential || retry <= 1 || s.RetryInterval >= MaxRetryDelay {
+		return s.RetryInterval
+	}
+	// The shift would overflow, or exceed the maximum.
+	shift := retry - 1
+	if shift > 62 || s.RetryInterval > MaxRetryDelay>>shift {
+		return MaxRetryDelay
+	}
+	return s.RetryInterval << shift
+}
+
+// EffectiveFailureThreshold returns the number of consecutive failures to report a check down, 1 if not set.
+func (s Config) EffectiveFailureThreshold() int {
+	if s.FailureThreshold <= 0 {
+		return 1
+	}
+	return s.FailureThreshold
+}
+
+// EffectiveSuccessThreshold returns the number of consecutive successes to report a check up again, 1 if not set.
+func (s Config) EffectiveSuccessThreshold() int {
+	if s.SuccessThreshold <= 0 {
+		return 1
+	}
+	return s.SuccessThreshold
+}
+
+// validateRetries returns a *ConfigError if the retries or the thresholds are invalid.
+func (s Config) validateRetries() error {
+	switch {
+	case s.Retries < 0:
+		return &ConfigError{Field: "retries", Err: fmt.Errorf("retries %d must not be negative", s.Retries)}
+	case s.RetryInterval < 0:
+		return &ConfigError{Field: "retry_interval",
+			Err: fmt.Errorf("retry interval %s must not be negative", s.RetryInterval)}
+	case s.Backoff != "" && s.Backoff != BackoffConstant && s.Backoff != BackoffExponential:
+		return &ConfigError{Field: "backoff",
+			Err: fmt.Errorf("unknown backoff %q, must be %s or %s", s.Backoff, BackoffConstant, BackoffExponential)}
+	case s.FailureThreshold < 0:
+		return &ConfigError{Field: "failure_threshold",
+			Err: fmt.Errorf("failure threshold %d must not be negative", s.FailureThreshold)}
+	case s.SuccessThreshold < 0:
+		return &ConfigError{Field: "success_threshold",
+			Err: fmt.Errorf("success threshold %d must not be negative", s.SuccessThreshold)}
+	}
+	return nil
+}
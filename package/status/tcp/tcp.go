@@ -0,0 +1,321 @@
+/*******************************************************************************
+ * Copyright (c) 2023 Cedric L'homme.
+ *
+ * This file is part of otel-status.
+ *
+ * otel-status is free software: you can redistribute it and/or modify it
+ * under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License,
+ * or (at your option) any later version.
+ *
+ *  otel-status is distributed in the hope that it will be useful, but
+ *  WITHOUT ANY WARRANTY; without even the implied warranty of
+ *  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.
+ *  See the GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with otel-status. If not, see <https://www.gnu.org/licenses/>.
+ ******************************************************************************/
+
+// Package tcp is the package to get status through a TCP connection.
+package tcp
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"net"
+	"strings"
+	"time"
+
+	"github.com/rangzen/otel-status/package/status"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+	"go.opentelemetry.io/otel/metric/instrument"
+	"go.opentelemetry.io/otel/metric/unit"
+	"go.opentelemetry.io/otel/semconv/v1.17.0"
+	"go.opentelemetry.io/otel/trace"
+	"golang.org/x/exp/slog"
+)
+
+// PluginName is the name of the plugin.
+const PluginName = "tcp"
+
+const (
+	otelStatusTCPName      = "otelstatus.tcp.name"
+	otelStatusTCPAddress   = "otelstatus.tcp.address"
+	otelStatusTCPDuration  = "otelstatus.tcp.duration"
+	otelStatusTCPError     = "otelstatus.tcp.error"
+	otelStatusTCPTLSExpiry = "otelstatus.tcp.tls.expiry"
+)
+
+// maxBannerSize is the maximum number of bytes read while waiting for the expected banner.
+const maxBannerSize = 4096
+
+// Config is the configuration for a TCP status.
+type Config struct {
+	status.Config `yaml:",inline"`
+	// Address is the host:port to connect to.
+	Address string `yaml:"address"`
+	// Send is a string sent once connected, e.g. "PING\r\n".
+	Send string `yaml:"send"`
+	// Expect is a string that must be read from the connection, e.g. "+PONG" or "SSH-2.0".
+	Expect string `yaml:"expect"`
+	// TLS enables TLS on the connection if set.
+	TLS *status.TLSConfig `yaml:"tls"`
+	// Values is a map of key/value to add to the spans.
+	Values map[string]string `yaml:"values"`
+}
+
+// TCP is the main structure to use TCP status.
+type TCP struct {
+	SC      status.Config
+	Address string
+	Send    string
+	Expect  string
+	TLS     *status.TLSConfig
+	Values  map[string]string
+	// tlsExpiry reports the days before the expiration of the certificate.
+	tlsExpiry   status.Gauge[int64]
+	instruments status.Instruments[instruments]
+}
+
+// instruments are the synchronous instruments of the TCP status.
+type instruments struct {
+	duration instrument.Int64Histogram
+	error    instrument.Int64Counter
+}
+
+// newInstruments creates the synchronous instruments of the TCP status on the meter.
+func newInstruments(meter metric.Meter) (instruments, error) {
+	var i instruments
+	var err error
+	i.duration, err = meter.Int64Histogram(
+		otelStatusTCPDuration,
+		instrument.WithUnit(unit.Milliseconds),
+		instrument.WithDescription("Duration of the TCP connection"),
+	)
+	if err != nil {
+		return i, fmt.Errorf("creating TCP connection duration metric: %w", err)
+	}
+	i.error, err = meter.Int64Counter(
+		otelStatusTCPError,
+		instrument.WithUnit(unit.Dimensionless),
+		instrument.WithDescription("Error of the TCP connection"),
+	)
+	if err != nil {
+		return i, fmt.Errorf("creating TCP connection error metric: %w", err)
+	}
+	return i, nil
+}
+
+// New returns the TCP status of the configuration.
+func New(c Config) (*TCP, error) {
+	if _, _, err := net.SplitHostPort(c.Address); err != nil {
+		return nil, &status.ConfigError{Field: "address", Err: err}
+	}
+	return &TCP{
+		SC:      c.Config,
+		Address: c.Address,
+		Send:    c.Send,
+		Expect:  c.Expect,
+		TLS:     c.TLS,
+		Values:  c.Values,
+	}, nil
+}
+
+// Config returns the status.Config of the TCP status.
+func (t *TCP) Config() status.Config {
+	return t.SC
+}
+
+// Close stops reporting the gauges of the TCP status.
+func (t *TCP) Close() error {
+	return t.tlsExpiry.Unregister()
+}
+
+// Plugin returns the name of the TCP plugin.
+func (t *TCP) Plugin() string {
+	return PluginName
+}
+
+// State do the traces about the TCP status.
+// The duration is the time to establish the connection, TLS handshake included.
+func (t *TCP) State(ctx context.Context, tracer trace.Tracer, meter metric.Meter) (status.Result, error) {
+	start := time.Now()
+	metricCtx := status.WithoutCancel(ctx)
+
+	span := t.newSpan(ctx, tracer)
+	defer span.End()
+
+	conn, err := t.dial(ctx)
+	if err != nil {
+		// The expiry is still known when the verification of the certificate fails, e.g. once expired.
+		if leaf := status.FailedCertificate(err); leaf != nil {
+			if tlsErr := t.recordMetricTLSExpiry(meter, &tls.ConnectionState{PeerCertificates: []*x509.Certificate{leaf}}); tlsErr != nil {
+				slog.Error("creating TCP TLS expiry metric", tlsErr, slog.String("plugin", PluginName))
+			}
+		}
+		return status.Result{}, t.errorHandling(metricCtx, span, meter, err, "connecting")
+	}
+	defer conn.Close()
+
+	elapsedTime := time.Since(start).Milliseconds()
+	span.SetAttributes(attribute.Int64("duration", elapsedTime))
+
+	if tlsConn, ok := conn.(*tls.Conn); ok {
+		state := tlsConn.ConnectionState()
+		span.SetAttributes(status.TLSAttributes(&state)...)
+		if err = t.recordMetricTLSExpiry(meter, &state); err != nil {
+			return status.Result{}, t.errorHandling(metricCtx, span, meter, err, "creating TCP TLS expiry metric")
+		}
+	}
+
+	if deadline, ok := ctx.Deadline(); ok {
+		if err = conn.SetDeadline(deadline); err != nil {
+			return status.Result{}, t.errorHandling(metricCtx, span, meter, err, "setting deadline")
+		}
+	}
+
+	if t.Send != "" {
+		if _, err = conn.Write([]byte(t.Send)); err != nil {
+			return status.Result{}, t.errorHandling(metricCtx, span, meter, err, "sending data")
+		}
+	}
+
+	if t.Expect != "" {
+		banner, err := readUntil(conn, t.Expect)
+		if err != nil {
+			return status.Result{}, t.errorHandling(metricCtx, span, meter,
+				fmt.Errorf("%w, received %q", err, banner), "reading expected data")
+		}
+	}
+
+	slog.Info("status",
+		slog.String("plugin", PluginName),
+		slog.String("address", t.Address),
+		slog.Int64("duration", elapsedTime),
+	)
+
+	if err = t.recordMetricDuration(metricCtx, span, meter, elapsedTime); err != nil {
+		return status.Result{}, err
+	}
+	return status.Result{Up: true}, nil
+}
+
+// dial opens the connection, with TLS if configured.
+func (t *TCP) dial(ctx context.Context) (net.Conn, error) {
+	dialer := &net.Dialer{}
+	conn, err := dialer.DialContext(ctx, "tcp", t.Address)
+	if err != nil || t.TLS == nil {
+		return conn, err
+	}
+
+	tlsConfig, err := t.TLS.ClientConfig()
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	if tlsConfig.ServerName == "" {
+		tlsConfig.ServerName, _, _ = net.SplitHostPort(t.Address)
+	}
+	tlsConn := tls.Client(conn, tlsConfig)
+	if err = tlsConn.HandshakeContext(ctx); err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("TLS handshake: %w", err)
+	}
+	return tlsConn, nil
+}
+
+// readUntil reads from the connection until expected is found.
+// It returns what was read so far.
+func readUntil(conn net.Conn, expected string) (string, error) {
+	var received bytes.Buffer
+	buf := make([]byte, 512)
+	for received.Len() < maxBannerSize {
+		n, err := conn.Read(buf)
+		received.Write(buf[:n])
+		if strings.Contains(received.String(), expected) {
+			return received.String(), nil
+		}
+		if err != nil {
+			return received.String(), fmt.Errorf("expected %q not found: %w", expected, err)
+		}
+	}
+	return received.String(), fmt.Errorf("expected %q not found in the first %d bytes", expected, maxBannerSize)
+}
+
+// newSpan creates a new span for the TCP connection data.
+func (t *TCP) newSpan(ctx context.Context, tracer trace.Tracer) trace.Span {
+	host, port, _ := net.SplitHostPort(t.Address)
+	_, span := tracer.Start(ctx, fmt.Sprintf("TCP %s", t.Address),
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(
+			attribute.String(status.OtelStatusPluginName, PluginName),
+			semconv.NetTransportTCP,
+			semconv.NetPeerNameKey.String(host),
+			semconv.NetPeerPortKey.String(port),
+		),
+		trace.WithAttributes(t.configAttributes()...),
+	)
+	return span
+}
+
+// configAttributes returns the attributes from the config.
+func (t *TCP) configAttributes() []attribute.KeyValue {
+	var valuesAttributes []attribute.KeyValue
+	for k, v := range t.Values {
+		valuesAttributes = append(valuesAttributes, attribute.String(k, status.Redact(v)))
+	}
+	return valuesAttributes
+}
+
+// recordMetricDuration records the duration of the TCP connection in a metric.
+func (t *TCP) recordMetricDuration(ctx context.Context, span trace.Span, meter metric.Meter, elapsedTime int64) error {
+	inst, err := t.instruments.Get(meter, newInstruments)
+	if err != nil {
+		return t.errorHandling(ctx, span, meter, err, "creating TCP metrics")
+	}
+	inst.duration.Record(ctx, elapsedTime,
+		attribute.String(otelStatusTCPName, t.SC.Name),
+		attribute.String(otelStatusTCPAddress, t.Address),
+	)
+	return nil
+}
+
+// recordMetricTLSExpiry records the days before the expiration of the leaf certificate in a gauge.
+func (t *TCP) recordMetricTLSExpiry(meter metric.Meter, state *tls.ConnectionState) error {
+	days, ok := status.CertificateExpiryDays(state, time.Now())
+	if !ok {
+		return nil
+	}
+	return t.tlsExpiry.Set(meter, otelStatusTCPTLSExpiry,
+		[]instrument.Option{
+			instrument.WithUnit("d"),
+			instrument.WithDescription("Days before the expiration of the TLS certificate"),
+		},
+		status.GaugePoint[int64]{
+			Value: days,
+			Attributes: []attribute.KeyValue{
+				attribute.String(otelStatusTCPName, t.SC.Name),
+				attribute.String(otelStatusTCPAddress, t.Address),
+			},
+		},
+	)
+}
+
+// errorHandling is a helper function to handle errors.
+// It logs the error, records it in the span and in the error metric, and returns it.
+func (t *TCP) errorHandling(ctx context.Context, span trace.Span, meter metric.Meter, err error, msg string) error {
+	e := status.RedactError(fmt.Errorf("%s: %w", msg, err))
+	attributes := status.RecordError(ctx, span, PluginName, msg, e, status.ErrorClass(e))
+	if inst, err := t.instruments.Get(meter, newInstruments); err == nil {
+		inst.error.Add(ctx, 1, append([]attribute.KeyValue{
+			attribute.String(otelStatusTCPName, t.SC.Name),
+			attribute.String(otelStatusTCPAddress, t.Address),
+		}, attributes...)...)
+	}
+	return e
+}
@@ -0,0 +1,306 @@
+/*******************************************************************************
+ * Copyright (c) 2023 Cedric L'homme.
+ *
+ * This file is part of otel-status.
+ *
+ * otel-status is free software: you can redistribute it and/or modify it
+ * under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License,
+ * or (at your option) any later version.
+ *
+ *  otel-status is distributed in the hope that it will be useful, but
+ *  WITHOUT ANY WARRANTY; without even the implied warranty of
+ *  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.
+ *  See the GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with otel-status. If not, see <https://www.gnu.org/licenses/>.
+ ******************************************************************************/
+
+package tcp_test
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"math/big"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/rangzen/otel-status/package/status"
+	"github.com/rangzen/otel-status/package/status/tcp"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/sdk/metric"
+	"go.opentelemetry.io/otel/sdk/metric/metricdata"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+// expiredCertificate returns a self-signed certificate for 127.0.0.1 that expired an hour ago.
+func expiredCertificate(t *testing.T) tls.Certificate {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "expired"},
+		IPAddresses:  []net.IP{net.IPv4(127, 0, 0, 1)},
+		NotBefore:    time.Now().Add(-48 * time.Hour),
+		NotAfter:     time.Now().Add(-time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	require.NoError(t, err)
+	return tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key}
+}
+
+func TestTCP_State(t *testing.T) {
+	t.Run("an open port with the expected banner, should create a span without an error status", func(t *testing.T) {
+		listener, err := net.Listen("tcp", "127.0.0.1:0")
+		require.NoError(t, err)
+		defer listener.Close()
+		go func() {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			defer conn.Close()
+			buf := make([]byte, 16)
+			n, _ := conn.Read(buf)
+			if strings.TrimSpace(string(buf[:n])) == "PING" {
+				_, _ = conn.Write([]byte("+PONG\r\n"))
+			}
+		}()
+
+		exp := tracetest.NewInMemoryExporter()
+		tp := sdktrace.NewTracerProvider(
+			sdktrace.WithSyncer(exp),
+		)
+		mockTracer := tp.Tracer("test-tracer")
+
+		rdr := metric.NewManualReader()
+		mp := metric.NewMeterProvider(metric.WithReader(rdr))
+		mockMeter := mp.Meter("test-meter")
+
+		stater, err := tcp.New(tcp.Config{
+			Config: status.Config{
+				Name:        "Test",
+				Description: "Test banner",
+				Cron:        "@99m",
+			},
+			Address: listener.Addr().String(),
+			Send:    "PING\r\n",
+			Expect:  "+PONG",
+		})
+		require.NoError(t, err)
+
+		_, err = stater.State(context.Background(), mockTracer, mockMeter)
+		require.NoError(t, err)
+
+		spans := exp.GetSpans()
+		require.Len(t, spans, 1)
+		require.Equal(t, codes.Unset, spans[0].Status.Code)
+
+		m, err := rdr.Collect(context.Background())
+		assert.NoError(t, err)
+
+		require.Len(t, m.ScopeMetrics, 1)
+		require.Len(t, m.ScopeMetrics[0].Metrics, 1)
+		assert.Equal(t, "otelstatus.tcp.duration", m.ScopeMetrics[0].Metrics[0].Name)
+	})
+
+	t.Run("an unexpected banner, should create a span with an error status", func(t *testing.T) {
+		listener, err := net.Listen("tcp", "127.0.0.1:0")
+		require.NoError(t, err)
+		defer listener.Close()
+		go func() {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			_, _ = conn.Write([]byte("220 hello\r\n"))
+			conn.Close()
+		}()
+
+		exp := tracetest.NewInMemoryExporter()
+		tp := sdktrace.NewTracerProvider(
+			sdktrace.WithSyncer(exp),
+		)
+		mockTracer := tp.Tracer("test-tracer")
+
+		rdr := metric.NewManualReader()
+		mp := metric.NewMeterProvider(metric.WithReader(rdr))
+		mockMeter := mp.Meter("test-meter")
+
+		stater, err := tcp.New(tcp.Config{
+			Config: status.Config{
+				Name:        "Test",
+				Description: "Test wrong banner",
+				Cron:        "@99m",
+			},
+			Address: listener.Addr().String(),
+			Expect:  "SSH-2.0",
+		})
+		require.NoError(t, err)
+
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+		defer cancel()
+		_, err = stater.State(ctx, mockTracer, mockMeter)
+		require.Error(t, err)
+
+		spans := exp.GetSpans()
+		require.Len(t, spans, 1)
+		require.Equal(t, codes.Error, spans[0].Status.Code)
+
+		m, err := rdr.Collect(context.Background())
+		assert.NoError(t, err)
+
+		require.Len(t, m.ScopeMetrics, 1)
+		require.Len(t, m.ScopeMetrics[0].Metrics, 1)
+	})
+
+	t.Run("a closed port, should create a span with an error status", func(t *testing.T) {
+		listener, err := net.Listen("tcp", "127.0.0.1:0")
+		require.NoError(t, err)
+		address := listener.Addr().String()
+		require.NoError(t, listener.Close())
+
+		exp := tracetest.NewInMemoryExporter()
+		tp := sdktrace.NewTracerProvider(
+			sdktrace.WithSyncer(exp),
+		)
+		mockTracer := tp.Tracer("test-tracer")
+
+		rdr := metric.NewManualReader()
+		mp := metric.NewMeterProvider(metric.WithReader(rdr))
+		mockMeter := mp.Meter("test-meter")
+
+		stater, err := tcp.New(tcp.Config{
+			Config: status.Config{
+				Name:        "Test",
+				Description: "Test closed port",
+				Cron:        "@99m",
+			},
+			Address: address,
+		})
+		require.NoError(t, err)
+
+		_, err = stater.State(context.Background(), mockTracer, mockMeter)
+		require.Error(t, err)
+
+		spans := exp.GetSpans()
+		require.Len(t, spans, 1)
+		require.Equal(t, codes.Error, spans[0].Status.Code)
+
+		m, err := rdr.Collect(context.Background())
+		assert.NoError(t, err)
+
+		require.Len(t, m.ScopeMetrics, 1)
+		require.Len(t, m.ScopeMetrics[0].Metrics, 1)
+	})
+
+	t.Run("a TLS port, should record the certificate", func(t *testing.T) {
+		mockServer := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusOK)
+		}))
+		defer mockServer.Close()
+
+		exp := tracetest.NewInMemoryExporter()
+		tp := sdktrace.NewTracerProvider(
+			sdktrace.WithSyncer(exp),
+		)
+		mockTracer := tp.Tracer("test-tracer")
+
+		rdr := metric.NewManualReader()
+		mp := metric.NewMeterProvider(metric.WithReader(rdr))
+		mockMeter := mp.Meter("test-meter")
+
+		stater, err := tcp.New(tcp.Config{
+			Config: status.Config{
+				Name:        "Test",
+				Description: "Test TLS",
+				Cron:        "@99m",
+			},
+			Address: mockServer.Listener.Addr().String(),
+			Send:    "GET / HTTP/1.0\r\n\r\n",
+			Expect:  "HTTP/1.0 200",
+			TLS:     &status.TLSConfig{InsecureSkipVerify: true},
+		})
+		require.NoError(t, err)
+
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+		defer cancel()
+		_, err = stater.State(ctx, mockTracer, mockMeter)
+		require.NoError(t, err)
+
+		spans := exp.GetSpans()
+		require.Len(t, spans, 1)
+		require.Equal(t, codes.Unset, spans[0].Status.Code)
+
+		m, err := rdr.Collect(context.Background())
+		assert.NoError(t, err)
+
+		require.Len(t, m.ScopeMetrics, 1)
+		require.Len(t, m.ScopeMetrics[0].Metrics, 2)
+	})
+
+	t.Run("an expired certificate, should create a span with an error status and record its expiry", func(t *testing.T) {
+		mockServer := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusOK)
+		}))
+		mockServer.TLS = &tls.Config{Certificates: []tls.Certificate{expiredCertificate(t)}}
+		mockServer.StartTLS()
+		defer mockServer.Close()
+
+		exp := tracetest.NewInMemoryExporter()
+		tp := sdktrace.NewTracerProvider(
+			sdktrace.WithSyncer(exp),
+		)
+		rdr := metric.NewManualReader()
+		mp := metric.NewMeterProvider(metric.WithReader(rdr))
+
+		stater, err := tcp.New(tcp.Config{
+			Config: status.Config{
+				Name:        "Test",
+				Description: "Test expired certificate",
+				Cron:        "@99m",
+			},
+			Address: mockServer.Listener.Addr().String(),
+			TLS:     &status.TLSConfig{},
+		})
+		require.NoError(t, err)
+
+		_, err = stater.State(context.Background(), tp.Tracer("test-tracer"), mp.Meter("test-meter"))
+		require.Error(t, err)
+
+		spans := exp.GetSpans()
+		require.Len(t, spans, 1)
+		require.Equal(t, codes.Error, spans[0].Status.Code)
+
+		m, err := rdr.Collect(context.Background())
+		require.NoError(t, err)
+		require.Len(t, m.ScopeMetrics, 1)
+		var days []int64
+		for _, mm := range m.ScopeMetrics[0].Metrics {
+			if mm.Name == "otelstatus.tcp.tls.expiry" {
+				for _, dp := range mm.Data.(metricdata.Gauge[int64]).DataPoints {
+					days = append(days, dp.Value)
+				}
+			}
+		}
+		assert.Equal(t, []int64{-1}, days)
+	})
+
+	t.Run("an address without port, should return an error", func(t *testing.T) {
+		_, err := tcp.New(tcp.Config{Address: "localhost"})
+		require.Error(t, err)
+	})
+}
@@ -0,0 +1,176 @@
+/*******************************************************************************
+ * Copyright (c) 2023 Cedric L'homme.
+ *
+ * This file is part of otel-status.
+ *
+ * otel-status is free software: you can redistribute it and/or modify it
+ * under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License,
+ * or (at your option) any later version.
+ *
+ *  otel-status is distributed in the hope that it will be useful, but
+ *  WITHOUT ANY WARRANTY; without even the implied warranty of
+ *  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.
+ *  See the GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with otel-status. If not, see <https://www.gnu.org/licenses/>.
+ ******************************************************************************/
+
+package status
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"os"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+)
+
+const (
+	// TLSVersion is the key for the negotiated TLS version.
+	TLSVersion = "tls.protocol.version"
+	// TLSCipher is the key for the negotiated cipher suite.
+	TLSCipher = "tls.cipher"
+	// TLSServerIssuer is the key for the issuer of the leaf certificate.
+	TLSServerIssuer = "tls.server.issuer"
+	// TLSServerSubject is the key for the subject of the leaf certificate.
+	TLSServerSubject = "tls.server.subject"
+	// TLSServerSAN is the key for the subject alternative names of the leaf certificate.
+	TLSServerSAN = "tls.server.san"
+	// TLSServerNotAfter is the key for the expiration date of the leaf certificate.
+	TLSServerNotAfter = "tls.server.not_after"
+)
+
+// TLSConfig is the TLS configuration of a client.
+type TLSConfig struct {
+	// CAFile is the path of a PEM bundle of the certificate authorities to trust instead of the system ones.
+	CAFile string `yaml:"ca_file"`
+	// CertFile and KeyFile are the paths of the PEM client certificate and key for mutual TLS.
+	CertFile string `yaml:"cert_file"`
+	KeyFile  string `yaml:"key_file"`
+	// ServerName overrides the name used for SNI and the verification of the certificate.
+	ServerName string `yaml:"server_name"`
+	// InsecureSkipVerify disables the verification of the server certificate.
+	InsecureSkipVerify bool `yaml:"insecure_skip_verify"`
+}
+
+// ClientConfig returns the *tls.Config of the configuration.
+// The files are read at each call.
+func (c TLSConfig) ClientConfig() (*tls.Config, error) {
+	conf := &tls.Config{
+		ServerName:         c.ServerName,
+		InsecureSkipVerify: c.InsecureSkipVerify,
+		MinVersion:         tls.VersionTLS10,
+	}
+
+	if c.CAFile != "" {
+		data, err := os.ReadFile(c.CAFile)
+		if err != nil {
+			return nil, fmt.Errorf("reading CA file: %w", err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(data) {
+			return nil, fmt.Errorf("no certificate found in CA file %s", c.CAFile)
+		}
+		conf.RootCAs = pool
+	}
+
+	if c.CertFile != "" || c.KeyFile != "" {
+		if c.CertFile == "" || c.KeyFile == "" {
+			return nil, errors.New("both cert_file and key_file are needed for a client certificate")
+		}
+		cert, err := tls.LoadX509KeyPair(c.CertFile, c.KeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("loading client certificate: %w", err)
+		}
+		conf.Certificates = []tls.Certificate{cert}
+	}
+
+	return conf, nil
+}
+
+// TLSAttributes returns the span attributes describing the TLS connection and its leaf certificate.
+func TLSAttributes(state *tls.ConnectionState) []attribute.KeyValue {
+	attrs := []attribute.KeyValue{
+		attribute.String(TLSVersion, TLSVersionName(state.Version)),
+		attribute.String(TLSCipher, tls.CipherSuiteName(state.CipherSuite)),
+	}
+	if len(state.PeerCertificates) == 0 {
+		return attrs
+	}
+	leaf := state.PeerCertificates[0]
+	return append(attrs,
+		attribute.String(TLSServerIssuer, leaf.Issuer.String()),
+		attribute.String(TLSServerSubject, leaf.Subject.String()),
+		attribute.StringSlice(TLSServerSAN, subjectAltNames(leaf)),
+		attribute.String(TLSServerNotAfter, leaf.NotAfter.UTC().Format(time.RFC3339)),
+	)
+}
+
+// CertificateExpiryDays returns the number of full days before the expiration of the leaf certificate.
+// It is negative if the certificate is already expired.
+// The boolean is false if there is no certificate.
+func CertificateExpiryDays(state *tls.ConnectionState, now time.Time) (int64, bool) {
+	if state == nil || len(state.PeerCertificates) == 0 {
+		return 0, false
+	}
+	remaining := state.PeerCertificates[0].NotAfter.Sub(now)
+	days := remaining / (24 * time.Hour)
+	// The division truncates toward zero, an expired certificate must be negative.
+	if remaining%(24*time.Hour) < 0 {
+		days--
+	}
+	return int64(days), true
+}
+
+// FailedCertificate returns the certificate whose verification failed in the error, nil if there is none.
+// It is the leaf certificate when it is expired, not yet valid, not trusted or for another host.
+func FailedCertificate(err error) *x509.Certificate {
+	var unknownAuthorityErr x509.UnknownAuthorityError
+	var invalidErr x509.CertificateInvalidError
+	var hostnameErr x509.HostnameError
+	switch {
+	case errors.As(err, &unknownAuthorityErr):
+		return unknownAuthorityErr.Cert
+	case errors.As(err, &invalidErr):
+		return invalidErr.Cert
+	case errors.As(err, &hostnameErr):
+		return hostnameErr.Certificate
+	default:
+		return nil
+	}
+}
+
+// TLSVersionName returns the name of the TLS version, e.g. "1.3".
+func TLSVersionName(version uint16) string {
+	switch version {
+	case tls.VersionTLS10:
+		return "1.0"
+	case tls.VersionTLS11:
+		return "1.1"
+	case tls.VersionTLS12:
+		return "1.2"
+	case tls.VersionTLS13:
+		return "1.3"
+	default:
+		return fmt.Sprintf("0x%04X", version)
+	}
+}
+
+// subjectAltNames returns all the subject alternative names of the certificate.
+func subjectAltNames(cert *x509.Certificate) []string {
+	sans := make([]string, 0, len(cert.DNSNames)+len(cert.IPAddresses)+len(cert.EmailAddresses)+len(cert.URIs))
+	sans = append(sans, cert.DNSNames...)
+	for _, ip := range cert.IPAddresses {
+		sans = append(sans, ip.String())
+	}
+	sans = append(sans, cert.EmailAddresses...)
+	for _, uri := range cert.URIs {
+		sans = append(sans, uri.String())
+	}
+	return sans
+}
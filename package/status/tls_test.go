@@ -0,0 +1,57 @@
+/*******************************************************************************
+ * Copyright (c) 2023 Cedric L'homme.
+ *
+ * This file is part of otel-status.
+ *
+ * otel-status is free software: you can redistribute it and/or modify it
+ * under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License,
+ * or (at your option) any later version.
+ *
+ *  otel-status is distributed in the hope that it will be useful, but
+ *  WITHOUT ANY WARRANTY; without even the implied warranty of
+ *  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.
+ *  See the GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with otel-status. If not, see <https://www.gnu.org/licenses/>.
+ ******************************************************************************/
+
+package status_test
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"testing"
+	"time"
+
+	"github.com/rangzen/otel-status/package/status"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCertificateExpiryDays(t *testing.T) {
+	now := time.Date(2023, 5, 1, 12, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name     string
+		notAfter time.Time
+		want     int64
+	}{
+		{name: "a certificate expiring in 36 hours, should return 1", notAfter: now.Add(36 * time.Hour), want: 1},
+		{name: "a certificate expiring in an hour, should return 0", notAfter: now.Add(time.Hour), want: 0},
+		{name: "a certificate expired an hour ago, should return -1", notAfter: now.Add(-time.Hour), want: -1},
+		{name: "a certificate expired a day ago, should return -1", notAfter: now.Add(-24 * time.Hour), want: -1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			state := &tls.ConnectionState{PeerCertificates: []*x509.Certificate{{NotAfter: tt.notAfter}}}
+			days, ok := status.CertificateExpiryDays(state, now)
+			assert.True(t, ok)
+			assert.Equal(t, tt.want, days)
+		})
+	}
+
+	t.Run("no certificate, should return false", func(t *testing.T) {
+		_, ok := status.CertificateExpiryDays(&tls.ConnectionState{}, now)
+		assert.False(t, ok)
+	})
+}